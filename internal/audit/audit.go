@@ -0,0 +1,198 @@
+// Package audit keeps a log of the rows changed through the server, with
+// each row's full image before and after, in a sidecar file.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+	"github.com/rzhade3/sqlite-webgui/internal/sidecar"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS changes (
+	id         INTEGER PRIMARY KEY,
+	database   TEXT NOT NULL,
+	changed_at INTEGER NOT NULL,
+	client     TEXT NOT NULL,
+	table_name TEXT NOT NULL,
+	operation  TEXT NOT NULL,
+	row_key    TEXT NOT NULL,
+	before     TEXT,
+	after      TEXT,
+	undone_at  INTEGER
+);
+CREATE INDEX IF NOT EXISTS changes_database ON changes (database, id);
+`
+
+var ErrNotFound = errors.New("audit entry not found")
+
+// Store is an audit log file.
+type Store struct {
+	conn *sql.DB
+}
+
+// DefaultPath is the audit log file in the user's config directory.
+func DefaultPath() (string, error) {
+	return sidecar.Path("audit.db")
+}
+
+// Open opens the audit log file at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	conn, err := sidecar.Open(path, "audit log", schema)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{conn: conn}, nil
+}
+
+func (s *Store) Close() error {
+	return s.conn.Close()
+}
+
+func encode(value interface{}) (interface{}, error) {
+	if v, ok := value.(map[string]interface{}); ok && v == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode row: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// Record adds entries to the audit log of database, which should be an
+// absolute path so every way of naming the file shares one log.
+func (s *Store) Record(ctx context.Context, database string, entries []models.AuditEntry) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		"INSERT INTO changes (database, changed_at, client, table_name, operation, row_key, before, after) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		key, err := encode(entry.Key)
+		if err != nil {
+			return err
+		}
+		before, err := encode(entry.Before)
+		if err != nil {
+			return err
+		}
+		after, err := encode(entry.After)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, database, entry.ChangedAt.UnixMilli(), entry.Client, entry.Table, entry.Operation, key, before, after); err != nil {
+			return fmt.Errorf("failed to record change: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+const selectEntry = "SELECT id, changed_at, client, table_name, operation, row_key, before, after, undone_at FROM changes"
+
+// decode reads a row image or key back, with numbers as json.Number so
+// integers beyond 2^53 survive.
+func decode(encoded sql.NullString, dest interface{}) error {
+	if !encoded.Valid {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(encoded.String)))
+	decoder.UseNumber()
+	if err := decoder.Decode(dest); err != nil {
+		return fmt.Errorf("failed to decode row: %w", err)
+	}
+	return nil
+}
+
+func scanEntry(row interface{ Scan(...interface{}) error }) (*models.AuditEntry, error) {
+	var (
+		entry              models.AuditEntry
+		changedAt          int64
+		key, before, after sql.NullString
+		undoneAt           sql.NullInt64
+	)
+	err := row.Scan(&entry.ID, &changedAt, &entry.Client, &entry.Table, &entry.Operation, &key, &before, &after, &undoneAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+	}
+	entry.ChangedAt = time.UnixMilli(changedAt).UTC()
+	if undoneAt.Valid {
+		at := time.UnixMilli(undoneAt.Int64).UTC()
+		entry.UndoneAt = &at
+	}
+	for _, part := range []struct {
+		encoded sql.NullString
+		dest    interface{}
+	}{{key, &entry.Key}, {before, &entry.Before}, {after, &entry.After}} {
+		if err := decode(part.encoded, part.dest); err != nil {
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// List returns the audit log of database, newest first. A non-empty table
+// keeps only the changes to that table.
+func (s *Store) List(ctx context.Context, database, table string, limit, offset int) ([]models.AuditEntry, error) {
+	where := "database = ?"
+	args := []interface{}{database}
+	if table != "" {
+		where += " AND table_name = ?"
+		args = append(args, table)
+	}
+
+	rows, err := s.conn.QueryContext(ctx, selectEntry+" WHERE "+where+" ORDER BY id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+// Get returns an entry of the audit log of database.
+func (s *Store) Get(ctx context.Context, database string, id int64) (*models.AuditEntry, error) {
+	return scanEntry(s.conn.QueryRowContext(ctx, selectEntry+" WHERE id = ? AND database = ?", id, database))
+}
+
+// MarkUndone records that an entry of the audit log of database has been
+// undone.
+func (s *Store) MarkUndone(ctx context.Context, database string, id int64, at time.Time) error {
+	result, err := s.conn.ExecContext(ctx, "UPDATE changes SET undone_at = ? WHERE id = ? AND database = ?", at.UnixMilli(), id, database)
+	if err != nil {
+		return fmt.Errorf("failed to mark change undone: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,617 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// ErrRowChanged is returned when undoing a change to a row that has been
+// changed again since.
+var ErrRowChanged = errors.New("the row has changed since; it can no longer be undone")
+
+// ChangeRecorder receives the rows changed by a write once the write is
+// committed.
+type ChangeRecorder func(ctx context.Context, changes []models.AuditEntry)
+
+// SetChangeRecorder has every row change made through db, whether by row
+// editing, bulk operations, CSV import or scripts, reported to record.
+// Schema changes are not reported, nor are the rows they copy.
+func (db *DB) SetChangeRecorder(record ChangeRecorder) {
+	db.recorder = record
+}
+
+type clientKey struct{}
+
+// WithClient returns a context whose changes are attributed to client.
+func WithClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+func clientFrom(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+// record reports committed changes to the recorder. Changes made in a
+// session are held until the session commits.
+func (db *DB) record(ctx context.Context, changes []models.AuditEntry) {
+	if len(changes) == 0 {
+		return
+	}
+	if s := db.session(ctx); s != nil {
+		s.pending = append(s.pending, changes...)
+		return
+	}
+	if db.recorder != nil {
+		db.recorder(context.WithoutCancel(ctx), changes)
+	}
+}
+
+// rowEvent is one row write seen by the preupdate hook. Its values are
+// in table column order.
+type rowEvent struct {
+	table              string
+	op                 int32
+	oldRowid, newRowid int64
+	old, new           []interface{}
+}
+
+// changeCapture collects the row writes made on one connection. The hook
+// only sees writes as they happen, and some of them may later be undone
+// by rolling back to a savepoint, which SQLite does not report; so the
+// rows are read again when the changes are settled, and only those that
+// differ from before are kept.
+type changeCapture struct {
+	conn   *sql.Conn
+	events []rowEvent
+	// ended counts the transactions that ended on conn, once
+	// trackTransactions is called.
+	ended    int
+	tracking bool
+}
+
+// startCapture begins collecting the row writes made on conn. It returns
+// nil, and captures nothing, when no recorder is set; the methods of a
+// nil capture do nothing.
+func (db *DB) startCapture(conn *sql.Conn) (*changeCapture, error) {
+	if db.recorder == nil {
+		return nil, nil
+	}
+	c := &changeCapture{conn: conn}
+	if err := c.register(c.hook); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *changeCapture) register(hook sqlite.PreUpdateHookFn) error {
+	return c.conn.Raw(func(driverConn interface{}) error {
+		hooks, ok := driverConn.(sqlite.HookRegisterer)
+		if !ok {
+			return fmt.Errorf("the SQLite driver cannot report row changes")
+		}
+		hooks.RegisterPreUpdateHook(hook)
+		return nil
+	})
+}
+
+// trackTransactions has the capture count the transactions that end on
+// its connection, as runCaptured needs. A session watches its own
+// connection, so this is not for use in one.
+func (c *changeCapture) trackTransactions() error {
+	if c == nil {
+		return nil
+	}
+	c.tracking = true
+	return watchTransactions(c.conn, func(bool) { c.ended++ })
+}
+
+// stop ends the capture.
+func (c *changeCapture) stop() {
+	if c != nil {
+		c.register(nil)
+		if c.tracking {
+			watchTransactions(c.conn, nil)
+		}
+	}
+}
+
+// reset forgets the writes collected so far, once they have been
+// recorded or rolled back.
+func (c *changeCapture) reset() {
+	if c != nil {
+		c.events = nil
+	}
+}
+
+func (c *changeCapture) hook(d sqlite.SQLitePreUpdateData) {
+	// Temporary and attached databases are not audited.
+	if d.DatabaseName != "main" {
+		return
+	}
+	ev := rowEvent{table: d.TableName, op: d.Op, oldRowid: d.OldRowID, newRowid: d.OldRowID}
+	count := d.Count()
+	if d.Op != sqlite3.SQLITE_INSERT {
+		ev.old = make([]interface{}, count)
+		d.Old(ev.old...)
+	}
+	if d.Op != sqlite3.SQLITE_DELETE {
+		ev.new = make([]interface{}, count)
+		d.New(ev.new...)
+	}
+	// The driver passes the rowid an UPDATE writes cut to 32 bits, so it
+	// is only used when it differs from the old one there; for an INSERT
+	// the old rowid is the new one.
+	if d.Op == sqlite3.SQLITE_UPDATE && d.NewRowID != int64(int32(d.OldRowID)) {
+		ev.newRowid = d.NewRowID
+	}
+	c.events = append(c.events, ev)
+}
+
+// runCaptured runs a statement of a script outside a session so that the
+// rows it changes are recorded once they are committed, and read in the
+// transaction that commits them. A write outside a transaction runs in
+// one of its own for that; the rows a transaction of the script changed
+// are read just before it commits.
+func (db *DB) runCaptured(ctx context.Context, conn *sql.Conn, capture *changeCapture, verb string, run func() error) error {
+	if capture == nil {
+		return run()
+	}
+	cleanup := context.WithoutCancel(ctx)
+
+	switch {
+	case isWriteVerb(verb):
+		if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+			// A transaction is open, and its commit records the changes.
+			return run()
+		}
+		// As with autocommit, what a failing statement leaves changed,
+		// such as the rows before the failure under OR FAIL, is kept. If
+		// the failure rolled back the transaction, the commit fails and
+		// nothing changed.
+		err := run()
+		changes, settleErr := capture.settle(cleanup, conn)
+		if settleErr == nil {
+			_, settleErr = conn.ExecContext(cleanup, "COMMIT")
+		}
+		if settleErr != nil {
+			conn.ExecContext(cleanup, "ROLLBACK")
+			changes = nil
+		}
+		db.record(ctx, changes)
+		capture.reset()
+		if err == nil && settleErr != nil && !strings.Contains(settleErr.Error(), "no transaction is active") {
+			err = fmt.Errorf("failed to record changes: %w", settleErr)
+		}
+		return err
+
+	case verb == "COMMIT" || verb == "END" || verb == "RELEASE":
+		changes, err := capture.settle(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("failed to record changes: %w", err)
+		}
+		ended := capture.ended
+		if err := run(); err != nil {
+			return err
+		}
+		// RELEASE only commits when it ends the transaction.
+		if capture.ended != ended {
+			db.record(ctx, changes)
+			capture.reset()
+		}
+		return nil
+
+	default:
+		ended := capture.ended
+		err := run()
+		// Writes outside a transaction here are the rows a schema change
+		// copies, which are not recorded; after a ROLLBACK, or an error
+		// that rolled the transaction back, there is nothing left to
+		// record.
+		if capture.ended != ended {
+			capture.reset()
+		}
+		return err
+	}
+}
+
+// auditShape is what settling needs to know about a table: the columns
+// of its row images, and how the key of a row is found.
+type auditShape struct {
+	// columns are the stored columns; index maps each to its position in
+	// the hook's values, which include generated columns.
+	columns []string
+	index   []int
+	// keyColumns identify a row: the primary key, or rowidAlias.
+	keyColumns []string
+	rowidAlias string
+}
+
+// readAuditShape returns the shape of tableName, or nil if it no longer
+// exists.
+func readAuditShape(ctx context.Context, q querier, tableName string) (*auditShape, error) {
+	rows, err := q.QueryContext(ctx, "SELECT name, pk, hidden FROM pragma_table_xinfo(?) ORDER BY cid", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table schema: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		shape auditShape
+		pk    = map[int]string{}
+		names = map[string]bool{}
+	)
+	for i := 0; rows.Next(); i++ {
+		var (
+			name          string
+			order, hidden int
+		)
+		if err := rows.Scan(&name, &order, &hidden); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		names[strings.ToLower(name)] = true
+		if order > 0 {
+			pk[order] = name
+		}
+		// Generated columns cannot be written, so they are left out.
+		if hidden == 0 {
+			shape.columns = append(shape.columns, name)
+			shape.index = append(shape.index, i)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	for order := 1; order <= len(pk); order++ {
+		shape.keyColumns = append(shape.keyColumns, pk[order])
+	}
+	if len(shape.keyColumns) == 0 {
+		for _, alias := range []string{"rowid", "_rowid_", "oid"} {
+			if !names[alias] {
+				shape.rowidAlias = alias
+				shape.keyColumns = []string{alias}
+				break
+			}
+		}
+	}
+	return &shape, nil
+}
+
+// image returns a row image from the hook's values. Tables keyed by rowid
+// include it, so a deleted row can be put back where it was.
+func (s *auditShape) image(values []interface{}, rowid int64) map[string]interface{} {
+	image := map[string]interface{}{}
+	for i, col := range s.columns {
+		var val interface{}
+		if s.index[i] < len(values) {
+			val = values[s.index[i]]
+		}
+		image[col] = imageValue(val)
+	}
+	if s.rowidAlias != "" {
+		image[s.rowidAlias] = rowid
+	}
+	return image
+}
+
+// imageValue converts a value for a row image, where BLOBs are kept as
+// models.AuditBlob.
+func imageValue(val interface{}) interface{} {
+	if b, ok := val.([]byte); ok {
+		return models.AuditBlob{Type: models.CellBlob, Base64: base64.StdEncoding.EncodeToString(b)}
+	}
+	return val
+}
+
+func (s *auditShape) key(image map[string]interface{}) models.RowKey {
+	key := models.RowKey{}
+	for _, col := range s.keyColumns {
+		key[col] = image[col]
+	}
+	return key
+}
+
+// selectImage reads the row image of key, or nil if there is no such row.
+func (s *auditShape) selectImage(ctx context.Context, q querier, tableName string, key models.RowKey) (map[string]interface{}, error) {
+	// Keys taken from row images hold BLOBs as models.AuditBlob.
+	bound := models.RowKey{}
+	for col, val := range key {
+		bound[col] = auditValue(val)
+	}
+	where, args, err := keyWhereClause(s.keyColumns, bound)
+	if err != nil {
+		return nil, err
+	}
+	columns := s.columns
+	if s.rowidAlias != "" {
+		columns = append([]string{s.rowidAlias}, columns...)
+	}
+	// The unary plus keeps each value as stored: the driver would turn
+	// text in a column declared DATE or DATETIME into a time otherwise,
+	// which would not match the hook's values.
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = "+" + quoteIdent(col)
+	}
+
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(quoted, ", "), quoteIdent(tableName), where)
+	if err := q.QueryRowContext(ctx, query, args...).Scan(valuePtrs...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read changed row: %w", err)
+	}
+
+	image := map[string]interface{}{}
+	for i, col := range columns {
+		image[col] = imageValue(values[i])
+	}
+	return image, nil
+}
+
+// sameImage reports whether two row images hold the same values, as
+// they would be stored in the audit log.
+func sameImage(a, b map[string]interface{}) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	encodedA, errA := canonicalImage(a)
+	encodedB, errB := canonicalImage(b)
+	return errA == nil && errB == nil && encodedA == encodedB
+}
+
+// canonicalImage encodes a row image as JSON with every object's keys
+// sorted, so an image read back from the log, where a BLOB is a map,
+// encodes the same as one holding a models.AuditBlob.
+func canonicalImage(image map[string]interface{}) (string, error) {
+	encoded, err := json.Marshal(image)
+	if err != nil {
+		return "", err
+	}
+	var generic interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return "", err
+	}
+	encoded, err = json.Marshal(generic)
+	return string(encoded), err
+}
+
+// settle turns the writes collected so far into audit entries, one for
+// each row that now differs from before, reading the rows as they are
+// now through q. Called before a commit, it reads them in the
+// transaction being committed. The writes are kept until reset, in case
+// the commit fails.
+func (c *changeCapture) settle(ctx context.Context, q querier) ([]models.AuditEntry, error) {
+	if c == nil || len(c.events) == 0 {
+		return nil, nil
+	}
+
+	// tracked follows one row through the writes, which may change its
+	// key, from its image before the first of them.
+	type tracked struct {
+		table  string
+		shape  *auditShape
+		before map[string]interface{}
+		key    models.RowKey
+		gone   bool
+	}
+	var (
+		shapes  = map[string]*auditShape{}
+		rows    []*tracked
+		current = map[string]*tracked{}
+	)
+	identity := func(table string, key models.RowKey, shape *auditShape) string {
+		parts := make([]interface{}, len(shape.keyColumns))
+		for i, col := range shape.keyColumns {
+			parts[i] = key[col]
+		}
+		encoded, _ := json.Marshal(parts)
+		return table + "\x00" + string(encoded)
+	}
+
+	for _, ev := range c.events {
+		shape, ok := shapes[ev.table]
+		if !ok {
+			var err error
+			if shape, err = readAuditShape(ctx, q, ev.table); err != nil {
+				return nil, err
+			}
+			shapes[ev.table] = shape
+		}
+		if shape == nil {
+			// Dropped since: none of its rows remain.
+			continue
+		}
+
+		var row *tracked
+		if ev.old != nil {
+			before := shape.image(ev.old, ev.oldRowid)
+			id := identity(ev.table, shape.key(before), shape)
+			if row = current[id]; row == nil {
+				row = &tracked{table: ev.table, shape: shape, before: before, key: shape.key(before)}
+				rows = append(rows, row)
+				current[id] = row
+			}
+		}
+		if ev.new != nil {
+			key := shape.key(shape.image(ev.new, ev.newRowid))
+			id := identity(ev.table, key, shape)
+			if row == nil {
+				// An insert, possibly of a row deleted earlier.
+				if row = current[id]; row == nil {
+					row = &tracked{table: ev.table, shape: shape}
+					rows = append(rows, row)
+				}
+			} else if other := current[id]; other != nil && other != row {
+				// The row took the key of one deleted earlier, which
+				// therefore stays deleted.
+				other.gone = true
+			}
+			if ev.old != nil {
+				delete(current, identity(ev.table, row.key, shape))
+			}
+			row.key = key
+			current[id] = row
+		}
+	}
+
+	now := time.Now()
+	client := clientFrom(ctx)
+	var changes []models.AuditEntry
+	for _, row := range rows {
+		var after map[string]interface{}
+		if !row.gone {
+			var err error
+			if after, err = row.shape.selectImage(ctx, q, row.table, row.key); err != nil {
+				return nil, err
+			}
+		}
+		if sameImage(row.before, after) {
+			continue
+		}
+
+		entry := models.AuditEntry{
+			ChangedAt: now,
+			Client:    client,
+			Table:     row.table,
+			Key:       row.key,
+			Before:    row.before,
+			After:     after,
+		}
+		switch {
+		case row.before == nil:
+			entry.Operation = models.AuditInsert
+		case after == nil:
+			entry.Operation = models.AuditDelete
+			entry.Key = row.shape.key(row.before)
+		default:
+			entry.Operation = models.AuditUpdate
+		}
+		changes = append(changes, entry)
+	}
+	return changes, nil
+}
+
+// UndoChange applies the inverse of an audited change: it deletes an
+// inserted row, puts back a deleted one, or restores an updated row to
+// its image before the update. The row must be as the change left it,
+// otherwise ErrRowChanged is returned.
+func (db *DB) UndoChange(ctx context.Context, entry models.AuditEntry) error {
+	if db.readonly {
+		return fmt.Errorf("database is in read-only mode")
+	}
+	if err := db.notInSession(ctx, "Undo"); err != nil {
+		return err
+	}
+	if err := db.requireEditable(ctx, entry.Table); err != nil {
+		return err
+	}
+
+	return db.inTransaction(ctx, func(q querier) error {
+		shape, err := readAuditShape(ctx, q, entry.Table)
+		if err != nil {
+			return err
+		}
+		if shape == nil {
+			return inputErrorf("table not found: %s", entry.Table)
+		}
+		key := models.RowKey{}
+		for _, col := range shape.keyColumns {
+			val, ok := entry.Key[col]
+			if !ok {
+				return ErrRowChanged
+			}
+			key[col] = auditValue(val)
+		}
+
+		now, err := shape.selectImage(ctx, q, entry.Table, key)
+		if err != nil {
+			return err
+		}
+		if !sameImage(now, entry.After) {
+			return ErrRowChanged
+		}
+		where, keyArgs, err := keyWhereClause(shape.keyColumns, key)
+		if err != nil {
+			return err
+		}
+
+		var query string
+		var args []interface{}
+		switch entry.Operation {
+		case models.AuditInsert:
+			query = fmt.Sprintf("DELETE FROM %s WHERE %s", quoteIdent(entry.Table), where)
+			args = keyArgs
+		case models.AuditDelete:
+			var columns, placeholders []string
+			for col, val := range entry.Before {
+				columns = append(columns, quoteIdent(col))
+				placeholders = append(placeholders, "?")
+				args = append(args, auditValue(val))
+			}
+			query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(entry.Table), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+		case models.AuditUpdate:
+			var setClauses []string
+			for col, val := range entry.Before {
+				setClauses = append(setClauses, fmt.Sprintf("%s = ?", quoteIdent(col)))
+				args = append(args, auditValue(val))
+			}
+			query = fmt.Sprintf("UPDATE %s SET %s WHERE %s", quoteIdent(entry.Table), strings.Join(setClauses, ", "), where)
+			args = append(args, keyArgs...)
+		default:
+			return inputErrorf("unknown operation %q", entry.Operation)
+		}
+
+		_, err = q.ExecContext(ctx, query, args...)
+		return err
+	})
+}
+
+// auditValue converts a value read back from the audit log for binding:
+// numbers decoded as json.Number become integers where they are whole,
+// and BLOBs become bytes again.
+func auditValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case models.AuditBlob:
+		if b, err := base64.StdEncoding.DecodeString(v.Base64); err == nil {
+			return b
+		}
+	case map[string]interface{}:
+		encoded, _ := v["base64"].(string)
+		if v["type"] != models.CellBlob {
+			break
+		}
+		if b, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			return b
+		}
+	}
+	return val
+}
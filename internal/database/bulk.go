@@ -0,0 +1,192 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// bulkSampleRows is how many of the selected rows a preview includes.
+const bulkSampleRows = 10
+
+// DeleteRows deletes the rows req selects in one transaction and reports
+// how many it deleted. With preview set nothing is written: the selected
+// rows are counted, and the first of them returned as a sample.
+func (db *DB) DeleteRows(ctx context.Context, tableName string, req models.BulkRowRequest, preview bool) (*models.BulkRowResponse, error) {
+	if len(req.Values) > 0 {
+		return nil, inputErrorf("values cannot be given for a delete")
+	}
+	return db.bulkWrite(ctx, tableName, req, preview, fmt.Sprintf("DELETE FROM %s", quoteIdent(tableName)), nil)
+}
+
+// UpdateRows sets req.Values on the rows req selects in one transaction
+// and reports how many it updated, previewing like DeleteRows.
+func (db *DB) UpdateRows(ctx context.Context, tableName string, req models.BulkRowRequest, preview bool) (*models.BulkRowResponse, error) {
+	if len(req.Values) == 0 {
+		return nil, inputErrorf("no values to update")
+	}
+
+	assignments, err := db.coerceValues(ctx, tableName, req.Values, false)
+	if err != nil {
+		return nil, err
+	}
+	set, setArgs := setClause(assignments)
+	query := fmt.Sprintf("UPDATE %s SET %s", quoteIdent(tableName), set)
+	return db.bulkWrite(ctx, tableName, req, preview, query, setArgs)
+}
+
+// bulkWrite runs statement, a DELETE or UPDATE without its WHERE clause,
+// on the rows req selects: once per key, or once with the filter as its
+// WHERE clause. args are the statement's own arguments. A preview reads
+// the selected rows with the same WHERE clause instead.
+func (db *DB) bulkWrite(ctx context.Context, tableName string, req models.BulkRowRequest, preview bool, statement string, args []interface{}) (*models.BulkRowResponse, error) {
+	if db.readonly {
+		return nil, fmt.Errorf("database is in read-only mode")
+	}
+	if err := db.requireEditable(ctx, tableName); err != nil {
+		return nil, err
+	}
+
+	hasFilter := req.Filter != nil && (len(req.Filter.Filters) > 0 || len(req.Filter.Groups) > 0)
+	switch {
+	case len(req.Keys) > 0 && (hasFilter || req.All):
+		return nil, inputErrorf("select rows by keys or by a filter, not both")
+	case len(req.Keys) == 0 && !hasFilter && !req.All:
+		return nil, inputErrorf("no rows selected; give keys, a filter, or all to change every row")
+	}
+
+	// Read what the statements need before the transaction takes the
+	// write lock.
+	var (
+		keyColumns []string
+		where      string
+		whereArgs  []interface{}
+		err        error
+	)
+	if len(req.Keys) > 0 {
+		if keyColumns, err = db.GetRowKeyColumns(ctx, tableName); err != nil {
+			return nil, err
+		}
+		// Every key has the same columns, so one WHERE clause serves
+		// them all.
+		if where, _, err = keyWhereClause(keyColumns, req.Keys[0]); err != nil {
+			return nil, err
+		}
+	} else {
+		schema, err := db.getColumns(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+		if where, whereArgs, err = compileFilter(req.Filter, schema); err != nil {
+			return nil, err
+		}
+	}
+	if where != "" {
+		where = " WHERE " + where
+	}
+
+	if preview {
+		return db.previewRows(ctx, tableName, keyColumns, req.Keys, where, whereArgs)
+	}
+
+	query := statement + where
+
+	var affected int64
+	write := func(q querier) error {
+		if len(req.Keys) == 0 {
+			result, err := q.ExecContext(ctx, query, append(args, whereArgs...)...)
+			if err != nil {
+				return err
+			}
+			affected, err = result.RowsAffected()
+			return err
+		}
+
+		stmt, err := q.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, key := range req.Keys {
+			_, keyArgs, err := keyWhereClause(keyColumns, key)
+			if err != nil {
+				return err
+			}
+			result, err := stmt.ExecContext(ctx, append(args[:len(args):len(args)], keyArgs...)...)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			affected += n
+		}
+		return nil
+	}
+
+	if err := db.inTransaction(ctx, write); err != nil {
+		return nil, err
+	}
+	return &models.BulkRowResponse{RowsAffected: affected, Applied: true}, nil
+}
+
+// previewRows counts the rows a bulk operation selects, with where as its
+// WHERE clause, and reads the first of them as a sample. With keys, where
+// selects one row and is run once per key.
+func (db *DB) previewRows(ctx context.Context, tableName string, keyColumns []string, keys []models.RowKey, where string, whereArgs []interface{}) (*models.BulkRowResponse, error) {
+	query := fmt.Sprintf("SELECT * FROM %s%s", quoteIdent(tableName), where)
+
+	var (
+		count  int64
+		sample *models.TableData
+	)
+	if len(keys) == 0 {
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteIdent(tableName), where)
+		if err := db.q(ctx).QueryRowContext(ctx, countQuery, whereArgs...).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count rows: %w", err)
+		}
+		rows, err := db.q(ctx).QueryContext(ctx, query+" LIMIT ?", append(whereArgs, bulkSampleRows)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rows: %w", err)
+		}
+		defer rows.Close()
+		if sample, err = scanTableData(rows); err != nil {
+			return nil, err
+		}
+	} else {
+		stmt, err := db.q(ctx).PrepareContext(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rows: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, key := range keys {
+			_, keyArgs, err := keyWhereClause(keyColumns, key)
+			if err != nil {
+				return nil, err
+			}
+			rows, err := stmt.QueryContext(ctx, keyArgs...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read rows: %w", err)
+			}
+			data, err := scanTableData(rows)
+			rows.Close()
+			if err != nil {
+				return nil, err
+			}
+			count += int64(len(data.Rows))
+			if sample == nil {
+				sample = data
+			} else if len(sample.Rows) < bulkSampleRows {
+				sample.Rows = append(sample.Rows, data.Rows...)
+			}
+		}
+	}
+
+	sample.Total = int(count)
+	sample.Limit = bulkSampleRows
+	sample.Truncated = count > int64(len(sample.Rows))
+	return &models.BulkRowResponse{RowsAffected: count, Sample: sample}, nil
+}
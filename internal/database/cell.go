@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// blobPreviewBytes is how many leading bytes of a BLOB are shown in hex.
+const blobPreviewBytes = 16
+
+// newCell tags a scanned value with its storage class for a response.
+// The driver turns TEXT in DATE, DATETIME and TIMESTAMP columns into
+// times, which are sent as RFC 3339 text.
+func newCell(v interface{}) models.Cell {
+	switch v := v.(type) {
+	case nil:
+		return models.Cell{Type: models.CellNull}
+	case int64:
+		if v > models.MaxSafeInteger || v < -models.MaxSafeInteger {
+			return models.Cell{Type: models.CellInteger, Value: strconv.FormatInt(v, 10)}
+		}
+		return models.Cell{Type: models.CellInteger, Value: v}
+	case float64:
+		switch {
+		case math.IsInf(v, 1):
+			return models.Cell{Type: models.CellReal, Value: "Infinity"}
+		case math.IsInf(v, -1):
+			return models.Cell{Type: models.CellReal, Value: "-Infinity"}
+		case math.IsNaN(v):
+			return models.Cell{Type: models.CellReal, Value: "NaN"}
+		}
+		return models.Cell{Type: models.CellReal, Value: v}
+	case string:
+		return models.Cell{Type: models.CellText, Value: v}
+	case time.Time:
+		return models.Cell{Type: models.CellText, Value: v.Format(time.RFC3339Nano)}
+	case []byte:
+		preview := v
+		if len(preview) > blobPreviewBytes {
+			preview = preview[:blobPreviewBytes]
+		}
+		return models.Cell{Type: models.CellBlob, Value: models.Blob{
+			Size:        len(v),
+			Hex:         hex.EncodeToString(preview),
+			ContentType: http.DetectContentType(v),
+		}}
+	default:
+		return models.Cell{Type: models.CellText, Value: fmt.Sprint(v)}
+	}
+}
+
+func newCells(values []interface{}) []models.Cell {
+	cells := make([]models.Cell, len(values))
+	for i, v := range values {
+		cells[i] = newCell(v)
+	}
+	return cells
+}
+
+// GetCell returns the bytes of column in the row of tableName identified
+// by key. Only BLOB and TEXT values have bytes to return.
+func (db *DB) GetCell(ctx context.Context, tableName string, key models.RowKey, column string) ([]byte, error) {
+	columns, err := db.getColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, col := range columns {
+		if strings.EqualFold(col.Name, column) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, inputErrorf("unknown column %q", column)
+	}
+
+	keyColumns, err := db.GetRowKeyColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := keyWhereClause(keyColumns, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", quoteIdent(column), quoteIdent(tableName), where)
+	if err := db.q(ctx).QueryRowContext(ctx, query, args...).Scan(&value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRowNotFound
+		}
+		return nil, fmt.Errorf("failed to read cell: %w", err)
+	}
+
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case nil:
+		return nil, inputErrorf("%s is NULL in this row", column)
+	default:
+		return nil, inputErrorf("%s holds a number in this row, not a BLOB or TEXT", column)
+	}
+}
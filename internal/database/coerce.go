@@ -0,0 +1,327 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// Column affinities, as SQLite derives them from declared types. STRICT
+// tables' ANY columns keep values as given, like BLOB affinity.
+const (
+	affinityInteger = "INTEGER"
+	affinityReal    = "REAL"
+	affinityNumeric = "NUMERIC"
+	affinityText    = "TEXT"
+	affinityBlob    = "BLOB"
+)
+
+// columnAffinity applies SQLite's rules for the affinity of a declared
+// column type, in order: INT, then CHAR, CLOB or TEXT, then BLOB or no
+// type, then REAL, FLOA or DOUB, and NUMERIC for anything else.
+func columnAffinity(declared string, strict bool) string {
+	t := strings.ToUpper(declared)
+	switch {
+	case strict && t == "ANY":
+		return affinityBlob
+	case strings.Contains(t, "INT"):
+		return affinityInteger
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return affinityText
+	case t == "", strings.Contains(t, "BLOB"):
+		return affinityBlob
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return affinityReal
+	}
+	return affinityNumeric
+}
+
+// useDefault marks a column to be set to its default value.
+type useDefault struct{}
+
+// assignment is a column to write and either the value to bind for it or,
+// for a column set to its default, the default's SQL expression.
+type assignment struct {
+	column string
+	expr   string
+	value  interface{}
+}
+
+// coerceValues checks values against the columns of tableName and
+// converts each to what the column's affinity calls for, so a value that
+// cannot be stored as intended is refused before any SQL runs. A nil
+// value is NULL. A value may also be a typed cell, {"type": "integer",
+// "value": "9007199254740993"}, which is stored in that class whatever
+// the affinity, or {"type": "default"} for the column's default.
+//
+// For an insert, columns set to their default are left out, and NOT NULL
+// columns without a default must be given. The assignments follow the
+// table's column order.
+func (db *DB) coerceValues(ctx context.Context, tableName string, values map[string]interface{}, insert bool) ([]assignment, error) {
+	info, err := db.getObjectInfo(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := db.getColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	pkCount := 0
+	for i, col := range columns {
+		index[strings.ToLower(col.Name)] = i
+		if col.PrimaryKey {
+			pkCount++
+		}
+	}
+	// An INTEGER PRIMARY KEY is the rowid, which SQLite assigns when it
+	// is NULL.
+	isRowid := func(col models.Column) bool {
+		return col.PrimaryKey && pkCount == 1 && !info.withoutRowid && strings.EqualFold(col.Type, "INTEGER")
+	}
+
+	given := map[int]bool{}
+	var assignments []assignment
+	for name, raw := range values {
+		i, ok := index[strings.ToLower(name)]
+		if !ok {
+			return nil, inputErrorf("unknown column %q", name)
+		}
+		if given[i] {
+			return nil, inputErrorf("column %q is given more than once", columns[i].Name)
+		}
+		given[i] = true
+		col := columns[i]
+
+		value, err := coerceValue(raw, columnAffinity(col.Type, info.strict))
+		if err != nil {
+			return nil, inputErrorf("%s: %v", col.Name, err)
+		}
+
+		if _, ok := value.(useDefault); ok {
+			if insert {
+				continue
+			}
+			if col.DefaultValue == nil && col.NotNull {
+				return nil, inputErrorf("%s has no default and cannot be NULL", col.Name)
+			}
+			expr := "NULL"
+			if col.DefaultValue != nil {
+				expr = "(" + *col.DefaultValue + ")"
+			}
+			assignments = append(assignments, assignment{column: col.Name, expr: expr})
+			continue
+		}
+		if value == nil && col.NotNull && !(insert && isRowid(col)) {
+			return nil, inputErrorf("%s cannot be NULL", col.Name)
+		}
+		assignments = append(assignments, assignment{column: col.Name, expr: "?", value: value})
+	}
+
+	if insert {
+		for i, col := range columns {
+			if !given[i] && col.NotNull && col.DefaultValue == nil && !isRowid(col) {
+				return nil, inputErrorf("%s is required", col.Name)
+			}
+		}
+	}
+
+	sort.Slice(assignments, func(a, b int) bool {
+		return index[strings.ToLower(assignments[a].column)] < index[strings.ToLower(assignments[b].column)]
+	})
+	return assignments, nil
+}
+
+// coerceValue converts a value from a request for a column of the given
+// affinity: numbers and numeric text become integers or reals where the
+// affinity asks for them, and numbers become text for TEXT columns.
+// Booleans are 1 and 0, as SQLite stores them. BLOBs pass unchanged.
+func coerceValue(v interface{}, affinity string) (interface{}, error) {
+	switch x := v.(type) {
+	case nil, []byte:
+		return v, nil
+	case map[string]interface{}:
+		return typedValue(x)
+	case bool:
+		if x {
+			v = int64(1)
+		} else {
+			v = int64(0)
+		}
+	case int:
+		v = int64(x)
+	case int64, float64, string, json.Number:
+	default:
+		return nil, inputErrorf("unsupported value %v", v)
+	}
+
+	switch affinity {
+	case affinityInteger:
+		return toInteger(v)
+	case affinityReal:
+		return toReal(v)
+	case affinityText:
+		return toText(v), nil
+	case affinityNumeric:
+		if n, err := toInteger(v); err == nil {
+			return n, nil
+		}
+		if f, err := toReal(v); err == nil {
+			return f, nil
+		}
+		// Text that is not a number stays text, as SQLite itself does.
+		return v, nil
+	}
+	return plainValue(v), nil
+}
+
+// typedValue converts a typed cell, whose class overrides the column's
+// affinity.
+func typedValue(cell map[string]interface{}) (interface{}, error) {
+	typ, _ := cell["type"].(string)
+	value, hasValue := cell["value"]
+	switch typ {
+	case models.CellNull:
+		return nil, nil
+	case "default":
+		return useDefault{}, nil
+	case models.CellBlob:
+		return nil, inputErrorf("BLOB values are set by uploading them to the cell endpoint")
+	case models.CellInteger, models.CellReal, models.CellText:
+	default:
+		return nil, inputErrorf("unknown value type %q", typ)
+	}
+
+	switch value.(type) {
+	case string, json.Number, int, int64, float64:
+	default:
+		if !hasValue {
+			return nil, inputErrorf("%s value is missing", typ)
+		}
+		return nil, inputErrorf("%s value must be a number or a string", typ)
+	}
+	if x, ok := value.(int); ok {
+		value = int64(x)
+	}
+	switch typ {
+	case models.CellInteger:
+		return toInteger(value)
+	case models.CellReal:
+		return toReal(value)
+	}
+	return toText(value), nil
+}
+
+// toInteger converts a number, or text spelling one, to an integer. Reals
+// are accepted only when they are whole and in range.
+func toInteger(v interface{}) (int64, error) {
+	var s string
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case float64:
+		return wholeInteger(x, strconv.FormatFloat(x, 'g', -1, 64))
+	case json.Number:
+		s = string(x)
+	case string:
+		s = strings.TrimSpace(x)
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, inputErrorf("%q is not an integer", s)
+	}
+	return wholeInteger(f, s)
+}
+
+func wholeInteger(f float64, text string) (int64, error) {
+	// 2^63 itself is out of range, and is the first float64 that is.
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, inputErrorf("%s is not an integer", text)
+	}
+	return int64(f), nil
+}
+
+// toReal converts a number, or text spelling one, to a real. "Infinity"
+// and "-Infinity" are accepted as table data sends them.
+func toReal(v interface{}) (float64, error) {
+	var s string
+	switch x := v.(type) {
+	case int64:
+		return float64(x), nil
+	case float64:
+		return x, nil
+	case json.Number:
+		s = string(x)
+	case string:
+		s = strings.TrimSpace(x)
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, inputErrorf("%q is not a number", s)
+	}
+	return f, nil
+}
+
+func toText(v interface{}) string {
+	switch x := v.(type) {
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case json.Number:
+		return string(x)
+	case string:
+		return x
+	}
+	return ""
+}
+
+// plainValue turns a json.Number from a request into the integer or real
+// it spells, for binding where no column affinity applies. Other values
+// are returned unchanged.
+func plainValue(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return string(n)
+}
+
+// setClause renders assignments as the SET clause of an UPDATE, with the
+// values to bind for it.
+func setClause(assignments []assignment) (string, []interface{}) {
+	var (
+		clauses []string
+		args    []interface{}
+	)
+	for _, a := range assignments {
+		clauses = append(clauses, quoteIdent(a.column)+" = "+a.expr)
+		if a.expr == "?" {
+			args = append(args, a.value)
+		}
+	}
+	return strings.Join(clauses, ", "), args
+}
+
+func plainValues(values []interface{}) []interface{} {
+	plain := make([]interface{}, len(values))
+	for i, v := range values {
+		plain[i] = plainValue(v)
+	}
+	return plain
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
@@ -11,6 +12,15 @@ type DB struct {
 	conn     *sql.DB
 	path     string
 	readonly bool
+	// queryTimeout limits how long a script run by ExecuteScript, or a
+	// query run by ExportQuery, may take; zero means no limit.
+	queryTimeout time.Duration
+	// maxQueryRows caps the rows of each result ExecuteScript returns;
+	// zero means no limit.
+	maxQueryRows int
+	// recorder receives the rows each write changes; nil means changes
+	// are not captured.
+	recorder ChangeRecorder
 }
 
 func New(dbPath string, readonly bool) (*DB, error) {
@@ -46,3 +56,20 @@ func (db *DB) GetConnection() *sql.DB {
 func (db *DB) IsReadOnly() bool {
 	return db.readonly
 }
+
+func (db *DB) GetPath() string {
+	return db.path
+}
+
+// SetQueryTimeout limits how long each script run by ExecuteScript, and
+// each query run by ExportQuery, may take. Zero, the default, means no
+// limit.
+func (db *DB) SetQueryTimeout(timeout time.Duration) {
+	db.queryTimeout = timeout
+}
+
+// SetMaxQueryRows caps how many rows of each result ExecuteScript
+// returns at once. Zero, the default, means no limit.
+func (db *DB) SetMaxQueryRows(n int) {
+	db.maxQueryRows = n
+}
@@ -1,9 +1,18 @@
 package database
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
 )
 
 func setupTestDB(t *testing.T, readonly bool) (*DB, string) {
@@ -86,7 +95,7 @@ func TestInsertRow_ReadOnly(t *testing.T) {
 		"email": "charlie@example.com",
 	}
 	
-	err := db.InsertRow("users", values)
+	_, err := db.InsertRow(t.Context(), "users", values)
 	if err == nil {
 		t.Error("Expected error when inserting in read-only mode")
 	}
@@ -106,13 +115,13 @@ func TestInsertRow_Writable(t *testing.T) {
 		"email": "charlie@example.com",
 	}
 	
-	err := db.InsertRow("users", values)
+	_, err := db.InsertRow(t.Context(), "users", values)
 	if err != nil {
 		t.Errorf("Expected no error when inserting in writable mode, got: %v", err)
 	}
 	
 	// Verify the row was inserted
-	data, err := db.GetTableData("users", 1, 50)
+	data, err := db.GetTableData(t.Context(), "users", 1, 50)
 	if err != nil {
 		t.Fatalf("Failed to get table data: %v", err)
 	}
@@ -131,7 +140,7 @@ func TestUpdateRow_ReadOnly(t *testing.T) {
 		"name": "Alice Updated",
 	}
 	
-	err := db.UpdateRow("users", "id", 1, values)
+	_, err := db.UpdateRow(t.Context(), "users", models.RowKey{"id": 1}, values)
 	if err == nil {
 		t.Error("Expected error when updating in read-only mode")
 	}
@@ -150,19 +159,19 @@ func TestUpdateRow_Writable(t *testing.T) {
 		"name": "Alice Updated",
 	}
 	
-	err := db.UpdateRow("users", "id", 1, values)
+	_, err := db.UpdateRow(t.Context(), "users", models.RowKey{"id": 1}, values)
 	if err != nil {
 		t.Errorf("Expected no error when updating in writable mode, got: %v", err)
 	}
 	
 	// Verify the row was updated
-	data, err := db.GetTableData("users", 1, 50)
+	data, err := db.GetTableData(t.Context(), "users", 1, 50)
 	if err != nil {
 		t.Fatalf("Failed to get table data: %v", err)
 	}
 	
 	if len(data.Rows) > 0 {
-		name := data.Rows[0][1].(string)
+		name := data.Rows[0][1].Value.(string)
 		if name != "Alice Updated" {
 			t.Errorf("Expected name 'Alice Updated', got '%s'", name)
 		}
@@ -174,7 +183,7 @@ func TestDeleteRow_ReadOnly(t *testing.T) {
 	defer db.Close()
 	defer os.Remove(dbPath)
 	
-	err := db.DeleteRow("users", "id", 1)
+	err := db.DeleteRow(t.Context(), "users", models.RowKey{"id": 1})
 	if err == nil {
 		t.Error("Expected error when deleting in read-only mode")
 	}
@@ -189,13 +198,13 @@ func TestDeleteRow_Writable(t *testing.T) {
 	defer db.Close()
 	defer os.Remove(dbPath)
 	
-	err := db.DeleteRow("users", "id", 1)
+	err := db.DeleteRow(t.Context(), "users", models.RowKey{"id": 1})
 	if err != nil {
 		t.Errorf("Expected no error when deleting in writable mode, got: %v", err)
 	}
 	
 	// Verify the row was deleted
-	data, err := db.GetTableData("users", 1, 50)
+	data, err := db.GetTableData(t.Context(), "users", 1, 50)
 	if err != nil {
 		t.Fatalf("Failed to get table data: %v", err)
 	}
@@ -205,12 +214,31 @@ func TestDeleteRow_Writable(t *testing.T) {
 	}
 }
 
+func TestInsertRow_QuotedTableName(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	if _, err := db.conn.Exec("CREATE TABLE `odd``name` (id INTEGER PRIMARY KEY, label TEXT NOT NULL)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	columns, err := db.GetTableSchema(t.Context(), "odd`name")
+	if err != nil || len(columns) != 2 || !columns[1].NotNull {
+		t.Fatalf("Expected the schema of a table with a backtick in its name, got %+v, %v", columns, err)
+	}
+	row, err := db.InsertRow(t.Context(), "odd`name", map[string]interface{}{"label": "x"})
+	if err != nil || row.Key["id"] != int64(1) {
+		t.Errorf("Expected the row inserted, got %+v, %v", row, err)
+	}
+}
+
 func TestGetTables_ReadOnly(t *testing.T) {
 	db, dbPath := setupTestDB(t, true)
 	defer db.Close()
 	defer os.Remove(dbPath)
 	
-	tables, err := db.GetTables()
+	tables, err := db.GetTables(t.Context(), false)
 	if err != nil {
 		t.Errorf("Expected no error when getting tables in read-only mode, got: %v", err)
 	}
@@ -225,7 +253,7 @@ func TestGetTableData_ReadOnly(t *testing.T) {
 	defer db.Close()
 	defer os.Remove(dbPath)
 	
-	data, err := db.GetTableData("users", 1, 50)
+	data, err := db.GetTableData(t.Context(), "users", 1, 50)
 	if err != nil {
 		t.Errorf("Expected no error when reading data in read-only mode, got: %v", err)
 	}
@@ -240,7 +268,7 @@ func TestExecuteQuery_ReadOnly(t *testing.T) {
 	defer db.Close()
 	defer os.Remove(dbPath)
 	
-	data, err := db.ExecuteQuery("SELECT * FROM users WHERE name = 'Alice'")
+	data, err := db.ExecuteQuery(t.Context(), "SELECT * FROM users WHERE name = 'Alice'")
 	if err != nil {
 		t.Errorf("Expected no error when executing SELECT in read-only mode, got: %v", err)
 	}
@@ -256,7 +284,7 @@ func TestExecuteQuery_WriteInReadOnly(t *testing.T) {
 	defer os.Remove(dbPath)
 	
 	// Attempt UPDATE in readonly mode - should fail at SQLite level
-	_, err := db.ExecuteQuery("UPDATE users SET name = 'Hacked' WHERE id = 1")
+	_, err := db.ExecuteQuery(t.Context(), "UPDATE users SET name = 'Hacked' WHERE id = 1")
 	if err == nil {
 		t.Error("Expected error when executing UPDATE in read-only mode")
 	}
@@ -272,21 +300,1878 @@ func TestExecuteQuery_WriteInWritable(t *testing.T) {
 	defer os.Remove(dbPath)
 	
 	// Execute UPDATE in writable mode - should succeed
-	_, err := db.ExecuteQuery("UPDATE users SET name = 'Alice Updated' WHERE id = 1")
+	_, err := db.ExecuteQuery(t.Context(), "UPDATE users SET name = 'Alice Updated' WHERE id = 1")
 	if err != nil {
 		t.Errorf("Expected no error when executing UPDATE in writable mode, got: %v", err)
 	}
 	
 	// Verify the update worked
-	data, err := db.ExecuteQuery("SELECT name FROM users WHERE id = 1")
+	data, err := db.ExecuteQuery(t.Context(), "SELECT name FROM users WHERE id = 1")
 	if err != nil {
 		t.Fatalf("Failed to query after update: %v", err)
 	}
 	
 	if len(data.Rows) > 0 {
-		name := data.Rows[0][0].(string)
+		name := data.Rows[0][0].Value.(string)
 		if name != "Alice Updated" {
 			t.Errorf("Expected name 'Alice Updated', got '%s'", name)
 		}
 	}
 }
+
+
+func TestUpdateRow_CompositeKey(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE memberships (
+			user_id INTEGER,
+			group_id INTEGER,
+			role TEXT,
+			PRIMARY KEY (group_id, user_id)
+		);
+		INSERT INTO memberships VALUES (1, 10, 'member'), (1, 20, 'member'), (2, 10, 'member');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	keyColumns, err := db.GetRowKeyColumns(t.Context(), "memberships")
+	if err != nil {
+		t.Fatalf("Failed to get key columns: %v", err)
+	}
+	if strings.Join(keyColumns, ",") != "group_id,user_id" {
+		t.Errorf("Expected key columns group_id,user_id, got %v", keyColumns)
+	}
+
+	_, err = db.UpdateRow(t.Context(), "memberships", models.RowKey{"user_id": 1, "group_id": 20}, map[string]interface{}{"role": "admin"})
+	if err != nil {
+		t.Fatalf("Expected no error updating by composite key, got: %v", err)
+	}
+
+	var admins int
+	db.conn.QueryRow("SELECT COUNT(*) FROM memberships WHERE role = 'admin'").Scan(&admins)
+	if admins != 1 {
+		t.Errorf("Expected exactly 1 updated row, got %d", admins)
+	}
+
+	err = db.DeleteRow(t.Context(), "memberships", models.RowKey{"user_id": 1})
+	if err == nil {
+		t.Error("Expected error when deleting with a partial key")
+	}
+}
+
+func TestGetTableData_RowidKeys(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE notes (body TEXT);
+		INSERT INTO notes VALUES ('first'), ('second');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	data, err := db.GetTableData(t.Context(), "notes", 1, 50)
+	if err != nil {
+		t.Fatalf("Failed to get table data: %v", err)
+	}
+
+	if len(data.Columns) != 1 || data.Columns[0] != "body" {
+		t.Errorf("Expected only the body column, got %v", data.Columns)
+	}
+	if len(data.KeyColumns) != 1 || data.KeyColumns[0] != "rowid" {
+		t.Fatalf("Expected rowid key column, got %v", data.KeyColumns)
+	}
+
+	if err := db.DeleteRow(t.Context(), "notes", data.Keys[0]); err != nil {
+		t.Fatalf("Expected no error deleting by rowid, got: %v", err)
+	}
+
+	if err := db.DeleteRow(t.Context(), "notes", data.Keys[0]); err != ErrRowNotFound {
+		t.Errorf("Expected ErrRowNotFound deleting twice, got: %v", err)
+	}
+}
+
+func TestGetRowKeyColumns_WithoutRowid(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`CREATE TABLE kv (k TEXT, ns TEXT, v TEXT, PRIMARY KEY (ns, k)) WITHOUT ROWID`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	keyColumns, err := db.GetRowKeyColumns(t.Context(), "kv")
+	if err != nil {
+		t.Fatalf("Failed to get key columns: %v", err)
+	}
+	if strings.Join(keyColumns, ",") != "ns,k" {
+		t.Errorf("Expected key columns ns,k, got %v", keyColumns)
+	}
+}
+
+func TestQueryTableData_Filter(t *testing.T) {
+	db, dbPath := setupTestDB(t, true)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	tests := []struct {
+		name   string
+		filter *models.FilterGroup
+		want   int
+	}{
+		{"equals", &models.FilterGroup{Filters: []models.Filter{{Column: "name", Operator: "=", Value: "Alice"}}}, 1},
+		{"like", &models.FilterGroup{Filters: []models.Filter{{Column: "email", Operator: "LIKE", Value: "%@example.com"}}}, 2},
+		{"in", &models.FilterGroup{Filters: []models.Filter{{Column: "id", Operator: "IN", Values: []interface{}{1, 2, 3}}}}, 2},
+		{"between", &models.FilterGroup{Filters: []models.Filter{{Column: "id", Operator: "BETWEEN", Values: []interface{}{2, 5}}}}, 1},
+		{"is null", &models.FilterGroup{Filters: []models.Filter{{Column: "email", Operator: "IS NULL"}}}, 0},
+		{"any", &models.FilterGroup{Match: "any", Filters: []models.Filter{
+			{Column: "name", Operator: "=", Value: "Alice"},
+			{Column: "name", Operator: "=", Value: "Bob"},
+		}}, 2},
+		{"nested", &models.FilterGroup{
+			Filters: []models.Filter{{Column: "id", Operator: ">", Value: 0}},
+			Groups: []models.FilterGroup{{Match: "any", Filters: []models.Filter{
+				{Column: "name", Operator: "!=", Value: "Alice"},
+			}}},
+		}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := db.QueryTableData(t.Context(), "users", models.TableDataRequest{Page: 1, Limit: 50, Filter: tt.filter})
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if data.Total != tt.want || len(data.Rows) != tt.want {
+				t.Errorf("Expected %d rows, got total %d and %d rows", tt.want, data.Total, len(data.Rows))
+			}
+		})
+	}
+}
+
+func TestQueryTableData_InvalidFilter(t *testing.T) {
+	db, dbPath := setupTestDB(t, true)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	filters := []models.Filter{
+		{Column: "password", Operator: "=", Value: "x"},
+		{Column: "name", Operator: "; DROP TABLE users", Value: "x"},
+		{Column: "name", Operator: "BETWEEN", Values: []interface{}{1}},
+		{Column: "name", Operator: "="},
+	}
+
+	for _, f := range filters {
+		_, err := db.QueryTableData(t.Context(), "users", models.TableDataRequest{Page: 1, Limit: 50, Filter: &models.FilterGroup{Filters: []models.Filter{f}}})
+		var inputErr *InputError
+		if !errors.As(err, &inputErr) {
+			t.Errorf("Expected InputError for %+v, got: %v", f, err)
+		}
+	}
+}
+
+func TestResolveOrder_Case(t *testing.T) {
+	columns := []models.Column{{Name: "id"}, {Name: "name"}}
+	sorts := []models.SortColumn{{Column: "name"}, {Column: "NAME", Desc: true}, {Column: "ID", Desc: true}}
+	order, err := resolveOrder(sorts, columns, []string{"id"})
+	if err != nil {
+		t.Fatalf("Failed to resolve order: %v", err)
+	}
+	if got := orderByClause(order); got != "`name`, `id` DESC" {
+		t.Errorf("Expected each column once under its declared name, got %s", got)
+	}
+}
+
+func TestQueryTableData_SortAndCursor(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE scores (player TEXT, points INTEGER);
+		INSERT INTO scores VALUES
+			('a', 10), ('b', NULL), ('c', 30), ('d', 10),
+			('e', NULL), ('f', 20), ('g', 30), ('h', 10);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	for _, desc := range []bool{false, true} {
+		sort := []models.SortColumn{{Column: "points", Desc: desc}}
+
+		all, err := db.QueryTableData(t.Context(), "scores", models.TableDataRequest{Page: 1, Limit: 100, Sort: sort})
+		if err != nil {
+			t.Fatalf("Failed to get sorted data: %v", err)
+		}
+
+		var paged [][]models.Cell
+		req := models.TableDataRequest{Page: 1, Limit: 3, Sort: sort}
+		for {
+			data, err := db.QueryTableData(t.Context(), "scores", req)
+			if err != nil {
+				t.Fatalf("Failed to get page: %v", err)
+			}
+			paged = append(paged, data.Rows...)
+			if data.NextCursor == "" {
+				break
+			}
+			req.Cursor = data.NextCursor
+		}
+
+		if len(paged) != len(all.Rows) {
+			t.Fatalf("desc=%v: expected %d rows across pages, got %d", desc, len(all.Rows), len(paged))
+		}
+		for i := range paged {
+			if paged[i][0] != all.Rows[i][0] {
+				t.Errorf("desc=%v: row %d: expected %v, got %v", desc, i, all.Rows[i][0], paged[i][0])
+			}
+		}
+	}
+
+	_, err = db.QueryTableData(t.Context(), "scores", models.TableDataRequest{Page: 1, Limit: 3, Sort: []models.SortColumn{{Column: "nope"}}})
+	var inputErr *InputError
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Expected InputError for unknown sort column, got: %v", err)
+	}
+
+	first, _ := db.QueryTableData(t.Context(), "scores", models.TableDataRequest{Page: 1, Limit: 3})
+	_, err = db.QueryTableData(t.Context(), "scores", models.TableDataRequest{Page: 1, Limit: 3, Sort: []models.SortColumn{{Column: "points"}}, Cursor: first.NextCursor})
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Expected InputError for cursor from another sort, got: %v", err)
+	}
+}
+
+func TestQueryTableData_CursorDatetime(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE events (id INTEGER PRIMARY KEY, at DATETIME);
+		INSERT INTO events (at) VALUES
+			('2024-01-03 09:00:00'), ('2024-01-01 12:00:00'), (NULL),
+			('2024-01-02 00:00:00'), ('2024-01-01 12:00:00'), ('2024-01-02 00:00:00');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	for _, desc := range []bool{false, true} {
+		sort := []models.SortColumn{{Column: "at", Desc: desc}}
+		all, err := db.QueryTableData(t.Context(), "events", models.TableDataRequest{Page: 1, Limit: 100, Sort: sort})
+		if err != nil {
+			t.Fatalf("Failed to get sorted data: %v", err)
+		}
+
+		var paged [][]models.Cell
+		req := models.TableDataRequest{Page: 1, Limit: 2, Sort: sort}
+		for {
+			data, err := db.QueryTableData(t.Context(), "events", req)
+			if err != nil {
+				t.Fatalf("Failed to get page: %v", err)
+			}
+			paged = append(paged, data.Rows...)
+			if data.NextCursor == "" {
+				break
+			}
+			req.Cursor = data.NextCursor
+		}
+
+		if len(paged) != len(all.Rows) {
+			t.Fatalf("desc=%v: expected %d rows across pages, got %d", desc, len(all.Rows), len(paged))
+		}
+		for i := range paged {
+			if paged[i][0] != all.Rows[i][0] {
+				t.Errorf("desc=%v: row %d: expected %v, got %v", desc, i, all.Rows[i][0], paged[i][0])
+			}
+		}
+	}
+}
+
+func TestGetTables_ObjectTypes(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE VIEW alice AS SELECT * FROM users WHERE name = 'Alice';
+		CREATE VIRTUAL TABLE docs USING fts5(body);
+		INSERT INTO docs VALUES ('hello world');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	tables, err := db.GetTables(t.Context(), false)
+	if err != nil {
+		t.Fatalf("Failed to get tables: %v", err)
+	}
+
+	types := map[string]string{}
+	for _, table := range tables {
+		types[table.Name] = table.Type
+	}
+	if types["alice"] != models.TableTypeView || types["docs"] != models.TableTypeVirtual || types["users"] != models.TableTypeTable {
+		t.Errorf("Unexpected object types: %v", types)
+	}
+	if _, ok := types["sqlite_sequence"]; ok {
+		t.Error("Expected internal tables to be hidden by default")
+	}
+	if _, ok := types["docs_data"]; ok {
+		t.Error("Expected shadow tables to be hidden by default")
+	}
+
+	tables, err = db.GetTables(t.Context(), true)
+	if err != nil {
+		t.Fatalf("Failed to get tables: %v", err)
+	}
+	types = map[string]string{}
+	for _, table := range tables {
+		types[table.Name] = table.Type
+	}
+	if types["sqlite_sequence"] != models.TableTypeInternal || types["docs_data"] != models.TableTypeShadow {
+		t.Errorf("Expected system tables when requested, got: %v", types)
+	}
+}
+
+func TestQueryTableData_View(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`CREATE VIEW alice AS SELECT * FROM users WHERE name = 'Alice'`)
+	if err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	data, err := db.QueryTableData(t.Context(), "alice", models.TableDataRequest{Page: 1, Limit: 50, Sort: []models.SortColumn{{Column: "name"}}})
+	if err != nil {
+		t.Fatalf("Expected view to be browsable, got: %v", err)
+	}
+	if data.Total != 1 || len(data.KeyColumns) != 0 {
+		t.Errorf("Expected 1 keyless row, got total %d with key columns %v", data.Total, data.KeyColumns)
+	}
+
+	_, err = db.InsertRow(t.Context(), "alice", map[string]interface{}{"name": "Carol"})
+	var inputErr *InputError
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Expected InputError when inserting into a view, got: %v", err)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE accounts (
+			id INTEGER,
+			org TEXT,
+			email TEXT UNIQUE,
+			deleted_at TEXT,
+			PRIMARY KEY (org, id)
+		)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	err = db.CreateIndex(t.Context(), "accounts", models.CreateIndexRequest{
+		Name:    "idx_live_email",
+		Columns: []models.IndexColumnSpec{{Name: "email"}, {Name: "id", Desc: true}},
+		Where:   "deleted_at IS NULL",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	indexes, err := db.GetIndexes(t.Context(), "accounts")
+	if err != nil {
+		t.Fatalf("Failed to get indexes: %v", err)
+	}
+
+	origins := map[string]int{}
+	for _, index := range indexes {
+		origins[index.Origin]++
+		if index.Name == "idx_live_email" {
+			if !index.Partial || index.Where != "deleted_at IS NULL" {
+				t.Errorf("Expected partial index with WHERE clause, got %+v", index)
+			}
+			if len(index.Columns) != 2 || index.Columns[0].Name != "email" || !index.Columns[1].Desc {
+				t.Errorf("Unexpected index columns: %+v", index.Columns)
+			}
+		}
+	}
+	if origins[models.IndexOriginUser] != 1 || origins[models.IndexOriginUnique] != 1 || origins[models.IndexOriginPrimaryKey] != 1 {
+		t.Errorf("Expected one index of each origin, got %v", origins)
+	}
+
+	var inputErr *InputError
+	for _, index := range indexes {
+		if index.Origin == models.IndexOriginPrimaryKey {
+			if err := db.DropIndex(t.Context(), "accounts", index.Name); !errors.As(err, &inputErr) {
+				t.Errorf("Expected InputError dropping a constraint index, got: %v", err)
+			}
+		}
+	}
+
+	err = db.CreateIndex(t.Context(), "accounts", models.CreateIndexRequest{
+		Name:    "idx_bad",
+		Columns: []models.IndexColumnSpec{{Name: "email"}},
+		Where:   "1; DROP TABLE accounts",
+	})
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Expected InputError for a multi-statement WHERE clause, got: %v", err)
+	}
+
+	if err := db.DropIndex(t.Context(), "accounts", "idx_live_email"); err != nil {
+		t.Errorf("Failed to drop index: %v", err)
+	}
+
+	// Column names match regardless of case, as in SQLite.
+	err = db.CreateIndex(t.Context(), "accounts", models.CreateIndexRequest{
+		Name:    "idx_org",
+		Columns: []models.IndexColumnSpec{{Name: "ORG"}},
+	})
+	if err != nil {
+		t.Errorf("Expected an index on a column named in another case, got: %v", err)
+	}
+}
+
+func TestIndexWhereClause(t *testing.T) {
+	tests := map[string]string{
+		"CREATE INDEX i ON t (a)":                                 "",
+		"CREATE INDEX i ON t (a) WHERE b > 0":                     "b > 0",
+		`CREATE INDEX "i (x" ON "t)" (a, lower(b)) where c = ')'`: "c = ')'",
+	}
+	for createSQL, want := range tests {
+		if got := indexWhereClause(createSQL); got != want {
+			t.Errorf("indexWhereClause(%q) = %q, want %q", createSQL, got, want)
+		}
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE orders (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER REFERENCES users ON DELETE CASCADE
+		);
+		CREATE TABLE shipments (
+			id INTEGER PRIMARY KEY,
+			order_id INTEGER,
+			Order_User INTEGER,
+			FOREIGN KEY (order_id, order_user) REFERENCES orders (id, user_id) ON UPDATE SET NULL
+		);
+		INSERT INTO orders VALUES (1, 1), (2, 1), (3, 2);
+		INSERT INTO shipments VALUES (1, 1, 1), (2, 3, 2);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	schema, err := db.GetTableSchema(t.Context(), "orders")
+	if err != nil {
+		t.Fatalf("Failed to get schema: %v", err)
+	}
+	refs := schema[1].References
+	if len(refs) != 1 || refs[0].Table != "users" || refs[0].Column != "id" || refs[0].OnDelete != "CASCADE" {
+		t.Errorf("Expected user_id to reference users.id ON DELETE CASCADE, got %+v", refs)
+	}
+
+	foreignKeys, err := db.GetForeignKeys(t.Context(), "shipments")
+	if err != nil {
+		t.Fatalf("Failed to get foreign keys: %v", err)
+	}
+	if len(foreignKeys) != 1 || strings.Join(foreignKeys[0].To, ",") != "id,user_id" || foreignKeys[0].OnUpdate != "SET NULL" {
+		t.Errorf("Expected composite foreign key to orders(id, user_id), got %+v", foreignKeys)
+	}
+
+	referencing, err := db.GetReferencingRows(t.Context(), "users", models.RowKey{"id": 1}, 10)
+	if err != nil {
+		t.Fatalf("Failed to get referencing rows: %v", err)
+	}
+	if len(referencing) != 1 || referencing[0].Table != "orders" || referencing[0].Data.Total != 2 {
+		t.Errorf("Expected 2 orders referencing user 1, got %+v", referencing)
+	}
+
+	referencing, err = db.GetReferencingRows(t.Context(), "orders", models.RowKey{"id": 3}, 10)
+	if err != nil {
+		t.Fatalf("Failed to get referencing rows: %v", err)
+	}
+	if len(referencing) != 1 || referencing[0].Table != "shipments" || referencing[0].Data.Total != 1 {
+		t.Errorf("Expected 1 shipment referencing order 3, got %+v", referencing)
+	}
+
+	// users has a one-column primary key, so this key has no target.
+	_, err = db.conn.Exec(`CREATE TABLE notes (user_id INTEGER, user_name TEXT, FOREIGN KEY (user_id, user_name) REFERENCES users)`)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	foreignKeys, err = db.GetForeignKeys(t.Context(), "notes")
+	if err != nil {
+		t.Fatalf("Failed to get foreign keys: %v", err)
+	}
+	if len(foreignKeys) != 1 || !foreignKeys[0].Unresolved || len(foreignKeys[0].To) != 0 {
+		t.Errorf("Expected an unresolved foreign key, got %+v", foreignKeys)
+	}
+	schema, err = db.GetTableSchema(t.Context(), "notes")
+	if err != nil {
+		t.Fatalf("Failed to get schema: %v", err)
+	}
+	if len(schema[0].References) != 0 {
+		t.Errorf("Expected no reference from an unresolved key, got %+v", schema[0].References)
+	}
+	referencing, err = db.GetReferencingRows(t.Context(), "users", models.RowKey{"id": 1}, 10)
+	if err != nil {
+		t.Fatalf("Failed to get referencing rows: %v", err)
+	}
+	if len(referencing) != 1 || referencing[0].Table != "orders" {
+		t.Errorf("Expected only orders referencing user 1, got %+v", referencing)
+	}
+	graph, err := db.GetSchemaGraph(t.Context())
+	if err != nil {
+		t.Fatalf("Failed to get schema graph: %v", err)
+	}
+	for _, edge := range graph.Edges {
+		if edge.FromTable == "notes" {
+			t.Errorf("Expected no edge for an unresolved key, got %+v", edge)
+		}
+	}
+}
+
+func TestCreateTable(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	def := models.TableDefinition{
+		Name: "posts",
+		Columns: []models.ColumnDefinition{
+			{Name: "id", Type: "INTEGER", PrimaryKey: true, AutoIncrement: true},
+			{Name: "user_id", Type: "INTEGER", NotNull: true},
+			{Name: "title", Type: "TEXT", Unique: true, Check: "length(title) > 0"},
+		},
+		ForeignKeys: []models.ForeignKeyDefinition{
+			{Columns: []string{"user_id"}, Table: "users", To: []string{"id"}, OnDelete: "cascade"},
+		},
+		Strict: true,
+	}
+
+	preview, err := db.PlanCreateTable(t.Context(), def)
+	if err != nil {
+		t.Fatalf("Failed to plan table: %v", err)
+	}
+	if len(preview) != 1 || !strings.Contains(preview[0], "ON DELETE CASCADE") || !strings.HasSuffix(preview[0], ") STRICT") {
+		t.Errorf("Unexpected CREATE TABLE: %v", preview)
+	}
+
+	if _, err := db.CreateTable(t.Context(), def); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	got, err := db.GetTableDefinition(t.Context(), "posts")
+	if err != nil {
+		t.Fatalf("Failed to get definition: %v", err)
+	}
+	if !got.Definition.Strict || !got.Definition.Columns[0].AutoIncrement || !got.Definition.Columns[2].Unique {
+		t.Errorf("Definition did not round-trip: %+v", got.Definition)
+	}
+	if len(got.Definition.ForeignKeys) != 1 || got.Definition.ForeignKeys[0].OnDelete != "CASCADE" {
+		t.Errorf("Expected foreign key to users, got %+v", got.Definition.ForeignKeys)
+	}
+
+	// The word in a default, a comment or a name is not AUTOINCREMENT.
+	_, err = db.conn.Exec(`CREATE TABLE counters (
+		id INTEGER PRIMARY KEY, -- no AUTOINCREMENT here
+		"autoincrement" TEXT DEFAULT 'AUTOINCREMENT'
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	got, err = db.GetTableDefinition(t.Context(), "counters")
+	if err != nil {
+		t.Fatalf("Failed to get definition: %v", err)
+	}
+	if got.Definition.Columns[0].AutoIncrement {
+		t.Errorf("Expected no AUTOINCREMENT, got %+v", got.Definition.Columns[0])
+	}
+
+	invalid := []models.TableDefinition{
+		{Name: "t"},
+		{Name: "t", Columns: []models.ColumnDefinition{{Name: "a", Type: "TEXT); DROP TABLE users; --"}}},
+		{Name: "t", Columns: []models.ColumnDefinition{{Name: "a", Type: "VARCHAR(10)"}}, Strict: true},
+		{Name: "t", Columns: []models.ColumnDefinition{{Name: "a", Type: "TEXT"}}, WithoutRowid: true},
+		{Name: "t", Columns: []models.ColumnDefinition{{Name: "a", Check: "1); DROP TABLE users; --"}}},
+		{Name: "sqlite_t", Columns: []models.ColumnDefinition{{Name: "a"}}},
+	}
+	for _, def := range invalid {
+		var inputErr *InputError
+		if _, err := db.CreateTable(t.Context(), def); !errors.As(err, &inputErr) {
+			t.Errorf("Expected input error for %+v, got %v", def, err)
+		}
+	}
+}
+
+func TestAlterTable(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`CREATE INDEX idx_users_email ON users (email)`)
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	steps := []models.AlterTableRequest{
+		{Action: models.AlterAddColumn, Column: &models.ColumnDefinition{Name: "age", Type: "INTEGER"}},
+		{Action: models.AlterRenameColumn, Name: "age", NewName: "years"},
+		{Action: models.AlterDropColumn, Name: "years"},
+	}
+	for _, step := range steps {
+		if _, err := db.AlterTable(t.Context(), "users", step); err != nil {
+			t.Fatalf("Failed to %s: %v", step.Action, err)
+		}
+	}
+
+	// Rebuild users with name made nullable and a new column.
+	def, err := db.GetTableDefinition(t.Context(), "users")
+	if err != nil {
+		t.Fatalf("Failed to get definition: %v", err)
+	}
+	def.Definition.Columns[1].NotNull = false
+	def.Definition.Columns = append(def.Definition.Columns, models.ColumnDefinition{Name: "active", Type: "INTEGER", Default: strPtr("1")})
+
+	rebuild := models.AlterTableRequest{Action: models.AlterRebuild, Definition: &def.Definition}
+	preview, err := db.PlanAlterTable(t.Context(), "users", rebuild)
+	if err != nil {
+		t.Fatalf("Failed to plan rebuild: %v", err)
+	}
+	if preview[0] != "PRAGMA foreign_keys = OFF" || !strings.Contains(strings.Join(preview, "\n"), "idx_users_email") {
+		t.Errorf("Unexpected rebuild script: %v", preview)
+	}
+
+	if _, err := db.AlterTable(t.Context(), "users", rebuild); err != nil {
+		t.Fatalf("Failed to rebuild: %v", err)
+	}
+
+	data, err := db.GetTableData(t.Context(), "users", 1, 10)
+	if err != nil {
+		t.Fatalf("Failed to get data: %v", err)
+	}
+	if data.Total != 2 || len(data.Columns) != 4 || data.Rows[0][3].Value != int64(1) {
+		t.Errorf("Expected both users with active = 1, got %+v", data)
+	}
+
+	indexes, err := db.GetIndexes(t.Context(), "users")
+	if err != nil {
+		t.Fatalf("Failed to get indexes: %v", err)
+	}
+	if len(indexes) != 1 || indexes[0].Name != "idx_users_email" {
+		t.Errorf("Expected index to survive rebuild, got %+v", indexes)
+	}
+
+	if _, err := db.AlterTable(t.Context(), "users", models.AlterTableRequest{Action: models.AlterRenameTable, NewName: "people"}); err != nil {
+		t.Fatalf("Failed to rename table: %v", err)
+	}
+	if _, err := db.GetTableDefinition(t.Context(), "people"); err != nil {
+		t.Errorf("Expected renamed table, got %v", err)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestImportCSV_NewTable(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	csvData := "id;price;code;note\n1;9.5;007;\"semi;colon\"\n2;10;012;\n"
+	result, err := db.ImportCSV(t.Context(), "products", strings.NewReader(csvData), models.CSVImportOptions{
+		Delimiter:   ";",
+		Header:      true,
+		Create:      true,
+		EmptyAsNull: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if !result.Created || result.Inserted != 2 {
+		t.Fatalf("Expected table created with 2 rows, got %+v", result)
+	}
+
+	types := make([]string, len(result.Columns))
+	for i, col := range result.Columns {
+		types[i] = col.Type
+	}
+	if got := strings.Join(types, ","); got != "INTEGER,REAL,TEXT,TEXT" {
+		t.Errorf("Expected inferred types INTEGER,REAL,TEXT,TEXT, got %s", got)
+	}
+
+	data, err := db.GetTableData(t.Context(), "products", 1, 10)
+	if err != nil {
+		t.Fatalf("Failed to get data: %v", err)
+	}
+	if data.Rows[0][2].Value != "007" || data.Rows[0][3].Value != "semi;colon" || data.Rows[1][3].Value != nil {
+		t.Errorf("Unexpected imported rows: %v", data.Rows)
+	}
+
+	// Windows-1252 encoded, without a header.
+	latin := []byte("1,caf\xe9 \x80\n")
+	result, err = db.ImportCSV(t.Context(), "prices", bytes.NewReader(latin), models.CSVImportOptions{
+		Encoding: "windows-1252",
+		Create:   true,
+		Mapping:  map[string]string{"2": "label"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	data, err = db.GetTableData(t.Context(), "prices", 1, 10)
+	if err != nil {
+		t.Fatalf("Failed to get data: %v", err)
+	}
+	if data.Columns[1] != "label" || data.Rows[0][1].Value != "café €" {
+		t.Errorf("Unexpected decoded rows: %v %v", data.Columns, data.Rows)
+	}
+
+	if _, err := db.ImportCSV(t.Context(), "users", strings.NewReader(csvData), models.CSVImportOptions{Header: true, Create: true}); err == nil {
+		t.Error("Expected error creating a table that exists")
+	}
+}
+
+func TestImportCSV_ExistingTable(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	csvData := "Full Name,E-mail,ignored\nCarol,carol@example.com,x\n,bad@example.com,x\nDave,dave@example.com\nErin,erin@example.com,x\n"
+	opts := models.CSVImportOptions{
+		Header:      true,
+		Mapping:     map[string]string{"Full Name": "name", "E-mail": "email", "ignored": ""},
+		EmptyAsNull: true,
+	}
+
+	result, err := db.ImportCSV(t.Context(), "users", strings.NewReader(csvData), opts)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if !result.Aborted || result.Inserted != 0 || len(result.Errors) != 1 || result.Errors[0].Row != 2 || result.Errors[0].Line != 3 {
+		t.Errorf("Expected abort at row 2 (line 3), got %+v", result)
+	}
+
+	// Abort mode ignores batch_size, so rows from earlier batches are
+	// rolled back too.
+	opts.BatchSize = 1
+	result, err = db.ImportCSV(t.Context(), "users", strings.NewReader("Full Name,E-mail,ignored\nCarol,c@example.com,x\nDave,d@example.com,x\n,bad@example.com,x\n"), opts)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	var users int
+	db.conn.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+	if !result.Aborted || result.Inserted != 0 || users != 2 {
+		t.Errorf("Expected the whole import rolled back at row 3, got %+v and %d users", result, users)
+	}
+
+	opts.Mode = models.ImportSkip
+	opts.BatchSize = 1
+	result, err = db.ImportCSV(t.Context(), "users", strings.NewReader(csvData), opts)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if result.Aborted || result.Inserted != 2 || result.Skipped != 2 {
+		t.Errorf("Expected 2 inserted and 2 skipped, got %+v", result)
+	}
+
+	data, err := db.GetTableData(t.Context(), "users", 1, 10)
+	if err != nil {
+		t.Fatalf("Failed to get data: %v", err)
+	}
+	if data.Total != 4 {
+		t.Errorf("Expected 4 users after import, got %d", data.Total)
+	}
+
+	opts.Mapping = nil
+	if _, err := db.ImportCSV(t.Context(), "users", strings.NewReader(csvData), opts); err == nil {
+		t.Error("Expected error for unmatched header without a mapping")
+	}
+}
+
+type collectingWriter struct {
+	rows   [][]interface{}
+	closed bool
+}
+
+func (c *collectingWriter) WriteRow(values []interface{}) error {
+	c.rows = append(c.rows, append([]interface{}(nil), values...))
+	return nil
+}
+
+func (c *collectingWriter) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestExportTable_FilterAndSort(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`INSERT INTO users (name, email) VALUES ('Carol', NULL), ('Dave', 'dave@example.com')`)
+	if err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+
+	var (
+		gotColumns []string
+		w          = &collectingWriter{}
+	)
+	req := models.TableDataRequest{
+		Filter: &models.FilterGroup{Filters: []models.Filter{{Column: "email", Operator: "IS NOT NULL"}}},
+		Sort:   []models.SortColumn{{Column: "name", Desc: true}},
+	}
+	err = db.ExportTable(t.Context(), "users", req, func(columns []string) (RowWriter, error) {
+		gotColumns = columns
+		return w, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	if strings.Join(gotColumns, ",") != "id,name,email" {
+		t.Errorf("Expected columns id,name,email, got %v", gotColumns)
+	}
+	var names []string
+	for _, row := range w.rows {
+		names = append(names, row[1].(string))
+	}
+	if strings.Join(names, ",") != "Dave,Bob,Alice" || !w.closed {
+		t.Errorf("Expected Dave,Bob,Alice and a closed writer, got %v (closed %v)", names, w.closed)
+	}
+
+	called := false
+	err = db.ExportQuery(t.Context(), "SELECT * FROM missing", nil, func(columns []string) (RowWriter, error) {
+		called = true
+		return w, nil
+	})
+	var inputErr *InputError
+	if !errors.As(err, &inputErr) || called {
+		t.Errorf("Expected input error before the export began, got %v (began %v)", err, called)
+	}
+
+	for _, query := range []string{
+		"UPDATE users SET name = 'Hacked' RETURNING *",
+		"WITH x AS (SELECT 1) DELETE FROM users RETURNING id",
+		"DELETE FROM users",
+		"SELECT 1; DELETE FROM users",
+	} {
+		err = db.ExportQuery(t.Context(), query, nil, func(columns []string) (RowWriter, error) {
+			called = true
+			return w, nil
+		})
+		if !errors.As(err, &inputErr) || called {
+			t.Errorf("%s: expected input error before the export began, got %v (began %v)", query, err, called)
+		}
+	}
+	var count int
+	db.conn.QueryRow("SELECT COUNT(*) FROM users WHERE name != 'Hacked'").Scan(&count)
+	if count != 4 {
+		t.Errorf("Expected the rows unchanged by refused exports, got %d", count)
+	}
+}
+
+func TestDump_RoundTrip(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE "order" (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id),
+			total REAL,
+			note TEXT,
+			data BLOB,
+			total_cents INTEGER GENERATED ALWAYS AS (CAST(total * 100 AS INTEGER))
+		);
+		CREATE TABLE "a ""quoted"" table" (k TEXT PRIMARY KEY, v ANY) WITHOUT ROWID;
+		CREATE INDEX idx_order_user ON "order" (user_id);
+		CREATE VIEW order_totals AS SELECT user_id, SUM(total) AS total FROM "order" GROUP BY user_id;
+		CREATE TRIGGER order_note AFTER INSERT ON "order" BEGIN UPDATE "order" SET note = COALESCE(note, 'new') WHERE id = NEW.id; END;
+		INSERT INTO "order" (id, user_id, total, note, data) VALUES
+			(1, 1, 0.1, 'it''s
+multi-line', x'00ff10'),
+			(2, 2, 1.0, NULL, NULL),
+			(3, 1, 1e300, 'x', NULL);
+		INSERT INTO "a ""quoted"" table" VALUES ('one', 1), ('two', 2.5), ('three', x'01');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	dump := func(db *DB, opts models.DumpOptions) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := db.Dump(t.Context(), opts, func() (io.Writer, error) { return &buf, nil }); err != nil {
+			t.Fatalf("Failed to dump: %v", err)
+		}
+		return buf.String()
+	}
+
+	full := dump(db, models.DumpOptions{})
+	for _, want := range []string{
+		"PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n",
+		`INSERT INTO "order"("id","user_id","total","note","data") VALUES(2,2,1.0,'new',NULL);`,
+		`INSERT INTO "a ""quoted"" table" VALUES('three',X'01');`,
+		"INSERT INTO sqlite_sequence VALUES('users',2);",
+		"COMMIT;\n",
+	} {
+		if !strings.Contains(full, want) {
+			t.Errorf("Expected dump to contain %q, got:\n%s", want, full)
+		}
+	}
+	if strings.Index(full, "CREATE TABLE users") > strings.Index(full, `CREATE TABLE "order"`) {
+		t.Errorf("Expected users to be created before the table referencing it")
+	}
+	if strings.Index(full, "CREATE VIEW") > strings.Index(full, "CREATE TRIGGER") {
+		t.Errorf("Expected views before triggers")
+	}
+
+	restoredPath := dbPath + ".restored"
+	defer os.Remove(restoredPath)
+	restored, err := New(restoredPath, false)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer restored.Close()
+	if _, err := restored.conn.Exec(full); err != nil {
+		t.Fatalf("Failed to load dump: %v", err)
+	}
+	if again := dump(restored, models.DumpOptions{}); again != full {
+		t.Errorf("Dump of the restored database differs:\n%s\n---\n%s", full, again)
+	}
+
+	schema := dump(db, models.DumpOptions{SchemaOnly: true, Tables: []string{"order"}})
+	if strings.Contains(schema, "INSERT INTO") || strings.Contains(schema, "CREATE TABLE users") || !strings.Contains(schema, "idx_order_user") {
+		t.Errorf("Unexpected schema-only subset dump:\n%s", schema)
+	}
+	data := dump(db, models.DumpOptions{DataOnly: true})
+	if strings.Contains(data, "CREATE") {
+		t.Errorf("Expected no CREATE statements in a data-only dump:\n%s", data)
+	}
+
+	var inputErr *InputError
+	err = db.Dump(t.Context(), models.DumpOptions{Tables: []string{"missing"}}, func() (io.Writer, error) { return io.Discard, nil })
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Expected input error for an unknown table, got %v", err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- setup
+SELECT 'a;b' AS "x;y";
+/* skip; me */ UPDATE t SET a = 1 ;;
+CREATE TEMP TRIGGER tr AFTER INSERT ON t BEGIN
+	UPDATE t SET a = CASE WHEN a > 0 THEN 1 ELSE 0 END;
+	DELETE FROM u;
+END;
+SELECT 1 -- trailing
+`
+	var got []string
+	for _, span := range splitStatements(script) {
+		got = append(got, script[span.start:span.end])
+	}
+	want := []string{
+		`SELECT 'a;b' AS "x;y"`,
+		`UPDATE t SET a = 1`,
+		"CREATE TEMP TRIGGER tr AFTER INSERT ON t BEGIN\n\tUPDATE t SET a = CASE WHEN a > 0 THEN 1 ELSE 0 END;\n\tDELETE FROM u;\nEND",
+		"SELECT 1 -- trailing",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("splitStatements = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Statement %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if spans := splitStatements(" ; -- nothing\n"); len(spans) != 0 {
+		t.Errorf("Expected no statements, got %v", spans)
+	}
+}
+
+func TestExecuteScript(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	result, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: `
+		CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);
+		INSERT INTO notes (body) VALUES ('a'), ('b');
+		UPDATE users SET email = NULL;
+		SELECT body FROM notes ORDER BY id;
+	`})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if result.Error != "" || len(result.Statements) != 4 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if result.Statements[0].RowsAffected != nil {
+		t.Errorf("Expected no affected row count for CREATE TABLE")
+	}
+	for i, want := range []int64{2, 2} {
+		if affected := result.Statements[i+1].RowsAffected; affected == nil || *affected != want {
+			t.Errorf("Statement %d: expected %d rows affected, got %v", i+1, want, affected)
+		}
+	}
+	if id := result.Statements[1].LastInsertID; id == nil || *id != 2 {
+		t.Errorf("Expected last insert ID 2, got %v", id)
+	}
+	if data := result.Statements[3].Result; data == nil || len(data.Rows) != 2 || data.Rows[1][0].Value != "b" {
+		t.Errorf("Unexpected SELECT result: %+v", data)
+	}
+
+	script := "INSERT INTO notes (body) VALUES ('c');\nSELECT * FROM missing;\nDELETE FROM notes;"
+	result, err = db.ExecuteScript(t.Context(), models.QueryRequest{SQL: script, Transaction: true})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if len(result.Statements) != 2 || result.Error == "" || !result.RolledBack {
+		t.Fatalf("Expected the script to stop at the failing statement and roll back: %+v", result)
+	}
+	failed := result.Statements[1]
+	if failed.Error == "" || script[failed.Offset:failed.End] != "SELECT * FROM missing" {
+		t.Errorf("Unexpected failing statement: %+v", failed)
+	}
+	var count int
+	db.conn.QueryRow("SELECT COUNT(*) FROM notes").Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected the transaction to be rolled back, got %d notes", count)
+	}
+
+	result, err = db.ExecuteScript(t.Context(), models.QueryRequest{SQL: "BEGIN; DELETE FROM notes"})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if !result.RolledBack || result.Error == "" {
+		t.Errorf("Expected an unfinished transaction to be rolled back: %+v", result)
+	}
+
+	var inputErr *InputError
+	if _, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: "  -- nothing\n"}); !errors.As(err, &inputErr) {
+		t.Errorf("Expected input error for an empty script, got %v", err)
+	}
+}
+
+func TestExecuteScript_Returning(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	result, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: `
+		INSERT INTO users (name) VALUES ('Carol') RETURNING id, name;
+		WITH gone AS (SELECT 1) DELETE FROM users WHERE id = 1;
+		UPDATE users SET email = NULL WHERE id = 99 RETURNING id;
+		SELECT 1;
+	`})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if result.Error != "" {
+		t.Fatalf("Unexpected error: %s", result.Error)
+	}
+
+	inserted := result.Statements[0]
+	if inserted.Result == nil || len(inserted.Result.Rows) != 1 || inserted.Result.Rows[0][1].Value != "Carol" {
+		t.Errorf("Expected the RETURNING row, got %+v", inserted.Result)
+	}
+	if inserted.RowsAffected == nil || *inserted.RowsAffected != 1 || inserted.LastInsertID == nil || *inserted.LastInsertID != 3 {
+		t.Errorf("Unexpected insert outcome: %+v", inserted)
+	}
+
+	if deleted := result.Statements[1]; deleted.RowsAffected == nil || *deleted.RowsAffected != 1 || deleted.LastInsertID != nil {
+		t.Errorf("Unexpected delete outcome: %+v", deleted)
+	}
+	if updated := result.Statements[2]; updated.Result == nil || len(updated.Result.Rows) != 0 || updated.RowsAffected == nil || *updated.RowsAffected != 0 {
+		t.Errorf("Unexpected update outcome: %+v", updated)
+	}
+	if selected := result.Statements[3]; selected.RowsAffected != nil {
+		t.Errorf("Expected no affected row count for SELECT, got %d", *selected.RowsAffected)
+	}
+}
+
+func TestInsertRow_ReturnsStoredRow(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	_, err := db.conn.Exec(`
+		CREATE TABLE tags (code TEXT PRIMARY KEY, label TEXT, created TEXT DEFAULT 'today') WITHOUT ROWID;
+		CREATE VIRTUAL TABLE notes USING fts5(body);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	row, err := db.InsertRow(t.Context(), "users", map[string]interface{}{"name": "Carol"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if row.Key["id"] != int64(3) || row.Values[0].Value != int64(3) || row.Values[1].Value != "Carol" || row.Values[2].Value != nil {
+		t.Errorf("Unexpected stored row: %+v", row)
+	}
+
+	row, err = db.InsertRow(t.Context(), "tags", map[string]interface{}{"code": "a"})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if row.Key["code"] != "a" || row.Values[2].Value != "today" {
+		t.Errorf("Unexpected stored row: %+v", row)
+	}
+
+	row, err = db.InsertRow(t.Context(), "notes", map[string]interface{}{"body": "hello"})
+	if err != nil {
+		t.Fatalf("Failed to insert into virtual table: %v", err)
+	}
+	if row.Key["rowid"] != int64(1) || row.Values[0].Value != "hello" {
+		t.Errorf("Unexpected stored row: %+v", row)
+	}
+
+	row, err = db.UpdateRow(t.Context(), "tags", models.RowKey{"code": "a"}, map[string]interface{}{"code": "b", "label": "B"})
+	if err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+	if row.Key["code"] != "b" || row.Values[1].Value != "B" {
+		t.Errorf("Expected the row under its new key, got %+v", row)
+	}
+
+	if _, err := db.UpdateRow(t.Context(), "tags", models.RowKey{"code": "a"}, map[string]interface{}{"label": "A"}); !errors.Is(err, ErrRowNotFound) {
+		t.Errorf("Expected ErrRowNotFound, got %v", err)
+	}
+}
+
+func TestExecuteScript_Interrupted(t *testing.T) {
+	db, dbPath := setupTestDB(t, true)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	const endless = "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT COUNT(*) FROM n"
+
+	db.SetQueryTimeout(50 * time.Millisecond)
+	result, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: "SELECT 1; "+endless})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if len(result.Statements) != 2 || !strings.Contains(result.Statements[1].Error, "timed out after 50ms") {
+		t.Errorf("Expected the second statement to time out: %+v", result)
+	}
+
+	db.SetQueryTimeout(0)
+	ctx, cancel := context.WithCancelCause(t.Context())
+	time.AfterFunc(50*time.Millisecond, func() { cancel(ErrQueryCancelled) })
+	result, err = db.ExecuteScript(ctx, models.QueryRequest{SQL: endless})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if result.Error != ErrQueryCancelled.Error() {
+		t.Errorf("Expected the query to be cancelled, got %q", result.Error)
+	}
+}
+
+func TestExecuteScript_Paging(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	db.SetMaxQueryRows(2)
+	result, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: `
+		INSERT INTO users (name) VALUES ('Carol'), ('Dave') RETURNING id;
+		SELECT name FROM users ORDER BY id;
+	`, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if result.Error != "" {
+		t.Fatalf("Unexpected error: %s", result.Error)
+	}
+	inserted := result.Statements[0]
+	if *inserted.RowsAffected != 2 || len(inserted.Result.Rows) != 2 || inserted.Result.Truncated {
+		t.Errorf("Unexpected insert outcome: %+v %+v", inserted, inserted.Result)
+	}
+	page := result.Statements[1].Result
+	if len(page.Rows) != 2 || page.Limit != 2 || !page.Truncated || page.Rows[1][0].Value != "Bob" {
+		t.Errorf("Expected the first 2 of 4 rows, got %+v", page)
+	}
+
+	result, err = db.ExecuteScript(t.Context(), models.QueryRequest{SQL: "SELECT name FROM users ORDER BY id", Page: 2})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	page = result.Statements[0].Result
+	if page.Page != 2 || page.Total != 4 || page.Truncated || page.Rows[0][0].Value != "Carol" {
+		t.Errorf("Expected the last 2 rows, got %+v", page)
+	}
+
+	if !result.Statements[0].Pageable {
+		t.Errorf("Expected a SELECT to be pageable")
+	}
+
+	var inputErr *InputError
+	_, err = db.ExecuteScript(t.Context(), models.QueryRequest{SQL: "DELETE FROM users RETURNING id", Page: 2})
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Expected paging a DELETE to be refused, got %v", err)
+	}
+	var count int
+	db.conn.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	if count != 4 {
+		t.Errorf("Expected the DELETE not to run, got %d users", count)
+	}
+
+	_, err = db.ExecuteScript(t.Context(), models.QueryRequest{SQL: `
+		CREATE TABLE copies AS SELECT * FROM users;
+		SELECT name FROM copies;
+	`, Page: 2})
+	if !errors.As(err, &inputErr) {
+		t.Errorf("Expected paging a script that creates a table to be refused, got %v", err)
+	}
+	var tables int
+	db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'copies'").Scan(&tables)
+	if tables != 0 {
+		t.Errorf("Expected the CREATE TABLE not to run")
+	}
+}
+
+func TestExecuteScript_Explain(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	db.SetMaxQueryRows(1)
+	result, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: `
+		INSERT INTO users (name) VALUES ('Carol');
+		SELECT name FROM users WHERE id = 1;
+		SELECT DISTINCT email FROM users ORDER BY email;
+	`, Explain: true})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if result.Error != "" || !result.RolledBack || len(result.Statements) != 3 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	lookup := result.Statements[1]
+	if len(lookup.Plan) != 1 || lookup.Plan[0].FullScan || !strings.HasPrefix(lookup.Plan[0].Detail, "SEARCH users") {
+		t.Errorf("Expected a primary key search, got %+v", lookup.Plan)
+	}
+	if lookup.RowsReturned == nil || *lookup.RowsReturned != 1 {
+		t.Errorf("Expected 1 row returned, got %v", lookup.RowsReturned)
+	}
+
+	scan := result.Statements[2]
+	var full, temp bool
+	var walk func([]*models.PlanNode)
+	walk = func(nodes []*models.PlanNode) {
+		for _, node := range nodes {
+			full = full || node.FullScan
+			temp = temp || node.TempBTree
+			walk(node.Children)
+		}
+	}
+	walk(scan.Plan)
+	if !full || !temp {
+		t.Errorf("Expected a full scan and a temp B-tree, got %+v", scan.Plan)
+	}
+	if scan.RowsReturned == nil || *scan.RowsReturned != 3 || !scan.Result.Truncated {
+		t.Errorf("Expected all rows counted past the row limit, got %v", scan.RowsReturned)
+	}
+
+	var count int
+	db.conn.QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected explain mode to roll back the INSERT, got %d users", count)
+	}
+
+	result, err = db.ExecuteScript(t.Context(), models.QueryRequest{SQL: "BEGIN; SELECT 1", Explain: true})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if result.Statements[0].Error == "" {
+		t.Errorf("Expected BEGIN to be refused in explain mode")
+	}
+}
+
+func TestExecuteScript_Params(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	run := func(sql string, params interface{}) *models.ScriptResult {
+		t.Helper()
+		result, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: sql, Params: params})
+		if err != nil {
+			t.Fatalf("Failed to execute script: %v", err)
+		}
+		return result
+	}
+
+	// JSON numbers decode as float64 but must match INTEGER keys.
+	result := run("SELECT name FROM users WHERE id = ?", []interface{}{float64(2)})
+	if result.Error != "" || result.Statements[0].Result.Rows[0][0].Value != "Bob" {
+		t.Errorf("Expected Bob by position, got %+v", result)
+	}
+
+	result = run("UPDATE users SET email = :email WHERE name = @name; SELECT email FROM users WHERE name = $name",
+		map[string]interface{}{"email": "bobby@example.com", ":name": "Bob"})
+	if result.Error != "" || result.Statements[1].Result.Rows[0][0].Value != "bobby@example.com" {
+		t.Errorf("Expected the named parameters in both statements, got %+v", result)
+	}
+
+	// A quoted parameter-like string is not a parameter.
+	result = run("SELECT ':name', ?1", []interface{}{"x"})
+	if result.Error != "" || result.Statements[0].Result.Rows[0][0].Value != ":name" {
+		t.Errorf("Expected a literal string, got %+v", result)
+	}
+
+	result = run("SELECT * FROM users WHERE id = :id", map[string]interface{}{"other": 1.0})
+	if !strings.Contains(result.Error, "id") {
+		t.Errorf("Expected a missing parameter error, got %q", result.Error)
+	}
+
+	var inputErr *InputError
+	for _, params := range []interface{}{"1", map[string]interface{}{"1a": 1.0}, []interface{}{[]interface{}{}}} {
+		_, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: "SELECT ?", Params: params})
+		if !errors.As(err, &inputErr) {
+			t.Errorf("Expected an input error for params %v, got %v", params, err)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	count := func(ctx context.Context) int {
+		t.Helper()
+		data, err := db.GetTableData(ctx, "users", 1, 50)
+		if err != nil {
+			t.Fatalf("Failed to get table data: %v", err)
+		}
+		return data.Total
+	}
+
+	session, err := db.BeginSession(t.Context())
+	if err != nil {
+		t.Fatalf("Failed to begin session: %v", err)
+	}
+	ctx := WithSession(t.Context(), session)
+
+	if _, err := db.InsertRow(ctx, "users", map[string]interface{}{"name": "Carol"}); err != nil {
+		t.Fatalf("Failed to insert in session: %v", err)
+	}
+	if count(ctx) != 3 || count(t.Context()) != 2 {
+		t.Errorf("Expected the insert to be seen only in the session")
+	}
+	if _, err := db.InsertRow(t.Context(), "users", map[string]interface{}{"name": "Dave"}); err == nil {
+		t.Errorf("Expected a write outside the session to fail while it is open")
+	}
+
+	result, err := db.ExecuteScript(ctx, models.QueryRequest{SQL: "DELETE FROM users; SELECT * FROM missing", Transaction: true})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if !result.RolledBack || count(ctx) != 3 {
+		t.Errorf("Expected the failed script's savepoint to be rolled back, got %+v and %d rows", result, count(ctx))
+	}
+	result, err = db.ExecuteScript(ctx, models.QueryRequest{SQL: "COMMIT"})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if result.Error == "" || !session.Active() {
+		t.Errorf("Expected COMMIT to be refused in a session")
+	}
+	if _, err := db.ImportCSV(ctx, "users", strings.NewReader("name\nEve\n"), models.CSVImportOptions{}); err == nil {
+		t.Errorf("Expected CSV import to be refused in a session")
+	}
+
+	if err := session.Commit(t.Context()); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if count(t.Context()) != 3 {
+		t.Errorf("Expected the committed insert to be seen")
+	}
+
+	session, err = db.BeginSession(t.Context())
+	if err != nil {
+		t.Fatalf("Failed to begin session: %v", err)
+	}
+	if err := db.DeleteRow(WithSession(t.Context(), session), "users", models.RowKey{"id": 1}); err != nil {
+		t.Fatalf("Failed to delete in session: %v", err)
+	}
+	if err := session.Rollback(t.Context()); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if count(t.Context()) != 3 {
+		t.Errorf("Expected the rolled back delete to leave 3 rows")
+	}
+
+	// OR ROLLBACK ends the transaction itself when the insert conflicts.
+	session, err = db.BeginSession(t.Context())
+	if err != nil {
+		t.Fatalf("Failed to begin session: %v", err)
+	}
+	ctx = WithSession(t.Context(), session)
+	result, err = db.ExecuteScript(ctx, models.QueryRequest{SQL: "DELETE FROM users WHERE id = 2; INSERT OR ROLLBACK INTO users (id, name) VALUES (1, 'Alice')"})
+	if err != nil {
+		t.Fatalf("Failed to execute script: %v", err)
+	}
+	if result.Error == "" || session.Active() {
+		t.Errorf("Expected the session to be rolled back by the conflict, got %+v", result)
+	}
+	if err := session.Rollback(t.Context()); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if count(t.Context()) != 3 {
+		t.Errorf("Expected the rolled back session to leave 3 rows")
+	}
+}
+
+func TestBulkRows(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	if _, err := db.conn.Exec(`INSERT INTO users (name, email) VALUES ('Carol', NULL), ('Dave', NULL)`); err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+	count := func(where string) int {
+		var n int
+		db.conn.QueryRow("SELECT COUNT(*) FROM users WHERE " + where).Scan(&n)
+		return n
+	}
+
+	// A preview writes nothing, so it fires no triggers.
+	_, err := db.conn.Exec(`
+		CREATE TABLE fired (n INTEGER);
+		CREATE TRIGGER users_fired AFTER UPDATE ON users BEGIN INSERT INTO fired VALUES (1); END;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create trigger: %v", err)
+	}
+
+	noEmail := &models.FilterGroup{Filters: []models.Filter{{Column: "email", Operator: "IS NULL"}}}
+	res, err := db.UpdateRows(t.Context(), "users", models.BulkRowRequest{Filter: noEmail, Values: map[string]interface{}{"email": "none"}}, true)
+	if err != nil || res.RowsAffected != 2 || res.Applied || count("email = 'none'") != 0 {
+		t.Fatalf("Expected a preview of 2 rows that changes nothing, got %+v, %v", res, err)
+	}
+	if len(res.Sample.Rows) != 2 || res.Sample.Rows[0][1].Value != "Carol" || res.Sample.Truncated {
+		t.Errorf("Expected Carol and Dave as the sample, got %+v", res.Sample)
+	}
+	var fired int
+	db.conn.QueryRow("SELECT COUNT(*) FROM fired").Scan(&fired)
+	if fired != 0 {
+		t.Errorf("Expected the preview not to fire the trigger, got %d", fired)
+	}
+	res, err = db.UpdateRows(t.Context(), "users", models.BulkRowRequest{Filter: noEmail, Values: map[string]interface{}{"email": "none"}}, false)
+	if err != nil || res.RowsAffected != 2 || !res.Applied || count("email = 'none'") != 2 {
+		t.Errorf("Expected 2 rows updated, got %+v, %v", res, err)
+	}
+
+	keys := []models.RowKey{{"id": 1}, {"id": 3}, {"id": 99}}
+	res, err = db.DeleteRows(t.Context(), "users", models.BulkRowRequest{Keys: keys}, true)
+	if err != nil || res.RowsAffected != 2 || len(res.Sample.Rows) != 2 || res.Sample.Rows[1][1].Value != "Carol" || count("1") != 4 {
+		t.Errorf("Expected a preview of 2 of the 3 keys, got %+v, %v", res, err)
+	}
+	res, err = db.DeleteRows(t.Context(), "users", models.BulkRowRequest{Keys: keys}, false)
+	if err != nil || res.RowsAffected != 2 || count("1") != 2 {
+		t.Errorf("Expected 2 of the 3 keys deleted, got %+v, %v", res, err)
+	}
+
+	// A failing row rolls back the rows before it.
+	if _, err := db.conn.Exec(`CREATE UNIQUE INDEX users_email ON users (email)`); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	_, err = db.UpdateRows(t.Context(), "users", models.BulkRowRequest{Keys: []models.RowKey{{"id": 2}, {"id": 4}}, Values: map[string]interface{}{"email": "same"}}, false)
+	if err == nil || count("email = 'same'") != 0 {
+		t.Errorf("Expected the unique violation to roll back the whole update, got %v", err)
+	}
+
+	var inputErr *InputError
+	for _, req := range []models.BulkRowRequest{
+		{},
+		{Keys: keys, All: true},
+		{Filter: &models.FilterGroup{}},
+	} {
+		if _, err := db.DeleteRows(t.Context(), "users", req, false); !errors.As(err, &inputErr) {
+			t.Errorf("Expected an input error for %+v, got %v", req, err)
+		}
+	}
+	if count("1") != 2 {
+		t.Errorf("Expected refused deletes to change nothing")
+	}
+
+	res, err = db.DeleteRows(t.Context(), "users", models.BulkRowRequest{All: true}, false)
+	if err != nil || res.RowsAffected != 2 || count("1") != 0 {
+		t.Errorf("Expected every row deleted, got %+v, %v", res, err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	var recorded []models.AuditEntry
+	db.SetChangeRecorder(func(ctx context.Context, changes []models.AuditEntry) {
+		recorded = append(recorded, changes...)
+	})
+	take := func() []models.AuditEntry {
+		changes := recorded
+		recorded = nil
+		return changes
+	}
+	ctx := WithClient(t.Context(), "127.0.0.1:1234")
+
+	if _, err := db.InsertRow(ctx, "users", map[string]interface{}{"name": "Carol"}); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	changes := take()
+	if len(changes) != 1 || changes[0].Operation != models.AuditInsert || changes[0].Client != "127.0.0.1:1234" ||
+		changes[0].Before != nil || changes[0].After["name"] != "Carol" || changes[0].Key["id"] != int64(3) {
+		t.Fatalf("Unexpected insert changes: %+v", changes)
+	}
+
+	if _, err := db.UpdateRow(ctx, "users", models.RowKey{"id": 1}, map[string]interface{}{"email": "a@example.com"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	changes = take()
+	if len(changes) != 1 || changes[0].Operation != models.AuditUpdate ||
+		changes[0].Before["email"] != "alice@example.com" || changes[0].After["email"] != "a@example.com" {
+		t.Fatalf("Unexpected update changes: %+v", changes)
+	}
+	update := changes[0]
+
+	// Rolled back writes, whole or to a savepoint, are not recorded.
+	script := `BEGIN; UPDATE users SET email = NULL; ROLLBACK;
+		DELETE FROM users WHERE id = 2;
+		BEGIN; INSERT INTO users (name) VALUES ('Dave'); SAVEPOINT s; UPDATE users SET name = 'Eve' WHERE name = 'Dave'; ROLLBACK TO s; COMMIT`
+	result, err := db.ExecuteScript(ctx, models.QueryRequest{SQL: script})
+	if err != nil || result.Error != "" {
+		t.Fatalf("Failed to execute script: %v %+v", err, result)
+	}
+	changes = take()
+	if len(changes) != 2 || changes[0].Operation != models.AuditDelete || changes[0].Key["id"] != int64(2) ||
+		changes[1].Operation != models.AuditInsert || changes[1].After["name"] != "Dave" {
+		t.Fatalf("Unexpected script changes: %+v", changes)
+	}
+	deletion := changes[0]
+
+	session, err := db.BeginSession(t.Context())
+	if err != nil {
+		t.Fatalf("Failed to begin session: %v", err)
+	}
+	if err := db.DeleteRow(WithSession(ctx, session), "users", models.RowKey{"id": 3}); err != nil {
+		t.Fatalf("Failed to delete in session: %v", err)
+	}
+	if len(recorded) != 0 {
+		t.Errorf("Expected session changes to wait for the commit, got %+v", recorded)
+	}
+	if err := session.Commit(t.Context()); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if changes = take(); len(changes) != 1 || changes[0].Operation != models.AuditDelete {
+		t.Errorf("Unexpected session changes: %+v", changes)
+	}
+
+	if err := db.UndoChange(ctx, deletion); err != nil {
+		t.Fatalf("Failed to undo delete: %v", err)
+	}
+	row, err := db.getRow(t.Context(), "users", []string{"id"}, models.RowKey{"id": 2})
+	if err != nil || row.Values[1].Value != "Bob" {
+		t.Errorf("Expected the deleted row back, got %+v, %v", row, err)
+	}
+	if changes = take(); len(changes) != 1 || changes[0].Operation != models.AuditInsert {
+		t.Errorf("Expected the undo to be recorded, got %+v", changes)
+	}
+	if err := db.UndoChange(ctx, deletion); !errors.Is(err, ErrRowChanged) {
+		t.Errorf("Expected undoing twice to fail with ErrRowChanged, got %v", err)
+	}
+
+	if _, err := db.UpdateRow(ctx, "users", models.RowKey{"id": 1}, map[string]interface{}{"name": "Alicia"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if err := db.UndoChange(ctx, update); !errors.Is(err, ErrRowChanged) {
+		t.Errorf("Expected undoing a change to a row changed since to fail, got %v", err)
+	}
+	take()
+
+	// Tables without a primary key are keyed, and restored, by rowid.
+	result, err = db.ExecuteScript(ctx, models.QueryRequest{SQL: "CREATE TABLE notes (body TEXT); INSERT INTO notes (rowid, body) VALUES (7, 'hi'); DELETE FROM notes"})
+	if err != nil || result.Error != "" {
+		t.Fatalf("Failed to execute script: %v %+v", err, result)
+	}
+	changes = take()
+	if len(changes) != 2 || changes[1].Operation != models.AuditDelete || changes[1].Key["rowid"] != int64(7) {
+		t.Fatalf("Unexpected rowid table changes: %+v", changes)
+	}
+	if err := db.UndoChange(ctx, changes[1]); err != nil {
+		t.Fatalf("Failed to undo delete: %v", err)
+	}
+	var body string
+	if err := db.conn.QueryRow("SELECT body FROM notes WHERE rowid = 7").Scan(&body); err != nil || body != "hi" {
+		t.Errorf("Expected the note back at rowid 7, got %q, %v", body, err)
+	}
+}
+
+func TestAudit_Blobs(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	var recorded []models.AuditEntry
+	db.SetChangeRecorder(func(ctx context.Context, changes []models.AuditEntry) {
+		recorded = append(recorded, changes...)
+	})
+	// take returns the last change as the audit log gives it back, from
+	// JSON with numbers as json.Number.
+	take := func() models.AuditEntry {
+		t.Helper()
+		if len(recorded) == 0 {
+			t.Fatalf("Expected a change to be recorded")
+		}
+		encoded, err := json.Marshal(recorded[len(recorded)-1])
+		if err != nil {
+			t.Fatalf("Failed to encode change: %v", err)
+		}
+		recorded = nil
+		var entry models.AuditEntry
+		decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("Failed to decode change: %v", err)
+		}
+		return entry
+	}
+	stored := func(query string) (typ, hex string) {
+		t.Helper()
+		if err := db.conn.QueryRow(query).Scan(&typ, &hex); err != nil {
+			t.Fatalf("Failed to read blob: %v", err)
+		}
+		return typ, hex
+	}
+
+	data := []byte{0x00, 0xff, 0x10, 0xfe, 0x80}
+	script := "CREATE TABLE files (id INTEGER PRIMARY KEY, data BLOB); CREATE TABLE tokens (token BLOB PRIMARY KEY, note TEXT)"
+	if result, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: script}); err != nil || result.Error != "" {
+		t.Fatalf("Failed to create tables: %v %+v", err, result)
+	}
+	if _, err := db.conn.Exec("INSERT INTO files VALUES (1, ?)", data); err != nil {
+		t.Fatalf("Failed to insert blob: %v", err)
+	}
+	if _, err := db.conn.Exec("INSERT INTO tokens VALUES (?, 'key')", data); err != nil {
+		t.Fatalf("Failed to insert blob key: %v", err)
+	}
+
+	if _, err := db.UpdateRow(t.Context(), "files", models.RowKey{"id": 1}, map[string]interface{}{"data": []byte{0x01}}); err != nil {
+		t.Fatalf("Failed to update blob: %v", err)
+	}
+	update := take()
+	if err := db.UndoChange(t.Context(), update); err != nil {
+		t.Fatalf("Failed to undo blob update: %v", err)
+	}
+	if typ, hex := stored("SELECT typeof(data), hex(data) FROM files WHERE id = 1"); typ != "blob" || hex != "00FF10FE80" {
+		t.Errorf("Expected the blob back after undoing the update, got %s %s", typ, hex)
+	}
+	recorded = nil
+
+	if err := db.DeleteRow(t.Context(), "files", models.RowKey{"id": 1}); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := db.UndoChange(t.Context(), take()); err != nil {
+		t.Fatalf("Failed to undo blob delete: %v", err)
+	}
+	if typ, hex := stored("SELECT typeof(data), hex(data) FROM files WHERE id = 1"); typ != "blob" || hex != "00FF10FE80" {
+		t.Errorf("Expected the blob back after undoing the delete, got %s %s", typ, hex)
+	}
+
+	if _, err := db.conn.Exec("DELETE FROM tokens"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	recorded = nil
+	if result, err := db.ExecuteScript(t.Context(), models.QueryRequest{SQL: "INSERT INTO tokens VALUES (x'00ff10fe80', 'key'); DELETE FROM tokens"}); err != nil || result.Error != "" {
+		t.Fatalf("Failed to execute script: %v %+v", err, result)
+	}
+	if err := db.UndoChange(t.Context(), take()); err != nil {
+		t.Fatalf("Failed to undo delete of a row keyed by a blob: %v", err)
+	}
+	if typ, hex := stored("SELECT typeof(token), hex(token) FROM tokens"); typ != "blob" || hex != "00FF10FE80" {
+		t.Errorf("Expected the blob key back, got %s %s", typ, hex)
+	}
+}
+
+func TestBlobs(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01")
+	if _, err := db.conn.Exec(`CREATE TABLE files (id INTEGER PRIMARY KEY, data BLOB, note TEXT)`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := db.conn.Exec(`INSERT INTO files VALUES (1, ?, 'logo')`, png); err != nil {
+		t.Fatalf("Failed to insert blob: %v", err)
+	}
+
+	data, err := db.QueryTableData(t.Context(), "files", models.TableDataRequest{Page: 1, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to query table data: %v", err)
+	}
+	blob, ok := data.Rows[0][1].Value.(models.Blob)
+	if !ok {
+		t.Fatalf("Expected a blob value, got %#v", data.Rows[0][1].Value)
+	}
+	if blob.Size != len(png) || blob.Hex != "89504e470d0a1a0a0000000d49484452" || blob.ContentType != "image/png" {
+		t.Errorf("Unexpected blob value %+v", blob)
+	}
+	if note := data.Rows[0][2].Value; note != "logo" {
+		t.Errorf("Expected text to stay text, got %#v", note)
+	}
+
+	value, err := db.GetCell(t.Context(), "files", models.RowKey{"id": 1}, "data")
+	if err != nil || !bytes.Equal(value, png) {
+		t.Errorf("Expected the stored bytes, got %q, %v", value, err)
+	}
+	if _, err := db.GetCell(t.Context(), "files", models.RowKey{"id": 1}, "missing"); err == nil {
+		t.Error("Expected an unknown column to be refused")
+	}
+	if _, err := db.GetCell(t.Context(), "files", models.RowKey{"id": 1}, "id"); err == nil {
+		t.Error("Expected a number cell to be refused")
+	}
+	if _, err := db.GetCell(t.Context(), "files", models.RowKey{"id": 2}, "data"); !errors.Is(err, ErrRowNotFound) {
+		t.Errorf("Expected ErrRowNotFound, got %v", err)
+	}
+}
+
+func TestCoerceValues(t *testing.T) {
+	db, dbPath := setupTestDB(t, false)
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	if _, err := db.conn.Exec(`
+		CREATE TABLE items (
+			id INTEGER PRIMARY KEY,
+			qty INTEGER NOT NULL,
+			price REAL,
+			code TEXT,
+			amount NUMERIC,
+			status TEXT NOT NULL DEFAULT 'new',
+			extra
+		);
+		CREATE TABLE strict_items (id INTEGER PRIMARY KEY, qty INT, anything ANY) STRICT;
+	`); err != nil {
+		t.Fatalf("Failed to create tables: %v", err)
+	}
+	stored := func(table, col string, id int64) (string, string) {
+		var typ, text string
+		db.conn.QueryRow(fmt.Sprintf("SELECT typeof(%s), CAST(%s AS TEXT) FROM %s WHERE id = ?", col, col, table), id).Scan(&typ, &text)
+		return typ, text
+	}
+
+	row, err := db.InsertRow(t.Context(), "items", map[string]interface{}{
+		"id":     json.Number("9007199254740993"),
+		"qty":    json.Number("42.0"),
+		"price":  "2.5",
+		"code":   json.Number("1.50"),
+		"amount": "12",
+		"extra":  json.Number("7"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if row.Key["id"] != int64(9007199254740993) {
+		t.Errorf("Expected the exact big id as key, got %#v", row.Key["id"])
+	}
+	for _, tt := range []struct{ col, typ, text string }{
+		{"qty", "integer", "42"},
+		{"price", "real", "2.5"},
+		{"code", "text", "1.50"},
+		{"amount", "integer", "12"},
+		{"status", "text", "new"},
+		{"extra", "integer", "7"},
+	} {
+		if typ, text := stored("items", tt.col, 9007199254740993); typ != tt.typ || text != tt.text {
+			t.Errorf("%s: expected %s %q, got %s %q", tt.col, tt.typ, tt.text, typ, text)
+		}
+	}
+
+	var inputErr *InputError
+	for name, values := range map[string]map[string]interface{}{
+		"not an integer":   {"qty": "lots"},
+		"fractional":       {"qty": 1.5},
+		"not a number":     {"qty": 1, "price": "cheap"},
+		"missing not null": {"price": 1},
+		"explicit null":    {"qty": nil},
+		"unknown column":   {"qty": 1, "nope": 1},
+		"blob cell":        {"qty": 1, "extra": map[string]interface{}{"type": "blob"}},
+	} {
+		if _, err := db.InsertRow(t.Context(), "items", values); !errors.As(err, &inputErr) {
+			t.Errorf("%s: expected an input error, got %v", name, err)
+		}
+	}
+	var count int
+	db.conn.QueryRow("SELECT COUNT(*) FROM items").Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected refused inserts to add no rows, got %d rows", count)
+	}
+
+	key := models.RowKey{"id": json.Number("9007199254740993")}
+	_, err = db.UpdateRow(t.Context(), "items", key, map[string]interface{}{
+		"status": map[string]interface{}{"type": "default"},
+		"price":  map[string]interface{}{"type": "null"},
+		"code":   map[string]interface{}{"type": "integer", "value": "5"},
+		"extra":  true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+	for _, tt := range []struct{ col, typ, text string }{
+		{"status", "text", "new"},
+		{"price", "null", ""},
+		// TEXT affinity still applies to what is stored.
+		{"code", "text", "5"},
+		{"extra", "integer", "1"},
+	} {
+		if typ, text := stored("items", tt.col, 9007199254740993); typ != tt.typ || text != tt.text {
+			t.Errorf("%s: expected %s %q, got %s %q", tt.col, tt.typ, tt.text, typ, text)
+		}
+	}
+	if _, err := db.UpdateRow(t.Context(), "items", key, map[string]interface{}{"qty": map[string]interface{}{"type": "default"}}); !errors.As(err, &inputErr) {
+		t.Errorf("Expected setting a NOT NULL column without default to its default to be refused, got %v", err)
+	}
+
+	if _, err := db.InsertRow(t.Context(), "strict_items", map[string]interface{}{"id": 1, "qty": "3", "anything": "3"}); err != nil {
+		t.Fatalf("Failed to insert into strict table: %v", err)
+	}
+	if typ, _ := stored("strict_items", "qty", 1); typ != "integer" {
+		t.Errorf("Expected INT to store an integer, got %s", typ)
+	}
+	if typ, _ := stored("strict_items", "anything", 1); typ != "text" {
+		t.Errorf("Expected ANY to keep text as given, got %s", typ)
+	}
+}
@@ -0,0 +1,594 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+var (
+	typeNamePattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_ ]*(\(\s*[+-]?\d+(\.\d+)?\s*(,\s*[+-]?\d+(\.\d+)?\s*)?\))?$`)
+	collationPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// strictTypes are the only column types a STRICT table accepts.
+var strictTypes = map[string]bool{"INT": true, "INTEGER": true, "REAL": true, "TEXT": true, "BLOB": true, "ANY": true}
+
+var foreignKeyActions = map[string]bool{"": true, "NO ACTION": true, "RESTRICT": true, "SET NULL": true, "SET DEFAULT": true, "CASCADE": true}
+
+// ddlPlan is the list of statements an operation will run. A rebuild
+// runs with foreign key enforcement suspended and checks the foreign keys
+// before committing, as the SQLite documentation prescribes for changes
+// ALTER TABLE cannot make.
+type ddlPlan struct {
+	statements []string
+	rebuild    bool
+}
+
+// script returns every statement applying the plan runs, in order.
+func (p *ddlPlan) script() []string {
+	if !p.rebuild {
+		return p.statements
+	}
+	script := []string{"PRAGMA foreign_keys = OFF", "PRAGMA legacy_alter_table = ON", "BEGIN"}
+	script = append(script, p.statements...)
+	return append(script, "PRAGMA foreign_key_check", "COMMIT", "PRAGMA legacy_alter_table = OFF", "PRAGMA foreign_keys = ON")
+}
+
+// checkExpression guards SQL expressions taken verbatim from a request
+// against smuggling in further statements.
+func checkExpression(what, expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return inputErrorf("%s must not be empty", what)
+	}
+	if hasStatementSeparator(expr) {
+		return inputErrorf("%s must be a single expression", what)
+	}
+	return nil
+}
+
+func quoteIdentList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func columnDefinitionSQL(col models.ColumnDefinition, strict bool) (string, error) {
+	if col.Name == "" {
+		return "", inputErrorf("column name is required")
+	}
+
+	parts := []string{quoteIdent(col.Name)}
+	if col.Type != "" {
+		if !typeNamePattern.MatchString(col.Type) {
+			return "", inputErrorf("invalid type %q for column %s", col.Type, col.Name)
+		}
+		if strict && !strictTypes[strings.ToUpper(col.Type)] {
+			return "", inputErrorf("STRICT tables only allow INT, INTEGER, REAL, TEXT, BLOB or ANY, not %q", col.Type)
+		}
+		parts = append(parts, col.Type)
+	} else if strict {
+		return "", inputErrorf("column %s needs a type in a STRICT table", col.Name)
+	}
+
+	if col.PrimaryKey {
+		parts = append(parts, "PRIMARY KEY")
+		if col.AutoIncrement {
+			if !strings.EqualFold(col.Type, "INTEGER") {
+				return "", inputErrorf("AUTOINCREMENT requires an INTEGER PRIMARY KEY column")
+			}
+			parts = append(parts, "AUTOINCREMENT")
+		}
+	} else if col.AutoIncrement {
+		return "", inputErrorf("AUTOINCREMENT requires an INTEGER PRIMARY KEY column")
+	}
+	if col.NotNull {
+		parts = append(parts, "NOT NULL")
+	}
+	if col.Unique {
+		parts = append(parts, "UNIQUE")
+	}
+	if col.Default != nil {
+		if err := checkExpression("default for "+col.Name, *col.Default); err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("DEFAULT (%s)", *col.Default))
+	}
+	if col.Check != "" {
+		if err := checkExpression("check for "+col.Name, col.Check); err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("CHECK (%s)", col.Check))
+	}
+	if col.Collate != "" {
+		if !collationPattern.MatchString(col.Collate) {
+			return "", inputErrorf("invalid collation %q", col.Collate)
+		}
+		parts = append(parts, "COLLATE "+col.Collate)
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// buildCreateTable renders def as a CREATE TABLE statement for tableName.
+func buildCreateTable(def models.TableDefinition, tableName string) (string, error) {
+	if tableName == "" {
+		return "", inputErrorf("table name is required")
+	}
+	if strings.HasPrefix(strings.ToLower(tableName), "sqlite_") {
+		return "", inputErrorf("table names beginning with sqlite_ are reserved")
+	}
+	if len(def.Columns) == 0 {
+		return "", inputErrorf("a table needs at least one column")
+	}
+
+	known := map[string]bool{}
+	var columnPKs int
+	for _, col := range def.Columns {
+		name := strings.ToLower(col.Name)
+		if known[name] {
+			return "", inputErrorf("duplicate column %s", col.Name)
+		}
+		known[name] = true
+		if col.PrimaryKey {
+			columnPKs++
+		}
+	}
+
+	requireColumns := func(what string, names []string) error {
+		if len(names) == 0 {
+			return inputErrorf("%s needs at least one column", what)
+		}
+		for _, name := range names {
+			if !known[strings.ToLower(name)] {
+				return inputErrorf("%s refers to unknown column %s", what, name)
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case columnPKs > 1:
+		return "", inputErrorf("use the table primary key for a key spanning several columns")
+	case columnPKs == 1 && len(def.PrimaryKey) > 0:
+		return "", inputErrorf("a table can only have one primary key")
+	case def.WithoutRowid && columnPKs == 0 && len(def.PrimaryKey) == 0:
+		return "", inputErrorf("WITHOUT ROWID tables need a primary key")
+	}
+
+	var lines []string
+	for _, col := range def.Columns {
+		if col.AutoIncrement && def.WithoutRowid {
+			return "", inputErrorf("AUTOINCREMENT is not allowed on WITHOUT ROWID tables")
+		}
+		line, err := columnDefinitionSQL(col, def.Strict)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+
+	if len(def.PrimaryKey) > 0 {
+		if err := requireColumns("primary key", def.PrimaryKey); err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY (%s)", quoteIdentList(def.PrimaryKey)))
+	}
+	for _, unique := range def.Unique {
+		if err := requireColumns("unique constraint", unique); err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("UNIQUE (%s)", quoteIdentList(unique)))
+	}
+	for _, check := range def.Checks {
+		if err := checkExpression("check constraint", check); err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("CHECK (%s)", check))
+	}
+	for _, fk := range def.ForeignKeys {
+		if err := requireColumns("foreign key", fk.Columns); err != nil {
+			return "", err
+		}
+		if fk.Table == "" {
+			return "", inputErrorf("foreign key needs a referenced table")
+		}
+		if len(fk.To) > 0 && len(fk.To) != len(fk.Columns) {
+			return "", inputErrorf("foreign key to %s must reference as many columns as it has", fk.Table)
+		}
+
+		line := fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s", quoteIdentList(fk.Columns), quoteIdent(fk.Table))
+		if len(fk.To) > 0 {
+			line += fmt.Sprintf(" (%s)", quoteIdentList(fk.To))
+		}
+		for _, action := range []struct{ clause, value string }{{"ON UPDATE", fk.OnUpdate}, {"ON DELETE", fk.OnDelete}} {
+			value := strings.ToUpper(strings.TrimSpace(action.value))
+			if !foreignKeyActions[value] {
+				return "", inputErrorf("invalid foreign key action %q", action.value)
+			}
+			if value != "" {
+				line += " " + action.clause + " " + value
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	var options []string
+	if def.WithoutRowid {
+		options = append(options, "WITHOUT ROWID")
+	}
+	if def.Strict {
+		options = append(options, "STRICT")
+	}
+
+	stmt := fmt.Sprintf("CREATE TABLE %s (\n    %s\n)", quoteIdent(tableName), strings.Join(lines, ",\n    "))
+	if len(options) > 0 {
+		stmt += " " + strings.Join(options, ", ")
+	}
+	return stmt, nil
+}
+
+// PlanCreateTable returns the statements CreateTable would run for def.
+func (db *DB) PlanCreateTable(ctx context.Context, def models.TableDefinition) ([]string, error) {
+	stmt, err := buildCreateTable(def, def.Name)
+	if err != nil {
+		return nil, err
+	}
+	return []string{stmt}, nil
+}
+
+func (db *DB) CreateTable(ctx context.Context, def models.TableDefinition) ([]string, error) {
+	if db.readonly {
+		return nil, fmt.Errorf("database is in read-only mode")
+	}
+
+	stmt, err := buildCreateTable(def, def.Name)
+	if err != nil {
+		return nil, err
+	}
+	plan := &ddlPlan{statements: []string{stmt}}
+	if err := db.applyPlan(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan.script(), nil
+}
+
+// PlanAlterTable returns the statements AlterTable would run.
+func (db *DB) PlanAlterTable(ctx context.Context, tableName string, req models.AlterTableRequest) ([]string, error) {
+	plan, err := db.planAlterTable(ctx, tableName, req)
+	if err != nil {
+		return nil, err
+	}
+	return plan.script(), nil
+}
+
+func (db *DB) AlterTable(ctx context.Context, tableName string, req models.AlterTableRequest) ([]string, error) {
+	if db.readonly {
+		return nil, fmt.Errorf("database is in read-only mode")
+	}
+
+	plan, err := db.planAlterTable(ctx, tableName, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.applyPlan(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan.script(), nil
+}
+
+func (db *DB) planAlterTable(ctx context.Context, tableName string, req models.AlterTableRequest) (*ddlPlan, error) {
+	info, err := db.getObjectInfo(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if info.objType != models.TableTypeTable {
+		return nil, inputErrorf("only ordinary tables can be altered")
+	}
+
+	table := quoteIdent(tableName)
+	switch req.Action {
+	case models.AlterAddColumn:
+		if req.Column == nil {
+			return nil, inputErrorf("add_column needs a column")
+		}
+		colSQL, err := columnDefinitionSQL(*req.Column, false)
+		if err != nil {
+			return nil, err
+		}
+		return &ddlPlan{statements: []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, colSQL)}}, nil
+
+	case models.AlterRenameColumn:
+		if req.Name == "" || req.NewName == "" {
+			return nil, inputErrorf("rename_column needs name and new_name")
+		}
+		return &ddlPlan{statements: []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, quoteIdent(req.Name), quoteIdent(req.NewName)),
+		}}, nil
+
+	case models.AlterDropColumn:
+		if req.Name == "" {
+			return nil, inputErrorf("drop_column needs name")
+		}
+		return &ddlPlan{statements: []string{
+			fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, quoteIdent(req.Name)),
+		}}, nil
+
+	case models.AlterRenameTable:
+		if req.NewName == "" {
+			return nil, inputErrorf("rename_table needs new_name")
+		}
+		if strings.HasPrefix(strings.ToLower(req.NewName), "sqlite_") {
+			return nil, inputErrorf("table names beginning with sqlite_ are reserved")
+		}
+		return &ddlPlan{statements: []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", table, quoteIdent(req.NewName)),
+		}}, nil
+
+	case models.AlterRebuild:
+		if req.Definition == nil {
+			return nil, inputErrorf("rebuild needs a definition")
+		}
+		return db.planRebuild(ctx, tableName, *req.Definition)
+	}
+
+	return nil, inputErrorf("unknown alter action %q", req.Action)
+}
+
+// planRebuild replaces tableName with a new table built from def: create
+// it under a temporary name, copy the columns both share, swap it in and
+// recreate the old table's indexes and triggers.
+func (db *DB) planRebuild(ctx context.Context, tableName string, def models.TableDefinition) (*ddlPlan, error) {
+	tempName, err := db.unusedTableName(ctx, tableName+"_new")
+	if err != nil {
+		return nil, err
+	}
+
+	createSQL, err := buildCreateTable(def, tempName)
+	if err != nil {
+		return nil, err
+	}
+
+	oldColumns, err := db.getColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	old := map[string]bool{}
+	for _, col := range oldColumns {
+		old[strings.ToLower(col.Name)] = true
+	}
+	var shared []string
+	for _, col := range def.Columns {
+		if old[strings.ToLower(col.Name)] {
+			shared = append(shared, col.Name)
+		}
+	}
+
+	statements := []string{createSQL}
+	if len(shared) > 0 {
+		statements = append(statements, fmt.Sprintf(
+			"INSERT INTO %s (%s) SELECT %s FROM %s",
+			quoteIdent(tempName), quoteIdentList(shared), quoteIdentList(shared), quoteIdent(tableName),
+		))
+	}
+	statements = append(statements,
+		fmt.Sprintf("DROP TABLE %s", quoteIdent(tableName)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", quoteIdent(tempName), quoteIdent(tableName)),
+	)
+
+	rows, err := db.q(ctx).QueryContext(ctx,
+		"SELECT sql FROM sqlite_master WHERE tbl_name = ? AND type IN ('index', 'trigger') AND sql IS NOT NULL ORDER BY type, name",
+		tableName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexes and triggers: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema entry: %w", err)
+		}
+		statements = append(statements, stmt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &ddlPlan{statements: statements, rebuild: true}, nil
+}
+
+func (db *DB) unusedTableName(ctx context.Context, base string) (string, error) {
+	name := base
+	for i := 2; ; i++ {
+		inUse, err := db.nameInUse(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if !inUse {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// nameInUse reports whether any schema object is called name. SQLite
+// compares names case-insensitively.
+func (db *DB) nameInUse(ctx context.Context, name string) (bool, error) {
+	var count int
+	err := db.q(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = ? COLLATE NOCASE", name).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to query schema: %w", err)
+	}
+	return count > 0, nil
+}
+
+// applyPlan runs a plan's statements in one transaction on a dedicated
+// connection, so the connection-level pragmas of a rebuild cannot leak
+// to other requests.
+func (db *DB) applyPlan(ctx context.Context, plan *ddlPlan) error {
+	if err := db.notInSession(ctx, "Creating or altering tables"); err != nil {
+		return err
+	}
+
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if plan.rebuild {
+		var foreignKeys int
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+			return fmt.Errorf("failed to read foreign_keys: %w", err)
+		}
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		// Restore the pragmas even if ctx is cancelled, before the
+		// connection goes back to the pool.
+		cleanup := context.WithoutCancel(ctx)
+		defer conn.ExecContext(cleanup, fmt.Sprintf("PRAGMA foreign_keys = %d", foreignKeys))
+
+		if _, err := conn.ExecContext(ctx, "PRAGMA legacy_alter_table = ON"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(cleanup, "PRAGMA legacy_alter_table = OFF")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range plan.statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to execute %q: %w", firstLine(stmt), err)
+		}
+	}
+
+	if plan.rebuild {
+		var table sql.NullString
+		err := tx.QueryRowContext(ctx, "SELECT \"table\" FROM pragma_foreign_key_check").Scan(&table)
+		if err == nil {
+			return inputErrorf("rebuild would break foreign key references in table %s", table.String)
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check foreign keys: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " ..."
+	}
+	return s
+}
+
+// GetTableDefinition reconstructs a table's definition from SQLite's
+// pragmas, as a starting point for a rebuild. CHECK constraints and
+// collations are not reported by the pragmas, so the original CREATE
+// statement is returned alongside.
+func (db *DB) GetTableDefinition(ctx context.Context, tableName string) (*models.TableDefinitionResponse, error) {
+	info, err := db.getObjectInfo(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if info.objType != models.TableTypeTable {
+		return nil, inputErrorf("only ordinary tables have a definition")
+	}
+
+	var (
+		createSQL string
+		strict    int
+	)
+	if err := db.q(ctx).QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", tableName).Scan(&createSQL); err != nil {
+		return nil, fmt.Errorf("failed to query table: %w", err)
+	}
+	if err := db.q(ctx).QueryRowContext(ctx, "SELECT strict FROM pragma_table_list WHERE schema = 'main' AND name = ?", tableName).Scan(&strict); err != nil {
+		return nil, fmt.Errorf("failed to query table info: %w", err)
+	}
+
+	def := models.TableDefinition{
+		Name:         tableName,
+		WithoutRowid: info.withoutRowid,
+		Strict:       strict == 1,
+	}
+
+	columns, err := db.getColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := db.primaryKeyColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, col := range columns {
+		colDef := models.ColumnDefinition{
+			Name:    col.Name,
+			Type:    col.Type,
+			NotNull: col.NotNull,
+			Default: col.DefaultValue,
+		}
+		if len(pk) == 1 && col.PrimaryKey {
+			colDef.PrimaryKey = true
+			// SQLite only accepts AUTOINCREMENT on an INTEGER PRIMARY
+			// KEY, so the keyword can only belong to this column.
+			colDef.AutoIncrement = !info.withoutRowid && strings.EqualFold(col.Type, "INTEGER") && hasKeyword(createSQL, "AUTOINCREMENT")
+		}
+		def.Columns = append(def.Columns, colDef)
+	}
+	if len(pk) > 1 {
+		def.PrimaryKey = pk
+	}
+
+	indexes, err := db.GetIndexes(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if index.Origin != models.IndexOriginUnique {
+			continue
+		}
+		var names []string
+		for _, col := range index.Columns {
+			names = append(names, col.Name)
+		}
+		if len(names) == 1 {
+			for i := range def.Columns {
+				if strings.EqualFold(def.Columns[i].Name, names[0]) {
+					def.Columns[i].Unique = true
+				}
+			}
+			continue
+		}
+		def.Unique = append(def.Unique, names)
+	}
+
+	foreignKeys, err := db.GetForeignKeys(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, fk := range foreignKeys {
+		def.ForeignKeys = append(def.ForeignKeys, models.ForeignKeyDefinition{
+			Columns:  fk.From,
+			Table:    fk.Table,
+			To:       fk.To,
+			OnUpdate: fk.OnUpdate,
+			OnDelete: fk.OnDelete,
+		})
+	}
+
+	return &models.TableDefinitionResponse{Definition: def, SQL: createSQL}, nil
+}
@@ -0,0 +1,363 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// quoteSQLIdent quotes a name the standard way, with double quotes, for
+// SQL text meant to be read by other tools.
+func quoteSQLIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// schemaEntry is one object from sqlite_master.
+type schemaEntry struct {
+	objType string
+	name    string
+	table   string
+	sql     string
+}
+
+// Dump writes the database as SQL text in the style of the sqlite3
+// shell's .dump: tables, parents before the tables referencing them,
+// each followed by its rows as INSERT statements, then indexes, views and
+// triggers, all in one transaction. Views come before triggers because
+// INSTEAD OF triggers need their view to exist. Everything is read in a
+// single transaction so the dump is consistent.
+//
+// Virtual tables are recreated with CREATE VIRTUAL TABLE and their rows
+// inserted through the module; their shadow tables are left out. SQLite's
+// internal tables are left out too, except for AUTOINCREMENT counters.
+//
+// begin is called once the dump is ready to start and returns where to
+// write it, so errors found before then can still be reported normally.
+func (db *DB) Dump(ctx context.Context, opts models.DumpOptions, begin func() (io.Writer, error)) error {
+	if opts.SchemaOnly && opts.DataOnly {
+		return inputErrorf("schema_only and data_only cannot both be set")
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	entries, err := dumpEntries(ctx, tx, opts.Tables)
+	if err != nil {
+		return err
+	}
+
+	var tables, others []schemaEntry
+	for _, entry := range entries {
+		if entry.objType == "table" {
+			tables = append(tables, entry)
+		} else {
+			others = append(others, entry)
+		}
+	}
+	tables, err = dependencyOrder(ctx, tx, tables)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(others, func(i, j int) bool {
+		return dumpRank(others[i].objType) < dumpRank(others[j].objType)
+	})
+
+	out, err := begin()
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(out, 64*1024)
+
+	w.WriteString("PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n")
+	for _, table := range tables {
+		if !opts.DataOnly {
+			fmt.Fprintf(w, "%s;\n", table.sql)
+		}
+		if !opts.SchemaOnly {
+			if err := dumpRows(ctx, tx, w, table.name); err != nil {
+				return err
+			}
+		}
+	}
+	if !opts.SchemaOnly {
+		if err := dumpSequences(ctx, tx, w, tables); err != nil {
+			return err
+		}
+	}
+	if !opts.DataOnly {
+		for _, entry := range others {
+			fmt.Fprintf(w, "%s;\n", entry.sql)
+		}
+	}
+	w.WriteString("COMMIT;\n")
+
+	return w.Flush()
+}
+
+func dumpRank(objType string) int {
+	switch objType {
+	case "index":
+		return 0
+	case "view":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// dumpEntries lists the schema objects to dump, in creation order. With
+// a subset, tables and views are chosen by name and indexes and triggers
+// by the table they belong to.
+func dumpEntries(ctx context.Context, tx *sql.Tx, subset []string) ([]schemaEntry, error) {
+	shadow := map[string]bool{}
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'shadow'")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tables: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		shadow[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range subset {
+		wanted[strings.ToLower(name)] = false
+	}
+
+	rows, err = tx.QueryContext(ctx, "SELECT type, name, tbl_name, sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY rowid")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []schemaEntry
+	for rows.Next() {
+		var entry schemaEntry
+		if err := rows.Scan(&entry.objType, &entry.name, &entry.table, &entry.sql); err != nil {
+			return nil, fmt.Errorf("failed to scan schema entry: %w", err)
+		}
+		if strings.HasPrefix(strings.ToLower(entry.name), "sqlite_") || shadow[entry.name] {
+			continue
+		}
+
+		if len(subset) > 0 {
+			owner := strings.ToLower(entry.table)
+			if _, ok := wanted[owner]; !ok {
+				continue
+			}
+			if entry.objType == "table" || entry.objType == "view" {
+				wanted[owner] = true
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range subset {
+		if !wanted[strings.ToLower(name)] {
+			return nil, inputErrorf("table not found: %s", name)
+		}
+	}
+
+	return entries, nil
+}
+
+// dependencyOrder sorts tables so every table follows the tables its
+// foreign keys reference. Tables in a reference cycle keep their
+// creation order; with foreign keys off while loading, any order loads.
+func dependencyOrder(ctx context.Context, tx *sql.Tx, tables []schemaEntry) ([]schemaEntry, error) {
+	index := make(map[string]int, len(tables))
+	for i, table := range tables {
+		index[strings.ToLower(table.name)] = i
+	}
+
+	parents := make([]map[int]bool, len(tables))
+	for i, table := range tables {
+		parents[i] = map[int]bool{}
+		rows, err := tx.QueryContext(ctx, `SELECT DISTINCT "table" FROM pragma_foreign_key_list(?)`, table.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query foreign keys: %w", err)
+		}
+		for rows.Next() {
+			var parent string
+			if err := rows.Scan(&parent); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+			}
+			if j, ok := index[strings.ToLower(parent)]; ok && j != i {
+				parents[i][j] = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		ordered = make([]schemaEntry, 0, len(tables))
+		done    = make([]bool, len(tables))
+	)
+	for len(ordered) < len(tables) {
+		progress := false
+		for i := range tables {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for j := range parents[i] {
+				if !done[j] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[i] = true
+				ordered = append(ordered, tables[i])
+				progress = true
+			}
+		}
+		if !progress {
+			// A cycle: take the earliest remaining table and carry on.
+			for i := range tables {
+				if !done[i] {
+					done[i] = true
+					ordered = append(ordered, tables[i])
+					break
+				}
+			}
+		}
+	}
+
+	return ordered, nil
+}
+
+// dumpRows writes one INSERT per row. SQLite's quote() renders each value
+// as a literal that reads back exactly, REALs and BLOBs included, so the
+// statements are built in SQL without converting values in Go.
+func dumpRows(ctx context.Context, tx *sql.Tx, w *bufio.Writer, table string) error {
+	rows, err := tx.QueryContext(ctx, "SELECT name, hidden FROM pragma_table_xinfo(?)", table)
+	if err != nil {
+		return fmt.Errorf("failed to query columns: %w", err)
+	}
+	var (
+		columns  []string
+		excluded bool
+	)
+	for rows.Next() {
+		var (
+			name   string
+			hidden int
+		)
+		if err := rows.Scan(&name, &hidden); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan column: %w", err)
+		}
+		// Hidden columns of virtual tables and generated columns cannot
+		// be inserted.
+		if hidden != 0 {
+			excluded = true
+			continue
+		}
+		columns = append(columns, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	prefix := "INSERT INTO " + quoteSQLIdent(table)
+	if excluded {
+		quoted := make([]string, len(columns))
+		for i, col := range columns {
+			quoted[i] = quoteSQLIdent(col)
+		}
+		prefix += "(" + strings.Join(quoted, ",") + ")"
+	}
+	prefix += " VALUES("
+
+	values := make([]string, len(columns))
+	for i, col := range columns {
+		values[i] = fmt.Sprintf("quote(%s)", quoteIdent(col))
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(values, " || ',' || "), quoteIdent(table))
+
+	rows, err = tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var literal string
+	for rows.Next() {
+		if err := rows.Scan(&literal); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		w.WriteString(prefix)
+		w.WriteString(literal)
+		if _, err := w.WriteString(");\n"); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// dumpSequences carries over the AUTOINCREMENT counters of the dumped
+// tables, which SQLite keeps in sqlite_sequence.
+func dumpSequences(ctx context.Context, tx *sql.Tx, w *bufio.Writer, tables []schemaEntry) error {
+	var exists int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'").Scan(&exists)
+	if err != nil || exists == 0 {
+		return err
+	}
+
+	dumped := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		dumped[table.name] = true
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT name, seq FROM sqlite_sequence")
+	if err != nil {
+		return fmt.Errorf("failed to query sqlite_sequence: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			name string
+			seq  int64
+		)
+		if err := rows.Scan(&name, &seq); err != nil {
+			return fmt.Errorf("failed to scan sqlite_sequence: %w", err)
+		}
+		if !dumped[name] {
+			continue
+		}
+		quoted := "'" + strings.ReplaceAll(name, "'", "''") + "'"
+		fmt.Fprintf(w, "DELETE FROM sqlite_sequence WHERE name = %s;\n", quoted)
+		fmt.Fprintf(w, "INSERT INTO sqlite_sequence VALUES(%s,%d);\n", quoted, seq)
+	}
+	return rows.Err()
+}
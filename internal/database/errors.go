@@ -0,0 +1,27 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRowNotFound is returned when a row key does not match any row.
+var ErrRowNotFound = errors.New("row not found")
+
+// ErrQueryCancelled is the cause to cancel a query's context with when a
+// user stops it, so its error says why it was interrupted.
+var ErrQueryCancelled = errors.New("query cancelled")
+
+// InputError reports a request that was rejected before any SQL ran,
+// such as an unknown column or a malformed filter.
+type InputError struct {
+	msg string
+}
+
+func (e *InputError) Error() string {
+	return e.msg
+}
+
+func inputErrorf(format string, args ...interface{}) error {
+	return &InputError{msg: fmt.Sprintf(format, args...)}
+}
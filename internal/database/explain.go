@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// isTransactionVerb reports whether a statement with the given verb
+// controls transactions, which explain mode cannot allow since it runs
+// the script in a transaction of its own.
+func isTransactionVerb(verb string) bool {
+	switch verb {
+	case "BEGIN", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		return true
+	}
+	return false
+}
+
+// explainStatement runs EXPLAIN QUERY PLAN for a statement and builds
+// the plan tree from the id and parent of each step. Statements without a
+// plan, such as CREATE TABLE, return nil.
+func explainStatement(ctx context.Context, conn *sql.Conn, stmt string, args []interface{}) ([]*models.PlanNode, error) {
+	verb, _ := statementVerb(stmt)
+	if isTransactionVerb(verb) {
+		return nil, inputErrorf("%s cannot be used in explain mode, which runs the script in its own transaction", verb)
+	}
+	if verb == "EXPLAIN" {
+		return nil, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, "EXPLAIN QUERY PLAN "+stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		roots []*models.PlanNode
+		nodes = map[int]*models.PlanNode{}
+	)
+	for rows.Next() {
+		var (
+			id, parent, notUsed int
+			detail              string
+		)
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, fmt.Errorf("failed to scan query plan: %w", err)
+		}
+
+		node := &models.PlanNode{
+			ID:        id,
+			Detail:    detail,
+			FullScan:  strings.HasPrefix(detail, "SCAN ") && detail != "SCAN CONSTANT ROW",
+			TempBTree: strings.Contains(detail, "USE TEMP B-TREE"),
+		}
+		nodes[id] = node
+		if parentNode, ok := nodes[parent]; ok {
+			parentNode.Children = append(parentNode.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, rows.Err()
+}
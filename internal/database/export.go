@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// RowWriter receives exported rows as they are read.
+type RowWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// ExportTable streams the rows of tableName matching req's filter, in
+// its sort order; paging fields are ignored. begin is called with the
+// column names once the query is running and returns the writer for the
+// rows, so a caller can still report an error if the query fails.
+func (db *DB) ExportTable(ctx context.Context, tableName string, req models.TableDataRequest, begin func(columns []string) (RowWriter, error)) error {
+	q, err := db.prepareTableQuery(ctx, tableName, req)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s%s%s", quoteIdent(tableName), q.where, q.orderBy())
+	rows, err := db.q(ctx).QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return fmt.Errorf("failed to query table data: %w", err)
+	}
+	defer rows.Close()
+
+	return streamRows(rows, begin)
+}
+
+// ExportQuery streams the result of query like ExportTable, with params
+// bound as for ExecuteScript. The query must be a single SELECT, since
+// an export is a download and nothing about it should change rows. Like
+// ExecuteScript, it is interrupted when ctx is cancelled or the query
+// timeout passes.
+func (db *DB) ExportQuery(ctx context.Context, query string, params interface{}, begin func(columns []string) (RowWriter, error)) error {
+	spans := splitStatements(query)
+	switch len(spans) {
+	case 0:
+		return inputErrorf("query cannot be empty")
+	case 1:
+	default:
+		return inputErrorf("only a single statement can be exported")
+	}
+	query = query[spans[0].start:spans[0].end]
+	if verb, _ := statementVerb(query); !isReadVerb(verb) {
+		return inputErrorf("only SELECT statements can be exported, not %s", verb)
+	}
+	args, err := bindArgs(params)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := db.withQueryTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.q(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = context.Cause(ctx)
+		}
+		return inputErrorf("failed to execute query: %v", err)
+	}
+	defer rows.Close()
+
+	if err := streamRows(rows, begin); err != nil {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		return err
+	}
+	return nil
+}
+
+// streamRows copies rows to the writer begin returns, reusing one scan
+// buffer so memory use does not grow with the result.
+func streamRows(rows *sql.Rows, begin func(columns []string) (RowWriter, error)) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	w, err := begin(columns)
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if err := w.WriteRow(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
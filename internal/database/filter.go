@@ -0,0 +1,121 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// maxFilterDepth bounds how deeply filter groups may nest.
+const maxFilterDepth = 8
+
+var comparisonOperators = map[string]string{
+	"=":        "=",
+	"!=":       "!=",
+	"<":        "<",
+	"<=":       "<=",
+	">":        ">",
+	">=":       ">=",
+	"LIKE":     "LIKE",
+	"NOT LIKE": "NOT LIKE",
+}
+
+// compileFilter turns a filter group into a parameterized SQL expression.
+// Columns are checked against the table schema so that only known
+// identifiers are ever interpolated. An empty group compiles to "".
+func compileFilter(group *models.FilterGroup, columns []models.Column) (string, []interface{}, error) {
+	if group == nil {
+		return "", nil, nil
+	}
+
+	known := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		known[strings.ToLower(col.Name)] = true
+	}
+
+	return compileFilterGroup(group, known, 0)
+}
+
+func compileFilterGroup(group *models.FilterGroup, known map[string]bool, depth int) (string, []interface{}, error) {
+	if depth > maxFilterDepth {
+		return "", nil, inputErrorf("filter groups nested too deeply")
+	}
+
+	var joiner string
+	switch strings.ToLower(group.Match) {
+	case "", "all", "and":
+		joiner = " AND "
+	case "any", "or":
+		joiner = " OR "
+	default:
+		return "", nil, inputErrorf("unknown filter match %q", group.Match)
+	}
+
+	var (
+		clauses []string
+		args    []interface{}
+	)
+
+	for _, f := range group.Filters {
+		clause, clauseArgs, err := compileCondition(f, known)
+		if err != nil {
+			return "", nil, err
+		}
+		clauses = append(clauses, clause)
+		args = append(args, clauseArgs...)
+	}
+
+	for i := range group.Groups {
+		clause, clauseArgs, err := compileFilterGroup(&group.Groups[i], known, depth+1)
+		if err != nil {
+			return "", nil, err
+		}
+		if clause == "" {
+			continue
+		}
+		clauses = append(clauses, clause)
+		args = append(args, clauseArgs...)
+	}
+
+	switch len(clauses) {
+	case 0:
+		return "", nil, nil
+	case 1:
+		return clauses[0], args, nil
+	}
+	return "(" + strings.Join(clauses, joiner) + ")", args, nil
+}
+
+func compileCondition(f models.Filter, known map[string]bool) (string, []interface{}, error) {
+	if !known[strings.ToLower(f.Column)] {
+		return "", nil, inputErrorf("unknown filter column %q", f.Column)
+	}
+	col := quoteIdent(f.Column)
+	op := strings.ToUpper(strings.TrimSpace(f.Operator))
+
+	if sqlOp, ok := comparisonOperators[op]; ok {
+		if f.Value == nil {
+			return "", nil, inputErrorf("filter on %q with %s requires a value", f.Column, op)
+		}
+		return fmt.Sprintf("%s %s ?", col, sqlOp), []interface{}{plainValue(f.Value)}, nil
+	}
+
+	switch op {
+	case "IS NULL", "IS NOT NULL":
+		return fmt.Sprintf("%s %s", col, op), nil, nil
+	case "IN", "NOT IN":
+		if len(f.Values) == 0 {
+			return "", nil, inputErrorf("filter on %q with %s requires at least one value", f.Column, op)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(f.Values)), ", ")
+		return fmt.Sprintf("%s %s (%s)", col, op, placeholders), plainValues(f.Values), nil
+	case "BETWEEN":
+		if len(f.Values) != 2 {
+			return "", nil, inputErrorf("filter on %q with BETWEEN requires exactly two values", f.Column)
+		}
+		return fmt.Sprintf("%s BETWEEN ? AND ?", col), plainValues(f.Values), nil
+	}
+
+	return "", nil, inputErrorf("unknown filter operator %q", f.Operator)
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// GetForeignKeys returns the foreign keys declared on tableName. A key
+// written without target columns refers to the parent's primary key,
+// which is resolved here. If the parent has no primary key with as many
+// columns, the key is marked unresolved and To is left empty.
+func (db *DB) GetForeignKeys(ctx context.Context, tableName string) ([]models.ForeignKey, error) {
+	rows, err := db.q(ctx).QueryContext(ctx, `
+		SELECT id, "table", "from", "to", on_update, on_delete
+		FROM pragma_foreign_key_list(?)
+		ORDER BY id, seq
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		foreignKeys []models.ForeignKey
+		implicitTo  []bool
+	)
+	for rows.Next() {
+		var (
+			id       int
+			parent   string
+			from     string
+			to       sql.NullString
+			onUpdate string
+			onDelete string
+		)
+		if err := rows.Scan(&id, &parent, &from, &to, &onUpdate, &onDelete); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key: %w", err)
+		}
+
+		if len(foreignKeys) == 0 || foreignKeys[len(foreignKeys)-1].ID != id {
+			foreignKeys = append(foreignKeys, models.ForeignKey{
+				ID:       id,
+				Table:    parent,
+				OnUpdate: onUpdate,
+				OnDelete: onDelete,
+			})
+			implicitTo = append(implicitTo, false)
+		}
+
+		fk := &foreignKeys[len(foreignKeys)-1]
+		fk.From = append(fk.From, from)
+		fk.To = append(fk.To, to.String)
+		if !to.Valid {
+			implicitTo[len(implicitTo)-1] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range foreignKeys {
+		if !implicitTo[i] {
+			continue
+		}
+		pk, err := db.primaryKeyColumns(ctx, foreignKeys[i].Table)
+		if err != nil {
+			return nil, err
+		}
+		if len(pk) == len(foreignKeys[i].From) {
+			foreignKeys[i].To = pk
+		} else {
+			foreignKeys[i].To = nil
+			foreignKeys[i].Unresolved = true
+		}
+	}
+
+	return foreignKeys, nil
+}
+
+// primaryKeyColumns returns the declared primary key of tableName in key
+// order, or nil if it has none.
+func (db *DB) primaryKeyColumns(ctx context.Context, tableName string) ([]string, error) {
+	rows, err := db.q(ctx).QueryContext(ctx, "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table schema: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// GetReferencingRows finds, for every foreign key in the database that
+// points at tableName, up to limit rows referencing the row with key.
+func (db *DB) GetReferencingRows(ctx context.Context, tableName string, key models.RowKey, limit int) ([]models.ReferencingRows, error) {
+	keyColumns, err := db.GetRowKeyColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	where, keyArgs, err := keyWhereClause(keyColumns, key)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := db.tableNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []models.ReferencingRows
+	for _, child := range children {
+		foreignKeys, err := db.GetForeignKeys(ctx, child)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fk := range foreignKeys {
+			if fk.Unresolved || !strings.EqualFold(fk.Table, tableName) {
+				continue
+			}
+
+			filter, err := db.referenceFilter(ctx, tableName, fk, where, keyArgs)
+			if err != nil {
+				return nil, err
+			}
+			if filter == nil {
+				continue
+			}
+
+			data, err := db.QueryTableData(ctx, child, models.TableDataRequest{Page: 1, Limit: limit, Filter: filter})
+			if err != nil {
+				return nil, err
+			}
+			if data.Total == 0 {
+				continue
+			}
+
+			results = append(results, models.ReferencingRows{
+				Table:      child,
+				ForeignKey: fk,
+				Data:       data,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// referenceFilter reads the parent row's referenced columns and builds a
+// filter matching child rows that point at them. It returns nil when the
+// parent row has a NULL in the referenced columns, since nothing can
+// reference it through this key.
+func (db *DB) referenceFilter(ctx context.Context, parent string, fk models.ForeignKey, where string, keyArgs []interface{}) (*models.FilterGroup, error) {
+	selectList := make([]string, len(fk.To))
+	for i, col := range fk.To {
+		selectList[i] = quoteIdent(col)
+	}
+
+	values := make([]interface{}, len(fk.To))
+	valuePtrs := make([]interface{}, len(fk.To))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(selectList, ", "), quoteIdent(parent), where)
+	err := db.q(ctx).QueryRowContext(ctx, query, keyArgs...).Scan(valuePtrs...)
+	if err == sql.ErrNoRows {
+		return nil, ErrRowNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read referenced row: %w", err)
+	}
+
+	filter := &models.FilterGroup{}
+	for i, col := range fk.From {
+		if values[i] == nil {
+			return nil, nil
+		}
+		filter.Filters = append(filter.Filters, models.Filter{Column: col, Operator: "=", Value: values[i]})
+	}
+	return filter, nil
+}
+
+// tableNames lists the ordinary tables in the main schema.
+func (db *DB) tableNames(ctx context.Context) ([]string, error) {
+	rows, err := db.q(ctx).QueryContext(ctx, "SELECT name FROM pragma_table_list WHERE schema = 'main' AND type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tables: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
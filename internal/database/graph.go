@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// GetSchemaGraph builds the table, column and foreign key graph of every
+// ordinary table in the main schema.
+func (db *DB) GetSchemaGraph(ctx context.Context) (*models.SchemaGraph, error) {
+	names, err := db.tableNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &models.SchemaGraph{
+		Tables: []models.GraphTable{},
+		Edges:  []models.GraphEdge{},
+	}
+
+	for _, name := range names {
+		columns, err := db.getColumns(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		foreignKeys, err := db.GetForeignKeys(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		fkColumns := map[string]bool{}
+		for _, fk := range foreignKeys {
+			for _, col := range fk.From {
+				fkColumns[strings.ToLower(col)] = true
+			}
+			// There is no column to draw an edge to.
+			if fk.Unresolved {
+				continue
+			}
+
+			graph.Edges = append(graph.Edges, models.GraphEdge{
+				FromTable:   name,
+				FromColumns: fk.From,
+				ToTable:     fk.Table,
+				ToColumns:   fk.To,
+				Optional:    !allNotNull(columns, fk.From),
+				OnUpdate:    fk.OnUpdate,
+				OnDelete:    fk.OnDelete,
+			})
+		}
+
+		table := models.GraphTable{Name: name}
+		for _, col := range columns {
+			table.Columns = append(table.Columns, models.GraphColumn{
+				Name:       col.Name,
+				Type:       col.Type,
+				NotNull:    col.NotNull,
+				PrimaryKey: col.PrimaryKey,
+				ForeignKey: fkColumns[strings.ToLower(col.Name)],
+			})
+		}
+		graph.Tables = append(graph.Tables, table)
+	}
+
+	return graph, nil
+}
+
+// allNotNull reports whether every named column is declared NOT NULL.
+func allNotNull(columns []models.Column, names []string) bool {
+	for _, name := range names {
+		for _, col := range columns {
+			if strings.EqualFold(col.Name, name) && !col.NotNull {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,555 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+const (
+	defaultImportBatchSize = 500
+	maxImportBatchSize     = 10000
+	// importSampleRows is how many rows are read ahead to infer column
+	// types for a new table.
+	importSampleRows = 1000
+	maxImportErrors  = 100
+)
+
+// recordReader reads CSV records, reporting the line each one started on.
+type recordReader interface {
+	Read() ([]string, error)
+	Line() int
+}
+
+type csvRecordReader struct {
+	r    *csv.Reader
+	line int
+}
+
+func (c *csvRecordReader) Read() ([]string, error) {
+	record, err := c.r.Read()
+	var parseErr *csv.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		c.line = parseErr.StartLine
+	case err == nil:
+		c.line, _ = c.r.FieldPos(0)
+	}
+	return record, err
+}
+
+func (c *csvRecordReader) Line() int {
+	return c.line
+}
+
+// plainRecordReader splits lines on the delimiter without any quoting.
+type plainRecordReader struct {
+	r         *bufio.Reader
+	delimiter string
+	line      int
+}
+
+func (p *plainRecordReader) Read() ([]string, error) {
+	for {
+		text, err := p.r.ReadString('\n')
+		if text == "" && err != nil {
+			return nil, err
+		}
+		p.line++
+
+		text = strings.TrimRight(text, "\r\n")
+		if text == "" {
+			continue
+		}
+		return strings.Split(text, p.delimiter), nil
+	}
+}
+
+func (p *plainRecordReader) Line() int {
+	return p.line
+}
+
+func newRecordReader(r io.Reader, opts models.CSVImportOptions) (recordReader, error) {
+	delimiter := opts.Delimiter
+	switch delimiter {
+	case "":
+		delimiter = ","
+	case `\t`, "tab":
+		delimiter = "\t"
+	}
+	comma, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || comma == utf8.RuneError || comma == '\r' || comma == '\n' {
+		return nil, inputErrorf("delimiter must be a single character")
+	}
+
+	switch opts.Quoting {
+	case "", "standard", "lazy":
+		if comma == '"' {
+			return nil, inputErrorf("delimiter cannot be the quote character")
+		}
+		cr := csv.NewReader(r)
+		cr.Comma = comma
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = opts.Quoting == "lazy"
+		cr.ReuseRecord = false
+		return &csvRecordReader{r: cr}, nil
+	case "none":
+		return &plainRecordReader{r: bufio.NewReader(r), delimiter: delimiter}, nil
+	}
+
+	return nil, inputErrorf("quoting must be standard, lazy or none")
+}
+
+// csvRecord is a record read ahead of inserting it.
+type csvRecord struct {
+	fields []string
+	line   int
+	err    error
+}
+
+// inferColumnType picks the narrowest of INTEGER, REAL and TEXT that
+// holds every non-empty value. Numbers with leading zeros stay TEXT so
+// codes like "007" survive.
+func inferColumnType(values []string) string {
+	isInteger, isReal, seen := true, true, false
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		seen = true
+
+		digits := strings.TrimLeft(v, "+-")
+		if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+			return "TEXT"
+		}
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			isInteger = false
+		}
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			isReal = false
+		}
+		if !isInteger && !isReal {
+			return "TEXT"
+		}
+	}
+
+	switch {
+	case !seen:
+		return "TEXT"
+	case isInteger:
+		return "INTEGER"
+	default:
+		return "REAL"
+	}
+}
+
+// ImportCSV streams CSV from r into tableName, creating the table with
+// inferred column types when opts.Create is set. Rows go in batches of
+// opts.BatchSize, each in its own transaction. In abort mode the whole
+// import is a single transaction instead, so a bad row leaves the
+// database as it was; it holds the write lock until the import ends, and
+// writes from elsewhere wait or fail meanwhile. Problems with individual rows are reported in the
+// result; an error is returned only when the import cannot run at all.
+func (db *DB) ImportCSV(ctx context.Context, tableName string, r io.Reader, opts models.CSVImportOptions) (*models.ImportResult, error) {
+	if db.readonly {
+		return nil, fmt.Errorf("database is in read-only mode")
+	}
+	if err := db.notInSession(ctx, "CSV import"); err != nil {
+		return nil, err
+	}
+
+	switch opts.Mode {
+	case "":
+		opts.Mode = models.ImportAbort
+	case models.ImportAbort, models.ImportSkip:
+	default:
+		return nil, inputErrorf("mode must be %s or %s", models.ImportAbort, models.ImportSkip)
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+	if batchSize > maxImportBatchSize {
+		batchSize = maxImportBatchSize
+	}
+
+	text, err := decodeText(r, opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newRecordReader(text, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var header []string
+	if opts.Header {
+		header, err = reader.Read()
+		if err == io.EOF {
+			return nil, inputErrorf("CSV file is empty")
+		}
+		if err != nil {
+			return nil, inputErrorf("failed to read header: %v", err)
+		}
+	}
+
+	sampleSize := 1
+	if opts.Create {
+		sampleSize = importSampleRows
+	}
+	var pending []csvRecord
+	for len(pending) < sampleSize {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return nil, err
+		}
+		pending = append(pending, csvRecord{fields: fields, line: reader.Line(), err: err})
+	}
+
+	width := len(header)
+	if header == nil {
+		for _, rec := range pending {
+			if rec.err == nil {
+				width = len(rec.fields)
+				break
+			}
+		}
+	}
+	if width == 0 {
+		return nil, inputErrorf("CSV file has no columns")
+	}
+
+	result := &models.ImportResult{Table: tableName, Errors: []models.ImportRowError{}}
+
+	var (
+		targets   []string
+		createSQL string
+	)
+	if opts.Create {
+		targets, createSQL, result.Columns, err = db.planImportTable(ctx, tableName, header, width, pending, opts)
+	} else {
+		targets, err = db.mapImportColumns(ctx, tableName, header, width, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var columns, placeholders []string
+	for _, target := range targets {
+		if target != "" {
+			columns = append(columns, quoteIdent(target))
+			placeholders = append(placeholders, "?")
+		}
+	}
+	insertSQL := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(tableName),
+		strings.Join(columns, ", "),
+		strings.Join(placeholders, ", "),
+	)
+
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+	capture, err := db.startCapture(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer capture.stop()
+
+	var (
+		tx   *sql.Tx
+		stmt *sql.Stmt
+	)
+	begin := func() error {
+		var err error
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if createSQL != "" {
+			if _, err := tx.ExecContext(ctx, createSQL); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to create table: %w", err)
+			}
+			createSQL = ""
+			result.Created = true
+		}
+		if stmt, err = tx.PrepareContext(ctx, insertSQL); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to prepare insert: %w", err)
+		}
+		return nil
+	}
+	// commit commits the current batch and records the rows it added.
+	commit := func() error {
+		changes, err := capture.settle(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		db.record(ctx, changes)
+		capture.reset()
+		return nil
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := begin(); err != nil {
+		return nil, err
+	}
+
+	var (
+		row     int
+		inBatch int
+	)
+	next := func() (csvRecord, error) {
+		if len(pending) > 0 {
+			rec := pending[0]
+			pending = pending[1:]
+			return rec, nil
+		}
+		fields, err := reader.Read()
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return csvRecord{}, err
+		}
+		return csvRecord{fields: fields, line: reader.Line(), err: err}, nil
+	}
+
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row++
+
+		if rec.err == nil {
+			rec.err = insertImportRecord(ctx, stmt, rec.fields, targets, opts.EmptyAsNull)
+		}
+		if rec.err != nil {
+			rowErr := models.ImportRowError{Row: row, Line: rec.line, Error: rec.err.Error()}
+			if opts.Mode == models.ImportAbort {
+				tx.Rollback()
+				tx = nil
+				result.Created = false
+				result.Inserted = 0
+				result.Aborted = true
+				result.Errors = append(result.Errors, rowErr)
+				return result, nil
+			}
+
+			result.Skipped++
+			if len(result.Errors) < maxImportErrors {
+				result.Errors = append(result.Errors, rowErr)
+			} else {
+				result.ErrorsTruncated = true
+			}
+			continue
+		}
+
+		result.Inserted++
+		inBatch++
+		if opts.Mode == models.ImportSkip && inBatch == batchSize {
+			if err := commit(); err != nil {
+				return nil, fmt.Errorf("failed to commit batch: %w", err)
+			}
+			inBatch = 0
+			if err := begin(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	tx = nil
+	return result, nil
+}
+
+func insertImportRecord(ctx context.Context, stmt *sql.Stmt, fields []string, targets []string, emptyAsNull bool) error {
+	if len(fields) != len(targets) {
+		return fmt.Errorf("expected %d fields, got %d", len(targets), len(fields))
+	}
+
+	args := make([]interface{}, 0, len(targets))
+	for i, target := range targets {
+		if target == "" {
+			continue
+		}
+		if emptyAsNull && fields[i] == "" {
+			args = append(args, nil)
+		} else {
+			args = append(args, fields[i])
+		}
+	}
+
+	_, err := stmt.ExecContext(ctx, args...)
+	return err
+}
+
+// mappingTarget looks up the mapping for the CSV column at index i, by
+// header name first and then by 1-based position.
+func mappingTarget(mapping map[string]string, header []string, i int) (string, bool) {
+	if header != nil {
+		if target, ok := mapping[header[i]]; ok {
+			return target, true
+		}
+	}
+	target, ok := mapping[strconv.Itoa(i+1)]
+	return target, ok
+}
+
+func checkMappingKeys(mapping map[string]string, header []string, width int) error {
+	for key := range mapping {
+		found := false
+		for i := 0; i < width && !found; i++ {
+			found = (header != nil && header[i] == key) || strconv.Itoa(i+1) == key
+		}
+		if !found {
+			return inputErrorf("mapping refers to unknown CSV column %q", key)
+		}
+	}
+	return nil
+}
+
+// mapImportColumns resolves which table column each CSV column goes to,
+// "" for CSV columns that are skipped. Without a mapping, header names
+// are matched to column names, or columns are taken in table order when
+// there is no header.
+func (db *DB) mapImportColumns(ctx context.Context, tableName string, header []string, width int, opts models.CSVImportOptions) ([]string, error) {
+	if err := db.requireEditable(ctx, tableName); err != nil {
+		return nil, err
+	}
+	columns, err := db.getColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	canonical := make(map[string]string, len(columns))
+	for _, col := range columns {
+		canonical[strings.ToLower(col.Name)] = col.Name
+	}
+
+	targets := make([]string, width)
+	switch {
+	case opts.Mapping != nil:
+		if err := checkMappingKeys(opts.Mapping, header, width); err != nil {
+			return nil, err
+		}
+		for i := range targets {
+			target, _ := mappingTarget(opts.Mapping, header, i)
+			if target == "" {
+				continue
+			}
+			name, ok := canonical[strings.ToLower(target)]
+			if !ok {
+				return nil, inputErrorf("%s has no column %s", tableName, target)
+			}
+			targets[i] = name
+		}
+
+	case header != nil:
+		for i, h := range header {
+			name, ok := canonical[strings.ToLower(strings.TrimSpace(h))]
+			if !ok {
+				return nil, inputErrorf("CSV column %q does not match a column of %s; map or skip it", h, tableName)
+			}
+			targets[i] = name
+		}
+
+	default:
+		if width > len(columns) {
+			return nil, inputErrorf("CSV has %d columns but %s has only %d", width, tableName, len(columns))
+		}
+		for i := range targets {
+			targets[i] = columns[i].Name
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, target := range targets {
+		if target == "" {
+			continue
+		}
+		if seen[target] {
+			return nil, inputErrorf("column %s is mapped more than once", target)
+		}
+		seen[target] = true
+	}
+	if len(seen) == 0 {
+		return nil, inputErrorf("no CSV columns are mapped to the table")
+	}
+
+	return targets, nil
+}
+
+// planImportTable names and types the columns of a table to be created
+// from the CSV, and returns its CREATE TABLE statement. The mapping may
+// rename CSV columns or skip them.
+func (db *DB) planImportTable(ctx context.Context, tableName string, header []string, width int, sample []csvRecord, opts models.CSVImportOptions) ([]string, string, []models.ColumnDefinition, error) {
+	inUse, err := db.nameInUse(ctx, tableName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if inUse {
+		return nil, "", nil, inputErrorf("%s already exists", tableName)
+	}
+	if err := checkMappingKeys(opts.Mapping, header, width); err != nil {
+		return nil, "", nil, err
+	}
+
+	targets := make([]string, width)
+	def := models.TableDefinition{Name: tableName}
+	for i := range targets {
+		name := fmt.Sprintf("column%d", i+1)
+		if header != nil && strings.TrimSpace(header[i]) != "" {
+			name = strings.TrimSpace(header[i])
+		}
+		if target, ok := mappingTarget(opts.Mapping, header, i); ok {
+			name = target
+		}
+		if name == "" {
+			continue
+		}
+		targets[i] = name
+
+		var values []string
+		for _, rec := range sample {
+			if rec.err == nil && i < len(rec.fields) {
+				values = append(values, rec.fields[i])
+			}
+		}
+		def.Columns = append(def.Columns, models.ColumnDefinition{Name: name, Type: inferColumnType(values)})
+	}
+
+	createSQL, err := buildCreateTable(def, tableName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return targets, createSQL, def.Columns, nil
+}
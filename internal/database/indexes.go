@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+var indexOrigins = map[string]string{
+	"c":  models.IndexOriginUser,
+	"u":  models.IndexOriginUnique,
+	"pk": models.IndexOriginPrimaryKey,
+}
+
+func (db *DB) GetIndexes(ctx context.Context, tableName string) ([]models.Index, error) {
+	if _, err := db.getObjectInfo(ctx, tableName); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.q(ctx).QueryContext(ctx, `
+		SELECT il.name, il."unique", il.origin, il.partial, m.sql
+		FROM pragma_index_list(?) AS il
+		LEFT JOIN sqlite_master AS m ON m.type = 'index' AND m.name = il.name
+		ORDER BY il.name
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexes: %w", err)
+	}
+	defer rows.Close()
+
+	var indexes []models.Index
+	for rows.Next() {
+		var (
+			index     models.Index
+			unique    int
+			origin    string
+			partial   int
+			createSQL sql.NullString
+		)
+		if err := rows.Scan(&index.Name, &unique, &origin, &partial, &createSQL); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+
+		index.Unique = unique == 1
+		index.Origin = indexOrigins[origin]
+		index.Partial = partial == 1
+		if index.Partial && createSQL.Valid {
+			index.Where = indexWhereClause(createSQL.String)
+		}
+
+		indexes = append(indexes, index)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range indexes {
+		columns, err := db.getIndexColumns(ctx, indexes[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		indexes[i].Columns = columns
+	}
+
+	return indexes, nil
+}
+
+func (db *DB) getIndexColumns(ctx context.Context, indexName string) ([]models.IndexColumn, error) {
+	rows, err := db.q(ctx).QueryContext(ctx,
+		"SELECT cid, name, desc, coll FROM pragma_index_xinfo(?) WHERE key = 1 ORDER BY seqno",
+		indexName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query index columns: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []models.IndexColumn
+	for rows.Next() {
+		var (
+			cid  int
+			name sql.NullString
+			desc int
+			coll sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &desc, &coll); err != nil {
+			return nil, fmt.Errorf("failed to scan index column: %w", err)
+		}
+
+		col := models.IndexColumn{
+			Name:      name.String,
+			Desc:      desc == 1,
+			Collation: coll.String,
+		}
+		switch cid {
+		case -1:
+			col.Name = "rowid"
+		case -2:
+			col.Expression = true
+		}
+
+		columns = append(columns, col)
+	}
+
+	return columns, rows.Err()
+}
+
+func (db *DB) CreateIndex(ctx context.Context, tableName string, req models.CreateIndexRequest) error {
+	if db.readonly {
+		return fmt.Errorf("database is in read-only mode")
+	}
+
+	if req.Name == "" {
+		return inputErrorf("index name is required")
+	}
+	if len(req.Columns) == 0 {
+		return inputErrorf("index needs at least one column")
+	}
+
+	info, err := db.getObjectInfo(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	if info.objType != models.TableTypeTable {
+		return inputErrorf("indexes can only be created on ordinary tables")
+	}
+
+	schema, err := db.getColumns(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	// Column names are case-insensitive in SQLite, as here.
+	known := make(map[string]string, len(schema))
+	for _, col := range schema {
+		known[strings.ToLower(col.Name)] = col.Name
+	}
+
+	var terms []string
+	for _, col := range req.Columns {
+		name, ok := known[strings.ToLower(col.Name)]
+		if !ok {
+			return inputErrorf("unknown column %q", col.Name)
+		}
+		term := quoteIdent(name)
+		if col.Desc {
+			term += " DESC"
+		}
+		terms = append(terms, term)
+	}
+
+	query := "CREATE INDEX"
+	if req.Unique {
+		query = "CREATE UNIQUE INDEX"
+	}
+	query = fmt.Sprintf("%s %s ON %s (%s)", query, quoteIdent(req.Name), quoteIdent(tableName), strings.Join(terms, ", "))
+
+	if where := strings.TrimSpace(req.Where); where != "" {
+		if hasStatementSeparator(where) {
+			return inputErrorf("index WHERE clause must be a single expression")
+		}
+		query += " WHERE " + where
+	}
+
+	if _, err := db.q(ctx).ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) DropIndex(ctx context.Context, tableName, indexName string) error {
+	if db.readonly {
+		return fmt.Errorf("database is in read-only mode")
+	}
+
+	var origin string
+	err := db.q(ctx).QueryRowContext(ctx, "SELECT origin FROM pragma_index_list(?) WHERE name = ?", tableName, indexName).Scan(&origin)
+	if err == sql.ErrNoRows {
+		return inputErrorf("index %s not found on table %s", indexName, tableName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query indexes: %w", err)
+	}
+	if origin != "c" {
+		return inputErrorf("index %s belongs to a table constraint and cannot be dropped", indexName)
+	}
+
+	if _, err := db.q(ctx).ExecContext(ctx, fmt.Sprintf("DROP INDEX %s", quoteIdent(indexName))); err != nil {
+		return fmt.Errorf("failed to drop index: %w", err)
+	}
+	return nil
+}
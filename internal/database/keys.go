@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// quoteIdent quotes a table or column name for interpolation into SQL.
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// GetRowKeyColumns returns the columns that identify a single row of
+// tableName: the full primary key when one is declared, otherwise the
+// implicit rowid. WITHOUT ROWID tables always have a primary key. Views,
+// and virtual tables without a rowid, have no row key and return nil.
+func (db *DB) GetRowKeyColumns(ctx context.Context, tableName string) ([]string, error) {
+	info, err := db.getObjectInfo(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+	if info.objType == models.TableTypeView {
+		return nil, nil
+	}
+
+	rows, err := db.q(ctx).QueryContext(ctx, "SELECT name, pk FROM pragma_table_info(?)", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table schema: %w", err)
+	}
+	defer rows.Close()
+
+	type pkColumn struct {
+		name  string
+		order int
+	}
+
+	var (
+		pkColumns []pkColumn
+		names     = map[string]bool{}
+	)
+	for rows.Next() {
+		var col pkColumn
+		if err := rows.Scan(&col.name, &col.order); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		names[strings.ToLower(col.name)] = true
+		if col.order > 0 {
+			pkColumns = append(pkColumns, col)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(pkColumns) > 0 {
+		sort.Slice(pkColumns, func(i, j int) bool { return pkColumns[i].order < pkColumns[j].order })
+		columns := make([]string, len(pkColumns))
+		for i, col := range pkColumns {
+			columns[i] = col.name
+		}
+		return columns, nil
+	}
+
+	if info.withoutRowid {
+		return nil, fmt.Errorf("table %s has no primary key", tableName)
+	}
+
+	// A user column may shadow any of the rowid aliases, so pick the
+	// first one that is still free.
+	for _, alias := range []string{"rowid", "_rowid_", "oid"} {
+		if names[alias] {
+			continue
+		}
+		if info.objType == models.TableTypeVirtual {
+			// Not every virtual table module implements rowid.
+			probe := fmt.Sprintf("SELECT %s FROM %s LIMIT 0", alias, quoteIdent(tableName))
+			probeRows, err := db.q(ctx).QueryContext(ctx, probe)
+			if err != nil {
+				return nil, nil
+			}
+			probeRows.Close()
+		}
+		return []string{alias}, nil
+	}
+
+	return nil, nil
+}
+
+// keyWhereClause builds a WHERE clause matching exactly one row by key.
+// Every key column must be present so a partial key can never match
+// more rows than intended, and IS is used so NULL key parts still match.
+func keyWhereClause(keyColumns []string, key models.RowKey) (string, []interface{}, error) {
+	if len(keyColumns) == 0 {
+		return "", nil, inputErrorf("rows of this table cannot be addressed individually")
+	}
+	if len(key) != len(keyColumns) {
+		return "", nil, inputErrorf("row key must specify exactly these columns: %s", strings.Join(keyColumns, ", "))
+	}
+
+	var (
+		clauses []string
+		args    []interface{}
+	)
+	for _, col := range keyColumns {
+		val, ok := key[col]
+		if !ok {
+			return "", nil, inputErrorf("row key must specify exactly these columns: %s", strings.Join(keyColumns, ", "))
+		}
+		clauses = append(clauses, fmt.Sprintf("%s IS ?", quoteIdent(col)))
+		args = append(args, plainValue(val))
+	}
+
+	return strings.Join(clauses, " AND "), args, nil
+}
+
+func requireOneRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrRowNotFound
+	}
+	return nil
+}
+
+// writeRow runs an INSERT or UPDATE of a single row and returns the key
+// of the row written, in a transaction of its own so the change is
+// recorded. The key is read back with RETURNING, so it includes
+// values the database assigned; virtual tables do not support RETURNING,
+// so for them keyFromResult derives it instead. A nil key means the table
+// has no row key.
+func (db *DB) writeRow(ctx context.Context, tableName string, keyColumns []string, query string, args []interface{}, keyFromResult func(sql.Result) (models.RowKey, error)) (models.RowKey, error) {
+	info, err := db.getObjectInfo(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var key models.RowKey
+	err = db.inTransaction(ctx, func(q querier) error {
+		var err error
+		key, err = writeRowWith(ctx, q, info, keyColumns, query, args, keyFromResult)
+		return err
+	})
+	return key, err
+}
+
+func writeRowWith(ctx context.Context, q querier, info *objectInfo, keyColumns []string, query string, args []interface{}, keyFromResult func(sql.Result) (models.RowKey, error)) (models.RowKey, error) {
+	if len(keyColumns) == 0 || info.objType == models.TableTypeVirtual {
+		result, err := q.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		if len(keyColumns) == 0 {
+			return nil, requireOneRow(result)
+		}
+		return keyFromResult(result)
+	}
+
+	quoted := make([]string, len(keyColumns))
+	for i, col := range keyColumns {
+		quoted[i] = quoteIdent(col)
+	}
+	rows, err := q.QueryContext(ctx, query+" RETURNING "+strings.Join(quoted, ", "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrRowNotFound
+	}
+	values := make([]interface{}, len(keyColumns))
+	valuePtrs := make([]interface{}, len(keyColumns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, fmt.Errorf("failed to scan row key: %w", err)
+	}
+
+	key := models.RowKey{}
+	for i, col := range keyColumns {
+		if b, ok := values[i].([]byte); ok {
+			values[i] = string(b)
+		}
+		key[col] = values[i]
+	}
+	return key, rows.Close()
+}
+
+// getRow reads a single row by key, with its columns in the same order
+// as table data. It returns nil, nil for a nil key.
+func (db *DB) getRow(ctx context.Context, tableName string, keyColumns []string, key models.RowKey) (*models.Row, error) {
+	if key == nil {
+		return nil, nil
+	}
+
+	where, args, err := keyWhereClause(keyColumns, key)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.q(ctx).QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE %s", quoteIdent(tableName), where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query row: %w", err)
+	}
+	defer rows.Close()
+
+	data, err := scanTableData(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Rows) == 0 {
+		return nil, ErrRowNotFound
+	}
+	return &models.Row{Columns: data.Columns, Values: data.Rows[0], Key: key}, nil
+}
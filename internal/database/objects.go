@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// objectInfo describes a table-like object in the main schema.
+type objectInfo struct {
+	objType      string
+	withoutRowid bool
+	strict       bool
+}
+
+func classifyObject(name, listType string) string {
+	switch {
+	case strings.HasPrefix(strings.ToLower(name), "sqlite_"):
+		return models.TableTypeInternal
+	case listType == "view":
+		return models.TableTypeView
+	case listType == "virtual":
+		return models.TableTypeVirtual
+	case listType == "shadow":
+		return models.TableTypeShadow
+	default:
+		return models.TableTypeTable
+	}
+}
+
+func (db *DB) getObjectInfo(ctx context.Context, name string) (*objectInfo, error) {
+	var (
+		listType string
+		wr       int
+		strict   int
+	)
+	err := db.q(ctx).QueryRowContext(ctx,
+		"SELECT type, wr, strict FROM pragma_table_list WHERE schema = 'main' AND name = ?",
+		name,
+	).Scan(&listType, &wr, &strict)
+	if err == sql.ErrNoRows {
+		return nil, inputErrorf("table not found: %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table info: %w", err)
+	}
+
+	return &objectInfo{
+		objType:      classifyObject(name, listType),
+		withoutRowid: wr == 1,
+		strict:       strict == 1,
+	}, nil
+}
+
+// requireEditable rejects writes to views and to the tables SQLite
+// manages itself.
+func (db *DB) requireEditable(ctx context.Context, name string) error {
+	info, err := db.getObjectInfo(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !models.IsEditableType(info.objType) {
+		return inputErrorf("%s is a read-only %s", name, info.objType)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// orderColumn is one term of the ORDER BY used for paging.
+type orderColumn struct {
+	name string
+	desc bool
+}
+
+// resolveOrder validates the requested sort against the table and
+// appends the row key as a tiebreaker, so the order is total and stable
+// between pages.
+func resolveOrder(sorts []models.SortColumn, columns []models.Column, keyColumns []string) ([]orderColumn, error) {
+	// Sort columns may be named in any case; each maps to its name as
+	// declared, so one column cannot appear twice in the ordering.
+	known := make(map[string]string, len(columns)+len(keyColumns))
+	for _, col := range columns {
+		known[strings.ToLower(col.Name)] = col.Name
+	}
+	for _, col := range keyColumns {
+		if _, ok := known[strings.ToLower(col)]; !ok {
+			known[strings.ToLower(col)] = col
+		}
+	}
+
+	var (
+		order []orderColumn
+		seen  = map[string]bool{}
+	)
+	for _, s := range sorts {
+		name, ok := known[strings.ToLower(s.Column)]
+		if !ok {
+			return nil, inputErrorf("unknown sort column %q", s.Column)
+		}
+		if seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		order = append(order, orderColumn{name: name, desc: s.Desc})
+	}
+	for _, col := range keyColumns {
+		if !seen[strings.ToLower(col)] {
+			order = append(order, orderColumn{name: col})
+		}
+	}
+
+	return order, nil
+}
+
+func orderByClause(order []orderColumn) string {
+	terms := make([]string, len(order))
+	for i, col := range order {
+		terms[i] = quoteIdent(col.name)
+		if col.desc {
+			terms[i] += " DESC"
+		}
+	}
+	return strings.Join(terms, ", ")
+}
+
+// orderSignature identifies an ordering so a cursor cannot be replayed
+// against a different sort.
+func orderSignature(order []orderColumn) string {
+	terms := make([]string, len(order))
+	for i, col := range order {
+		terms[i] = col.name
+		if col.desc {
+			terms[i] = "-" + terms[i]
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// keysetCondition selects the rows strictly after values in the given
+// order. SQLite sorts NULL before every other value, which the per-column
+// comparisons below take into account.
+func keysetCondition(order []orderColumn, values []interface{}) (string, []interface{}) {
+	var (
+		branches []string
+		args     []interface{}
+	)
+
+	for i := range order {
+		after, afterArgs := afterValue(order[i], values[i])
+		if after == "" {
+			continue
+		}
+
+		var (
+			terms     []string
+			termsArgs []interface{}
+		)
+		for j := 0; j < i; j++ {
+			terms = append(terms, fmt.Sprintf("%s IS ?", quoteIdent(order[j].name)))
+			termsArgs = append(termsArgs, values[j])
+		}
+		terms = append(terms, after)
+		termsArgs = append(termsArgs, afterArgs...)
+
+		branches = append(branches, "("+strings.Join(terms, " AND ")+")")
+		args = append(args, termsArgs...)
+	}
+
+	if len(branches) == 0 {
+		return "0", nil
+	}
+	return "(" + strings.Join(branches, " OR ") + ")", args
+}
+
+// afterValue returns the condition for a column value sorting strictly
+// after v, or "" if nothing can.
+func afterValue(col orderColumn, v interface{}) (string, []interface{}) {
+	name := quoteIdent(col.name)
+	switch {
+	case v == nil && col.desc:
+		return "", nil
+	case v == nil:
+		return name + " IS NOT NULL", nil
+	case col.desc:
+		return fmt.Sprintf("(%s < ? OR %s IS NULL)", name, name), []interface{}{v}
+	default:
+		return name + " > ?", []interface{}{v}
+	}
+}
+
+type cursorPayload struct {
+	Order  string        `json:"o"`
+	Values []cursorValue `json:"v"`
+}
+
+// cursorValue keeps the storage class of a value so it round-trips
+// exactly; JSON numbers alone would lose 64-bit integers and blobs.
+type cursorValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v,omitempty"`
+}
+
+func encodeCursor(order []orderColumn, values []interface{}) string {
+	payload := cursorPayload{Order: orderSignature(order)}
+	for _, v := range values {
+		var cv cursorValue
+		switch v := v.(type) {
+		case nil:
+			cv.Type = "n"
+		case int64:
+			cv = cursorValue{Type: "i", Value: strconv.FormatInt(v, 10)}
+		case float64:
+			cv = cursorValue{Type: "f", Value: strconv.FormatFloat(v, 'g', -1, 64)}
+		case []byte:
+			cv = cursorValue{Type: "b", Value: base64.StdEncoding.EncodeToString(v)}
+		default:
+			cv = cursorValue{Type: "s", Value: fmt.Sprint(v)}
+		}
+		payload.Values = append(payload.Values, cv)
+	}
+
+	raw, _ := json.Marshal(payload)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(cursor string, order []orderColumn) ([]interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, inputErrorf("invalid cursor")
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, inputErrorf("invalid cursor")
+	}
+
+	if payload.Order != orderSignature(order) || len(payload.Values) != len(order) {
+		return nil, inputErrorf("cursor does not match the requested sort")
+	}
+
+	values := make([]interface{}, len(payload.Values))
+	for i, cv := range payload.Values {
+		switch cv.Type {
+		case "n":
+			values[i] = nil
+		case "i":
+			values[i], err = strconv.ParseInt(cv.Value, 10, 64)
+		case "f":
+			values[i], err = strconv.ParseFloat(cv.Value, 64)
+		case "b":
+			values[i], err = base64.StdEncoding.DecodeString(cv.Value)
+		case "s":
+			values[i] = cv.Value
+		default:
+			err = fmt.Errorf("unknown type %q", cv.Type)
+		}
+		if err != nil {
+			return nil, inputErrorf("invalid cursor")
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// bindArgs converts the parameters of a models.QueryRequest to driver
+// arguments. An array binds by position and an object by name; a name
+// may be given with its :, @ or $ prefix. JSON numbers that are whole
+// bind as integers, so they compare equal to INTEGER values.
+func bindArgs(params interface{}) ([]interface{}, error) {
+	switch params := params.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		args := make([]interface{}, len(params))
+		for i, value := range params {
+			arg, err := bindValue(value)
+			if err != nil {
+				return nil, inputErrorf("parameter %d %v", i+1, err)
+			}
+			args[i] = arg
+		}
+		return args, nil
+	case map[string]interface{}:
+		args := make([]interface{}, 0, len(params))
+		for name, value := range params {
+			bare := strings.TrimLeft(name, ":@$")
+			if r := []rune(bare); len(r) == 0 || !unicode.IsLetter(r[0]) {
+				return nil, inputErrorf("parameter name %q must start with a letter", name)
+			}
+			arg, err := bindValue(value)
+			if err != nil {
+				return nil, inputErrorf("parameter %q %v", name, err)
+			}
+			args = append(args, sql.Named(bare, arg))
+		}
+		return args, nil
+	}
+	return nil, inputErrorf("params must be an array or an object")
+}
+
+func bindValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, string, bool, int64:
+		return v, nil
+	case json.Number:
+		return bindValue(plainValue(v))
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= 1<<53 {
+			return int64(v), nil
+		}
+		return v, nil
+	}
+	return nil, errors.New("must be a string, number, boolean or null")
+}
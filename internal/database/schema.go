@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -8,16 +9,18 @@ import (
 	"github.com/rzhade3/sqlite-webgui/internal/models"
 )
 
-func (db *DB) GetTables() ([]models.Table, error) {
+// GetTables lists the tables, views and virtual tables in the main
+// schema. Shadow tables and SQLite's internal tables are only included
+// when includeSystem is set.
+func (db *DB) GetTables(ctx context.Context, includeSystem bool) ([]models.Table, error) {
 	query := `
-		SELECT name 
-		FROM sqlite_master 
-		WHERE type='table' 
-		AND name NOT LIKE 'sqlite_%'
+		SELECT name, type
+		FROM pragma_table_list
+		WHERE schema = 'main'
 		ORDER BY name
 	`
 
-	rows, err := db.conn.Query(query)
+	rows, err := db.q(ctx).QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query tables: %w", err)
 	}
@@ -25,13 +28,22 @@ func (db *DB) GetTables() ([]models.Table, error) {
 
 	var tables []models.Table
 	for rows.Next() {
-		var table models.Table
-		if err := rows.Scan(&table.Name); err != nil {
+		var (
+			table    models.Table
+			listType string
+		)
+		if err := rows.Scan(&table.Name, &listType); err != nil {
 			return nil, fmt.Errorf("failed to scan table: %w", err)
 		}
 
-		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", table.Name)
-		if err := db.conn.QueryRow(countQuery).Scan(&table.RowCount); err != nil {
+		table.Type = classifyObject(table.Name, listType)
+		table.ReadOnly = db.readonly || !models.IsEditableType(table.Type)
+		if !includeSystem && (table.Type == models.TableTypeShadow || table.Type == models.TableTypeInternal) {
+			continue
+		}
+
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdent(table.Name))
+		if err := db.q(ctx).QueryRowContext(ctx, countQuery).Scan(&table.RowCount); err != nil {
 			table.RowCount = 0
 		}
 
@@ -41,9 +53,46 @@ func (db *DB) GetTables() ([]models.Table, error) {
 	return tables, rows.Err()
 }
 
-func (db *DB) GetTableSchema(tableName string) ([]models.Column, error) {
-	query := fmt.Sprintf("PRAGMA table_info(`%s`)", tableName)
-	rows, err := db.conn.Query(query)
+// GetTableSchema returns the columns of tableName, each annotated with
+// the foreign keys it takes part in.
+func (db *DB) GetTableSchema(ctx context.Context, tableName string) ([]models.Column, error) {
+	if _, err := db.getObjectInfo(ctx, tableName); err != nil {
+		return nil, err
+	}
+	columns, err := db.getColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	foreignKeys, err := db.GetForeignKeys(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fk := range foreignKeys {
+		if fk.Unresolved {
+			continue
+		}
+		for i, from := range fk.From {
+			for j := range columns {
+				if strings.EqualFold(columns[j].Name, from) {
+					columns[j].References = append(columns[j].References, models.ColumnReference{
+						ForeignKeyID: fk.ID,
+						Table:        fk.Table,
+						Column:       fk.To[i],
+						OnUpdate:     fk.OnUpdate,
+						OnDelete:     fk.OnDelete,
+					})
+				}
+			}
+		}
+	}
+
+	return columns, nil
+}
+
+func (db *DB) getColumns(ctx context.Context, tableName string) ([]models.Column, error) {
+	rows, err := db.q(ctx).QueryContext(ctx, `SELECT cid, name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`, tableName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query table schema: %w", err)
 	}
@@ -81,17 +130,108 @@ func (db *DB) GetTableSchema(tableName string) ([]models.Column, error) {
 	return columns, rows.Err()
 }
 
-func (db *DB) GetTableData(tableName string, page, limit int) (*models.TableData, error) {
+func (db *DB) GetTableData(ctx context.Context, tableName string, page, limit int) (*models.TableData, error) {
+	return db.QueryTableData(ctx, tableName, models.TableDataRequest{Page: page, Limit: limit})
+}
+
+// tableQuery is the filtered and ordered scan of a table that both the
+// data grid and exports are built on.
+type tableQuery struct {
+	keyColumns []string
+	order      []orderColumn
+	where      string
+	args       []interface{}
+}
+
+func (db *DB) prepareTableQuery(ctx context.Context, tableName string, req models.TableDataRequest) (*tableQuery, error) {
+	keyColumns, err := db.GetRowKeyColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := db.getColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	where, whereArgs, err := compileFilter(req.Filter, schema)
+	if err != nil {
+		return nil, err
+	}
+	if where != "" {
+		where = " WHERE " + where
+	}
+
+	order, err := resolveOrder(req.Sort, schema, keyColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tableQuery{keyColumns: keyColumns, order: order, where: where, args: whereArgs}, nil
+}
+
+func (q *tableQuery) orderBy() string {
+	if len(q.order) == 0 {
+		return ""
+	}
+	return " ORDER BY " + orderByClause(q.order)
+}
+
+func (db *DB) QueryTableData(ctx context.Context, tableName string, req models.TableDataRequest) (*models.TableData, error) {
+	page, limit := req.Page, req.Limit
 	offset := (page - 1) * limit
 
+	q, err := db.prepareTableQuery(ctx, tableName, req)
+	if err != nil {
+		return nil, err
+	}
+	keyColumns, order, where, whereArgs := q.keyColumns, q.order, q.where, q.args
+
 	var total int
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", tableName)
-	if err := db.conn.QueryRow(countQuery).Scan(&total); err != nil {
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", quoteIdent(tableName), where)
+	if err := db.q(ctx).QueryRowContext(ctx, countQuery, whereArgs...).Scan(&total); err != nil {
 		return nil, fmt.Errorf("failed to count rows: %w", err)
 	}
 
-	dataQuery := fmt.Sprintf("SELECT * FROM `%s` LIMIT ? OFFSET ?", tableName)
-	rows, err := db.conn.Query(dataQuery, limit, offset)
+	// With a cursor, the page starts after the last row the client saw
+	// instead of skipping OFFSET rows, so deep pages stay cheap.
+	if req.Cursor != "" {
+		if len(keyColumns) == 0 {
+			return nil, inputErrorf("%s has no row key and does not support cursors", tableName)
+		}
+		after, err := decodeCursor(req.Cursor, order)
+		if err != nil {
+			return nil, err
+		}
+		keyset, keysetArgs := keysetCondition(order, after)
+		if where == "" {
+			where = " WHERE " + keyset
+		} else {
+			where += " AND " + keyset
+		}
+		whereArgs = append(whereArgs, keysetArgs...)
+		offset = 0
+	}
+
+	// The order columns are selected ahead of * so every row carries its
+	// identity and cursor position, even when they include the hidden rowid.
+	// Unary + leaves a value as stored but drops the declared type, so
+	// the driver does not turn DATE and DATETIME text into time.Time,
+	// which would no longer match the stored value.
+	var selectList []string
+	for _, col := range order {
+		selectList = append(selectList, "+"+quoteIdent(col.name))
+	}
+	selectList = append(selectList, "*")
+
+	dataQuery := fmt.Sprintf(
+		"SELECT %s FROM %s%s%s LIMIT ? OFFSET ?",
+		strings.Join(selectList, ", "),
+		quoteIdent(tableName),
+		where,
+		q.orderBy(),
+	)
+	rows, err := db.q(ctx).QueryContext(ctx, dataQuery, append(whereArgs, limit+1, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query table data: %w", err)
 	}
@@ -102,7 +242,17 @@ func (db *DB) GetTableData(tableName string, page, limit int) (*models.TableData
 		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
 
-	var data [][]interface{}
+	orderIndex := make(map[string]int, len(order))
+	for i, col := range order {
+		orderIndex[col.name] = i
+	}
+
+	var (
+		data       [][]models.Cell
+		keys       []models.RowKey
+		nextCursor string
+		hasMore    bool
+	)
 	for rows.Next() {
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
@@ -114,106 +264,236 @@ func (db *DB) GetTableData(tableName string, page, limit int) (*models.TableData
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		for i, v := range values {
-			if b, ok := v.([]byte); ok {
-				values[i] = string(b)
-			}
+		// One row past the limit is fetched only to learn whether
+		// another page exists.
+		if len(data) == limit {
+			hasMore = true
+			break
 		}
 
-		data = append(data, values)
+		position := append([]interface{}(nil), values[:len(order)]...)
+
+		key := models.RowKey{}
+		for _, col := range keyColumns {
+			key[col] = values[orderIndex[col]]
+		}
+
+		keys = append(keys, key)
+		data = append(data, newCells(values[len(order):]))
+		nextCursor = encodeCursor(order, position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Without a row key the order is not total, so a cursor could skip
+	// or repeat rows; such objects page by offset only.
+	if !hasMore || len(keyColumns) == 0 {
+		nextCursor = ""
 	}
 
 	return &models.TableData{
-		Columns: columns,
-		Rows:    data,
-		Total:   total,
-		Page:    page,
-		Limit:   limit,
-	}, rows.Err()
+		Columns:    columns[len(order):],
+		Rows:       data,
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		KeyColumns: keyColumns,
+		Keys:       keys,
+		NextCursor: nextCursor,
+	}, nil
 }
 
-func (db *DB) InsertRow(tableName string, values map[string]interface{}) error {
+// InsertRow inserts a row and returns it as stored, including values
+// the database assigned, such as defaults and autoincrement IDs. The row
+// is nil for tables whose rows cannot be addressed individually.
+func (db *DB) InsertRow(ctx context.Context, tableName string, values map[string]interface{}) (*models.Row, error) {
 	if db.readonly {
-		return fmt.Errorf("database is in read-only mode")
+		return nil, fmt.Errorf("database is in read-only mode")
+	}
+
+	if err := db.requireEditable(ctx, tableName); err != nil {
+		return nil, err
+	}
+
+	assignments, err := db.coerceValues(ctx, tableName, values, true)
+	if err != nil {
+		return nil, err
 	}
 
 	var columns []string
 	var placeholders []string
 	var args []interface{}
 
-	for col, val := range values {
-		columns = append(columns, fmt.Sprintf("`%s`", col))
+	for _, a := range assignments {
+		columns = append(columns, quoteIdent(a.column))
 		placeholders = append(placeholders, "?")
-		args = append(args, val)
+		args = append(args, a.value)
 	}
 
 	query := fmt.Sprintf(
-		"INSERT INTO `%s` (%s) VALUES (%s)",
-		tableName,
+		"INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(tableName),
 		strings.Join(columns, ", "),
 		strings.Join(placeholders, ", "),
 	)
+	if len(columns) == 0 {
+		query = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", quoteIdent(tableName))
+	}
+
+	keyColumns, err := db.GetRowKeyColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := db.conn.Exec(query, args...)
-	return err
+	key, err := db.writeRow(ctx, tableName, keyColumns, query, args, func(result sql.Result) (models.RowKey, error) {
+		// Virtual tables are keyed by rowid when they have a key at all.
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		return models.RowKey{keyColumns[0]: id}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.getRow(ctx, tableName, keyColumns, key)
 }
 
-func (db *DB) UpdateRow(tableName string, pkColumn string, pkValue interface{}, values map[string]interface{}) error {
+// UpdateRow updates the row identified by key and returns it as stored,
+// under its new key if the update changed it.
+func (db *DB) UpdateRow(ctx context.Context, tableName string, key models.RowKey, values map[string]interface{}) (*models.Row, error) {
 	if db.readonly {
-		return fmt.Errorf("database is in read-only mode")
+		return nil, fmt.Errorf("database is in read-only mode")
 	}
 
-	var setClauses []string
-	var args []interface{}
+	if err := db.requireEditable(ctx, tableName); err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, inputErrorf("no values to update")
+	}
 
-	for col, val := range values {
-		setClauses = append(setClauses, fmt.Sprintf("`%s` = ?", col))
-		args = append(args, val)
+	keyColumns, err := db.GetRowKeyColumns(ctx, tableName)
+	if err != nil {
+		return nil, err
 	}
 
-	args = append(args, pkValue)
+	where, keyArgs, err := keyWhereClause(keyColumns, key)
+	if err != nil {
+		return nil, err
+	}
+
+	assignments, err := db.coerceValues(ctx, tableName, values, false)
+	if err != nil {
+		return nil, err
+	}
+	set, args := setClause(assignments)
+	args = append(args, keyArgs...)
 
 	query := fmt.Sprintf(
-		"UPDATE `%s` SET %s WHERE `%s` = ?",
-		tableName,
-		strings.Join(setClauses, ", "),
-		pkColumn,
+		"UPDATE %s SET %s WHERE %s",
+		quoteIdent(tableName),
+		set,
+		where,
 	)
 
-	_, err := db.conn.Exec(query, args...)
-	return err
+	newKey, err := db.writeRow(ctx, tableName, keyColumns, query, args, func(result sql.Result) (models.RowKey, error) {
+		if err := requireOneRow(result); err != nil {
+			return nil, err
+		}
+		updated := models.RowKey{}
+		for _, col := range keyColumns {
+			updated[col] = plainValue(key[col])
+			for _, a := range assignments {
+				if strings.EqualFold(a.column, col) && a.expr == "?" {
+					updated[col] = a.value
+				}
+			}
+		}
+		return updated, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.getRow(ctx, tableName, keyColumns, newKey)
 }
 
-func (db *DB) DeleteRow(tableName string, pkColumn string, pkValue interface{}) error {
+func (db *DB) DeleteRow(ctx context.Context, tableName string, key models.RowKey) error {
 	if db.readonly {
 		return fmt.Errorf("database is in read-only mode")
 	}
 
-	query := fmt.Sprintf("DELETE FROM `%s` WHERE `%s` = ?", tableName, pkColumn)
-	_, err := db.conn.Exec(query, pkValue)
-	return err
+	if err := db.requireEditable(ctx, tableName); err != nil {
+		return err
+	}
+
+	keyColumns, err := db.GetRowKeyColumns(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	where, args, err := keyWhereClause(keyColumns, key)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", quoteIdent(tableName), where)
+	return db.inTransaction(ctx, func(q querier) error {
+		result, err := q.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		return requireOneRow(result)
+	})
 }
 
-func (db *DB) ExecuteQuery(query string) (*models.TableData, error) {
+func (db *DB) ExecuteQuery(ctx context.Context, query string) (*models.TableData, error) {
 	query = strings.TrimSpace(query)
 	
 	if query == "" {
 		return nil, fmt.Errorf("query cannot be empty")
 	}
 
-	rows, err := db.conn.Query(query)
+	rows, err := db.q(ctx).QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
+	return scanTableData(rows)
+}
+
+// scanTableData reads every row of a result into a single page.
+func scanTableData(rows *sql.Rows) (*models.TableData, error) {
+	return scanTablePage(rows, 0, 0)
+}
+
+// scanTablePage skips offset rows of a result and reads up to limit rows
+// after them, or all of them if limit is 0. Total counts the rows up to
+// the end of the page; Truncated is set when more rows follow, which is
+// learned by stepping one row further.
+func scanTablePage(rows *sql.Rows, offset, limit int) (*models.TableData, error) {
 	columns, err := rows.Columns()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
 
-	var data [][]interface{}
+	skipped := 0
+	for skipped < offset && rows.Next() {
+		skipped++
+	}
+
+	var (
+		data      [][]models.Cell
+		truncated bool
+	)
 	for rows.Next() {
+		if limit > 0 && len(data) == limit {
+			truncated = true
+			break
+		}
+
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
 		for i := range values {
@@ -224,20 +504,21 @@ func (db *DB) ExecuteQuery(query string) (*models.TableData, error) {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		for i, v := range values {
-			if b, ok := v.([]byte); ok {
-				values[i] = string(b)
-			}
-		}
-
-		data = append(data, values)
+		data = append(data, newCells(values))
 	}
 
+	page := 1
+	if limit > 0 {
+		page = offset/limit + 1
+	} else {
+		limit = len(data)
+	}
 	return &models.TableData{
-		Columns: columns,
-		Rows:    data,
-		Total:   len(data),
-		Page:    1,
-		Limit:   len(data),
+		Columns:   columns,
+		Rows:      data,
+		Total:     skipped + len(data),
+		Page:      page,
+		Limit:     limit,
+		Truncated: truncated,
 	}, rows.Err()
 }
@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// ExecuteScript runs each statement of script in order on one
+// connection, so statements like BEGIN and COMMIT in the script behave as
+// they would in the sqlite3 shell. With transaction set, the whole script
+// runs in a transaction that is rolled back if any statement fails.
+// Running stops at the first failing statement. A transaction the script
+// leaves open is rolled back, since the connection goes back to the pool.
+//
+// The running statement is interrupted when ctx is cancelled or the query
+// timeout passes, and its error then gives the cause.
+//
+// Each result holds at most one page of rows, selected by req.Page and
+// req.Limit and capped by the server's row limit, so a large result never
+// has to be held in memory. Later pages are fetched by running the
+// script again, so they are refused unless every statement only reads.
+//
+// In explain mode each statement also reports its query plan and how many
+// rows it returned in all, and the script runs in a transaction that is
+// rolled back at the end.
+//
+// In a session the script runs on the session's connection, its own
+// transaction, if any, becomes a savepoint, and statements that begin or
+// end transactions are refused so the session's stays open.
+func (db *DB) ExecuteScript(ctx context.Context, req models.QueryRequest) (*models.ScriptResult, error) {
+	script, explain := req.SQL, req.Explain
+	transaction := req.Transaction || explain
+	spans := splitStatements(script)
+	if len(spans) == 0 {
+		return nil, inputErrorf("query cannot be empty")
+	}
+	if req.Page > 1 {
+		for _, span := range spans {
+			if verb, _ := statementVerb(script[span.start:span.end]); !isReadVerb(verb) {
+				return nil, inputErrorf("only scripts of SELECT or VALUES statements can be paged")
+			}
+		}
+	}
+	args, err := bindArgs(req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cleanup must still run on the connection after ctx is done.
+	cleanup := context.WithoutCancel(ctx)
+	ctx, cancel := db.withQueryTimeout(ctx)
+	defer cancel()
+
+	session := db.session(ctx)
+	conn, err := db.dedicatedConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		defer conn.Close()
+	}
+	// Explain mode changes nothing, since it always rolls back.
+	var capture *changeCapture
+	if !explain {
+		if capture, err = db.startCapture(conn); err != nil {
+			return nil, err
+		}
+		defer capture.stop()
+	}
+	// Outside a session each statement records its changes as they are
+	// committed; in one they are all settled at the end.
+	statementCapture := capture
+	if session != nil {
+		statementCapture = nil
+	}
+	if err := statementCapture.trackTransactions(); err != nil {
+		return nil, err
+	}
+
+	begin, commit, rollback := "BEGIN", "COMMIT", "ROLLBACK"
+	if session != nil {
+		begin, commit, rollback = "SAVEPOINT script", "RELEASE script", "ROLLBACK TO script; RELEASE script"
+	}
+
+	limit := req.Limit
+	if limit <= 0 || (db.maxQueryRows > 0 && limit > db.maxQueryRows) {
+		limit = db.maxQueryRows
+	}
+	opts := statementOptions{limit: limit, countRows: explain, args: args}
+	if limit > 0 && req.Page > 1 {
+		opts.offset = (req.Page - 1) * limit
+	}
+
+	started := time.Now()
+	result := &models.ScriptResult{Statements: []models.StatementResult{}, Transaction: req.Transaction, Explain: explain}
+
+	if transaction {
+		if _, err := conn.ExecContext(ctx, begin); err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+	}
+
+	for _, span := range spans {
+		stmt := models.StatementResult{SQL: script[span.start:span.end], Offset: span.start, End: span.end}
+
+		var err error
+		verb, _ := statementVerb(stmt.SQL)
+		if session != nil && isTransactionVerb(verb) {
+			err = inputErrorf("%s cannot be used in a transaction session; commit or roll back the session instead", verb)
+		} else if explain {
+			stmt.Plan, err = explainStatement(ctx, conn, stmt.SQL, args)
+		}
+		if err == nil {
+			statementStarted := time.Now()
+			err = db.runCaptured(ctx, conn, statementCapture, verb, func() error {
+				return runStatement(ctx, conn, &stmt, opts)
+			})
+			stmt.DurationMs = milliseconds(time.Since(statementStarted))
+		}
+		if err != nil && ctx.Err() != nil {
+			err = context.Cause(ctx)
+		}
+		if err != nil {
+			stmt.Error = err.Error()
+			result.Error = err.Error()
+		}
+
+		result.Statements = append(result.Statements, stmt)
+		if err != nil {
+			break
+		}
+	}
+
+	if transaction && !explain && result.Error == "" {
+		// The rows are read before the commit, in the transaction.
+		changes, err := statementCapture.settle(cleanup, conn)
+		if err != nil {
+			result.Error = fmt.Sprintf("failed to record changes: %v", err)
+		} else if _, err := conn.ExecContext(cleanup, commit); err != nil {
+			result.Error = fmt.Sprintf("failed to commit: %v", err)
+		} else {
+			db.record(ctx, changes)
+			statementCapture.reset()
+		}
+	}
+
+	switch {
+	case session == nil:
+		// ROLLBACK only succeeds if a transaction is still open: ours
+		// after a failure, or one the script began and did not finish.
+		if _, err := conn.ExecContext(cleanup, rollback); err == nil {
+			result.RolledBack = true
+			if result.Error == "" && !explain {
+				result.Error = "the script left a transaction open; it was rolled back"
+			}
+		}
+	case transaction && (explain || result.Error != ""):
+		if _, err := conn.ExecContext(cleanup, rollback); err == nil {
+			result.RolledBack = true
+		}
+	}
+
+	if session != nil {
+		// Whatever the script left changed is part of the session now.
+		changes, err := capture.settle(cleanup, conn)
+		if err != nil && result.Error == "" {
+			result.Error = fmt.Sprintf("failed to record changes: %v", err)
+		}
+		db.record(ctx, changes)
+	}
+
+	result.DurationMs = milliseconds(time.Since(started))
+	return result, nil
+}
+
+// withQueryTimeout limits ctx to the query timeout, if there is one.
+func (db *DB) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, db.queryTimeout, fmt.Errorf("query timed out after %s", db.queryTimeout))
+}
+
+// statementOptions selects the rows a statement's result holds: limit
+// rows (all if 0) from offset on. countRows steps through the rest of the
+// result to report how many rows it has in all. args are bound to the
+// statement's parameters; those it does not use are ignored.
+type statementOptions struct {
+	offset, limit int
+	countRows     bool
+	args          []interface{}
+}
+
+// runStatement runs one statement and records its outcome in stmt.
+// Statements that return rows, writes with a RETURNING clause included,
+// report them as a result. INSERT, UPDATE and DELETE also report the rows
+// they changed, and INSERT the rowid it added. last_insert_rowid() keeps
+// its value when an INSERT adds nothing or adds to a WITHOUT ROWID table,
+// so the rowid is only reported when it changed.
+func runStatement(ctx context.Context, conn *sql.Conn, stmt *models.StatementResult, opts statementOptions) error {
+	verb, returning := statementVerb(stmt.SQL)
+	write := isWriteVerb(verb)
+	insert := verb == "INSERT" || verb == "REPLACE"
+
+	var lastID int64
+	if insert {
+		if err := conn.QueryRowContext(ctx, "SELECT last_insert_rowid()").Scan(&lastID); err != nil {
+			return err
+		}
+	}
+
+	var affected, id int64
+	if write && !returning {
+		result, err := conn.ExecContext(ctx, stmt.SQL, opts.args...)
+		if err != nil {
+			return err
+		}
+		if affected, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	} else {
+		rows, err := conn.QueryContext(ctx, stmt.SQL, opts.args...)
+		if err != nil {
+			return err
+		}
+		data, err := scanTablePage(rows, opts.offset, opts.limit)
+		if err == nil && opts.countRows {
+			returned := int64(data.Total)
+			if data.Truncated {
+				// scanTablePage stopped on a row it did not read.
+				returned++
+				for rows.Next() {
+					returned++
+				}
+				err = rows.Err()
+			}
+			stmt.RowsReturned = &returned
+		}
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if len(data.Columns) > 0 {
+			stmt.Result = data
+			stmt.Pageable = isReadVerb(verb)
+		}
+		if !write {
+			return nil
+		}
+		if err := conn.QueryRowContext(ctx, "SELECT changes(), last_insert_rowid()").Scan(&affected, &id); err != nil {
+			return err
+		}
+	}
+
+	stmt.RowsAffected = &affected
+	if insert && affected > 0 && id != lastID {
+		stmt.LastInsertID = &id
+	}
+	return nil
+}
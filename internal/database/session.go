@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+	"modernc.org/sqlite"
+)
+
+// querier runs statements on either the connection pool or a session's
+// connection.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Session is a transaction kept open across requests on a connection of
+// its own. Operations whose context carries the session, see
+// WithSession, run in its transaction and see its uncommitted changes.
+// A session must not be used by two operations at once.
+type Session struct {
+	db   *DB
+	conn *sql.Conn
+	// pending holds the changes made in the session, recorded when it
+	// commits.
+	pending []models.AuditEntry
+	// rolledBack is set when the transaction is rolled back, which SQLite
+	// does by itself after some errors.
+	rolledBack bool
+}
+
+type sessionKey struct{}
+
+// WithSession returns a context whose operations on the session's
+// database run in the session.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// session returns the session of db that ctx carries, if any.
+func (db *DB) session(ctx context.Context) *Session {
+	if s, ok := ctx.Value(sessionKey{}).(*Session); ok && s.db == db {
+		return s
+	}
+	return nil
+}
+
+// q returns what the operations of ctx run on: the connection of its
+// session, or else the pool.
+func (db *DB) q(ctx context.Context) querier {
+	if s := db.session(ctx); s != nil {
+		return s.conn
+	}
+	return db.conn
+}
+
+// dedicatedConn returns a connection for operations that need the same
+// one throughout: the session's, or else one from the pool, which the
+// caller must close.
+func (db *DB) dedicatedConn(ctx context.Context) (*sql.Conn, error) {
+	if s := db.session(ctx); s != nil {
+		return s.conn, nil
+	}
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	return conn, nil
+}
+
+// inTransaction runs fn in a transaction that is rolled back if fn
+// fails: a savepoint in the session ctx carries, or else a transaction
+// of its own. The rows fn changes are recorded once they are committed.
+func (db *DB) inTransaction(ctx context.Context, fn func(q querier) error) error {
+	cleanup := context.WithoutCancel(ctx)
+	if s := db.session(ctx); s != nil {
+		capture, err := db.startCapture(s.conn)
+		if err != nil {
+			return err
+		}
+		defer capture.stop()
+
+		if _, err := s.conn.ExecContext(ctx, "SAVEPOINT operation"); err != nil {
+			return err
+		}
+		err = fn(s.conn)
+		var changes []models.AuditEntry
+		if err == nil {
+			changes, err = capture.settle(ctx, s.conn)
+		}
+		if err != nil {
+			s.conn.ExecContext(cleanup, "ROLLBACK TO operation; RELEASE operation")
+			return err
+		}
+		if _, err := s.conn.ExecContext(cleanup, "RELEASE operation"); err != nil {
+			return err
+		}
+		db.record(ctx, changes)
+		return nil
+	}
+
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+	capture, err := db.startCapture(conn)
+	if err != nil {
+		return err
+	}
+	defer capture.stop()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	changes, err := capture.settle(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.record(ctx, changes)
+	return nil
+}
+
+// notInSession refuses operations that manage their own transaction or
+// connection state, which cannot be done inside a session.
+func (db *DB) notInSession(ctx context.Context, operation string) error {
+	if db.session(ctx) != nil {
+		return inputErrorf("%s is not available in a transaction; commit or roll back first", operation)
+	}
+	return nil
+}
+
+// BeginSession opens a transaction on a dedicated connection. It takes
+// the write lock at once, so its writes cannot later fail because
+// another connection is writing; in turn, writes from outside the
+// session fail until it ends.
+func (db *DB) BeginSession(ctx context.Context) (*Session, error) {
+	if db.readonly {
+		return nil, fmt.Errorf("database is in read-only mode")
+	}
+
+	conn, err := db.conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	s := &Session{db: db, conn: conn}
+	err = watchTransactions(conn, func(committed bool) {
+		if !committed {
+			s.rolledBack = true
+		}
+	})
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+	}
+	if err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return s, nil
+}
+
+// Active reports whether the session's transaction is still open. SQLite
+// rolls a transaction back by itself after some errors, an interrupted
+// write among them, so this is checked after each use.
+func (s *Session) Active() bool {
+	return !s.rolledBack
+}
+
+// watchTransactions has onEnd called whenever a transaction on conn
+// commits or rolls back, including when SQLite rolls one back by itself
+// after an error. Rolling back to a savepoint does not count. A nil onEnd
+// stops watching.
+func watchTransactions(conn *sql.Conn, onEnd func(committed bool)) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		hooks, ok := driverConn.(sqlite.HookRegisterer)
+		if !ok {
+			return fmt.Errorf("the SQLite driver cannot report transaction state")
+		}
+		if onEnd == nil {
+			hooks.RegisterCommitHook(nil)
+			hooks.RegisterRollbackHook(nil)
+			return nil
+		}
+		hooks.RegisterCommitHook(func() int32 {
+			onEnd(true)
+			return 0
+		})
+		hooks.RegisterRollbackHook(func() { onEnd(false) })
+		return nil
+	})
+}
+
+// close stops watching the session's connection and releases it.
+func (s *Session) close() error {
+	watchTransactions(s.conn, nil)
+	return s.conn.Close()
+}
+
+// Commit commits the session, records the changes made in it, and
+// releases its connection. If the commit fails, for example on a deferred
+// foreign key violation, the session stays open so the problem can be
+// fixed.
+func (s *Session) Commit(ctx context.Context) error {
+	if _, err := s.conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return inputErrorf("failed to commit: %v", err)
+	}
+	if s.db.recorder != nil && len(s.pending) > 0 {
+		s.db.recorder(context.WithoutCancel(ctx), s.pending)
+	}
+	s.pending = nil
+	return s.close()
+}
+
+// Rollback discards the session's changes and releases its connection.
+func (s *Session) Rollback(ctx context.Context) error {
+	var err error
+	if !s.rolledBack {
+		_, err = s.conn.ExecContext(ctx, "ROLLBACK")
+	}
+	s.close()
+	if err != nil {
+		return fmt.Errorf("failed to roll back: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package database
+
+import "strings"
+
+// skipQuoted returns the index just past a quoted identifier or string
+// literal, or past a comment, starting at s[i]. If s[i] starts none of
+// these, i is returned unchanged.
+func skipQuoted(s string, i int) int {
+	switch s[i] {
+	case '\'', '"', '`':
+		quote := s[i]
+		for j := i + 1; j < len(s); j++ {
+			if s[j] == quote {
+				// A doubled quote is an escaped quote, not the end.
+				if j+1 < len(s) && s[j+1] == quote {
+					j++
+					continue
+				}
+				return j + 1
+			}
+		}
+		return len(s)
+	case '[':
+		if end := strings.IndexByte(s[i:], ']'); end >= 0 {
+			return i + end + 1
+		}
+		return len(s)
+	case '-':
+		if i+1 < len(s) && s[i+1] == '-' {
+			if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+				return i + end + 1
+			}
+			return len(s)
+		}
+	case '/':
+		if i+1 < len(s) && s[i+1] == '*' {
+			if end := strings.Index(s[i+2:], "*/"); end >= 0 {
+				return i + 2 + end + 2
+			}
+			return len(s)
+		}
+	}
+	return i
+}
+
+// hasStatementSeparator reports whether s contains a semicolon outside
+// of quotes and comments.
+func hasStatementSeparator(s string) bool {
+	for i := 0; i < len(s); {
+		if next := skipQuoted(s, i); next != i {
+			i = next
+			continue
+		}
+		if s[i] == ';' {
+			return true
+		}
+		i++
+	}
+	return false
+}
+
+// hasKeyword reports whether keyword appears in s as a word of its own,
+// outside quoted identifiers, string literals and comments.
+func hasKeyword(s, keyword string) bool {
+	for i := 0; i < len(s); {
+		if next := skipQuoted(s, i); next != i {
+			i = next
+			continue
+		}
+		if !isWordByte(s[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isWordByte(s[j]) {
+			j++
+		}
+		if strings.EqualFold(s[i:j], keyword) {
+			return true
+		}
+		i = j
+	}
+	return false
+}
+
+// indexWhereClause extracts the WHERE expression of a partial index from
+// its CREATE INDEX statement. It returns "" for a full index.
+func indexWhereClause(createSQL string) string {
+	depth := 0
+	for i := 0; i < len(createSQL); {
+		if next := skipQuoted(createSQL, i); next != i {
+			i = next
+			continue
+		}
+		switch createSQL[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				rest := strings.TrimSpace(createSQL[i+1:])
+				if len(rest) > 5 && strings.EqualFold(rest[:5], "WHERE") {
+					return strings.TrimSpace(rest[5:])
+				}
+				return ""
+			}
+		}
+		i++
+	}
+	return ""
+}
+
+// statementSpan locates one statement of a script by byte offsets.
+type statementSpan struct {
+	start, end int
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// splitStatements splits a script into statements at semicolons outside
+// quotes and comments. Inside a CREATE TRIGGER body, semicolons separate
+// the trigger's own statements, so the split waits for the END closing
+// it; CASE ... END is tracked so it is not mistaken for that END. Spans
+// exclude surrounding whitespace and the terminating semicolon, and
+// scripts' empty statements are dropped.
+func splitStatements(script string) []statementSpan {
+	var (
+		spans     []statementSpan
+		start     = -1
+		words     int
+		isTrigger bool
+		depth     int
+	)
+	flush := func(end int) {
+		if start >= 0 {
+			spans = append(spans, statementSpan{start: start, end: end})
+		}
+		start, words, isTrigger, depth = -1, 0, false, 0
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		if next := skipQuoted(script, i); next != i {
+			// Comments before a statement are not part of it.
+			isComment := c == '-' || c == '/'
+			if start < 0 && !isComment {
+				start = i
+			}
+			i = next
+			continue
+		}
+
+		switch {
+		case c == ';':
+			if depth == 0 {
+				flush(i)
+			}
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case isWordByte(c):
+			j := i
+			for j < len(script) && isWordByte(script[j]) {
+				j++
+			}
+			if start < 0 {
+				start = i
+			}
+			word := strings.ToUpper(script[i:j])
+			words++
+			// CREATE [TEMP|TEMPORARY] TRIGGER
+			if words <= 3 && word == "TRIGGER" {
+				isTrigger = true
+			}
+			if isTrigger {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					if depth > 0 {
+						depth--
+					}
+				}
+			}
+			i = j
+		default:
+			if start < 0 {
+				start = i
+			}
+			i++
+		}
+	}
+	flush(len(script))
+
+	for k := range spans {
+		spans[k].end = spans[k].start + len(strings.TrimRight(script[spans[k].start:spans[k].end], " \t\n\r\f"))
+	}
+	return spans
+}
+
+// statementVerb returns the keyword saying what a statement does: its
+// first word, or for a statement starting with WITH, the first SELECT,
+// INSERT, REPLACE, UPDATE, DELETE or VALUES after the common table
+// expressions. returning reports a RETURNING clause outside parentheses.
+func statementVerb(stmt string) (verb string, returning bool) {
+	depth := 0
+	for i := 0; i < len(stmt); {
+		if next := skipQuoted(stmt, i); next != i {
+			i = next
+			continue
+		}
+
+		c := stmt[i]
+		if !isWordByte(c) {
+			switch c {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(stmt) && isWordByte(stmt[j]) {
+			j++
+		}
+		word := strings.ToUpper(stmt[i:j])
+		i = j
+		if depth != 0 {
+			continue
+		}
+
+		switch {
+		case verb == "":
+			verb = word
+		case verb == "WITH":
+			switch word {
+			case "SELECT", "INSERT", "REPLACE", "UPDATE", "DELETE", "VALUES":
+				verb = word
+			}
+		case word == "RETURNING":
+			returning = true
+		}
+	}
+	return verb, returning
+}
+
+// isReadVerb reports whether a statement with the given verb only reads
+// rows. A WITH statement counts by the statement after its common table
+// expressions, as statementVerb gives it.
+func isReadVerb(verb string) bool {
+	return verb == "SELECT" || verb == "VALUES"
+}
+
+// isWriteVerb reports whether a statement with the given verb changes
+// rows, so it has an affected row count.
+func isWriteVerb(verb string) bool {
+	switch verb {
+	case "INSERT", "REPLACE", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// windows1252 maps the bytes 0x80-0x9F, where Windows-1252 differs from
+// Latin-1. Unassigned bytes map to themselves, as browsers do.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// decodeText wraps r so it yields UTF-8 for text in the named encoding.
+// A leading byte order mark is dropped.
+func decodeText(r io.Reader, encoding string) (io.Reader, error) {
+	src := bufio.NewReader(r)
+
+	switch strings.ToLower(strings.ReplaceAll(encoding, "_", "-")) {
+	case "", "utf-8", "utf8":
+		if bom, err := src.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+			src.Discard(3)
+		}
+		return src, nil
+
+	case "latin1", "latin-1", "iso-8859-1":
+		return &runeDecoder{src: src, next: func(src *bufio.Reader) (rune, error) {
+			b, err := src.ReadByte()
+			return rune(b), err
+		}}, nil
+
+	case "windows-1252", "cp1252":
+		return &runeDecoder{src: src, next: func(src *bufio.Reader) (rune, error) {
+			b, err := src.ReadByte()
+			if err == nil && b >= 0x80 && b <= 0x9F {
+				return windows1252[b-0x80], nil
+			}
+			return rune(b), err
+		}}, nil
+
+	case "utf-16", "utf-16le", "utf-16be":
+		bigEndian := strings.HasSuffix(strings.ToLower(encoding), "be")
+		if bom, err := src.Peek(2); err == nil {
+			switch {
+			case bom[0] == 0xFF && bom[1] == 0xFE:
+				bigEndian = false
+				src.Discard(2)
+			case bom[0] == 0xFE && bom[1] == 0xFF:
+				bigEndian = true
+				src.Discard(2)
+			}
+		}
+		return &runeDecoder{src: src, next: func(src *bufio.Reader) (rune, error) {
+			unit, err := readUTF16Unit(src, bigEndian)
+			if err != nil {
+				return 0, err
+			}
+			if !utf16.IsSurrogate(rune(unit)) {
+				return rune(unit), nil
+			}
+			low, err := readUTF16Unit(src, bigEndian)
+			if err != nil {
+				return utf8.RuneError, nil
+			}
+			return utf16.DecodeRune(rune(unit), rune(low)), nil
+		}}, nil
+	}
+
+	return nil, inputErrorf("unsupported encoding %q", encoding)
+}
+
+func readUTF16Unit(src *bufio.Reader, bigEndian bool) (uint16, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(src, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, inputErrorf("truncated UTF-16 text")
+		}
+		return 0, err
+	}
+	if bigEndian {
+		return uint16(b[0])<<8 | uint16(b[1]), nil
+	}
+	return uint16(b[1])<<8 | uint16(b[0]), nil
+}
+
+// runeDecoder is an io.Reader producing UTF-8 from a source decoded one
+// rune at a time by next.
+type runeDecoder struct {
+	src  *bufio.Reader
+	next func(*bufio.Reader) (rune, error)
+	buf  []byte
+}
+
+func (d *runeDecoder) Read(p []byte) (int, error) {
+	for len(d.buf) < len(p) {
+		r, err := d.next(d.src)
+		if err != nil {
+			if len(d.buf) > 0 {
+				break
+			}
+			return 0, err
+		}
+		d.buf = utf8.AppendRune(d.buf, r)
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[:copy(d.buf, d.buf[n:])]
+	return n, nil
+}
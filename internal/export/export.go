@@ -0,0 +1,201 @@
+// Package export writes rows to a stream as CSV, TSV, a JSON array or
+// newline-delimited JSON, one row at a time.
+package export
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	CSV    = "csv"
+	TSV    = "tsv"
+	JSON   = "json"
+	NDJSON = "ndjson"
+)
+
+var contentTypes = map[string]string{
+	CSV:    "text/csv; charset=utf-8",
+	TSV:    "text/tab-separated-values; charset=utf-8",
+	JSON:   "application/json",
+	NDJSON: "application/x-ndjson",
+}
+
+// ContentType returns the MIME type for format, and false if the format
+// is not supported.
+func ContentType(format string) (string, bool) {
+	contentType, ok := contentTypes[format]
+	return contentType, ok
+}
+
+// Writer encodes rows in a particular format. Close must be called after
+// the last row to complete the output.
+type Writer interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// NewWriter returns a Writer for format that writes to w. CSV and TSV
+// output starts with a header row of column names; JSON formats write
+// each row as an object keyed by column name.
+func NewWriter(format string, w io.Writer, columns []string) (Writer, error) {
+	buf := bufio.NewWriterSize(w, 64*1024)
+
+	switch format {
+	case CSV, TSV:
+		cw := csv.NewWriter(buf)
+		if format == TSV {
+			cw.Comma = '\t'
+		}
+		if err := cw.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{buf: buf, w: cw, record: make([]string, len(columns))}, nil
+
+	case JSON, NDJSON:
+		keys := make([][]byte, len(columns))
+		for i, col := range columns {
+			keys[i], _ = json.Marshal(col)
+		}
+		if format == JSON {
+			if _, err := buf.WriteString("["); err != nil {
+				return nil, err
+			}
+		}
+		return &jsonWriter{buf: buf, keys: keys, array: format == JSON}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+type csvWriter struct {
+	buf    *bufio.Writer
+	w      *csv.Writer
+	record []string
+}
+
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	for i, v := range values {
+		c.record[i] = formatText(v)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	return c.buf.Flush()
+}
+
+// formatText renders a value for a delimited text file. NULL becomes an
+// empty field.
+func formatText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// maxSafeInteger is the largest integer a JavaScript number, and so many
+// JSON readers, holds exactly.
+const maxSafeInteger = 1<<53 - 1
+
+// blobValue stands in for a BLOB in JSON, which cannot hold raw bytes.
+type blobValue struct {
+	Type   string `json:"type"`
+	Base64 string `json:"base64"`
+}
+
+// jsonValue converts a value for JSON output the way table data sends
+// it: BLOBs as base64, integers beyond 2^53 and infinite reals as
+// strings, since JSON readers would round or refuse them as numbers.
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return blobValue{Type: "blob", Base64: base64.StdEncoding.EncodeToString(x)}
+	case int64:
+		if x > maxSafeInteger || x < -maxSafeInteger {
+			return strconv.FormatInt(x, 10)
+		}
+	case float64:
+		switch {
+		case math.IsInf(x, 1):
+			return "Infinity"
+		case math.IsInf(x, -1):
+			return "-Infinity"
+		case math.IsNaN(x):
+			return "NaN"
+		}
+	}
+	return v
+}
+
+// jsonWriter writes each row as an object whose keys keep the column
+// order, which encoding a map would not.
+type jsonWriter struct {
+	buf   *bufio.Writer
+	keys  [][]byte
+	array bool
+	rows  int
+}
+
+func (j *jsonWriter) WriteRow(values []interface{}) error {
+	switch {
+	case j.array && j.rows > 0:
+		j.buf.WriteString(",\n")
+	case j.array:
+		j.buf.WriteString("\n")
+	}
+	j.rows++
+
+	j.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			j.buf.WriteByte(',')
+		}
+		j.buf.Write(j.keys[i])
+		j.buf.WriteByte(':')
+
+		encoded, err := json.Marshal(jsonValue(v))
+		if err != nil {
+			return err
+		}
+		j.buf.Write(encoded)
+	}
+	_, err := j.buf.WriteString("}")
+	if !j.array {
+		_, err = j.buf.WriteString("\n")
+	}
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if j.array {
+		if j.rows > 0 {
+			j.buf.WriteString("\n")
+		}
+		j.buf.WriteString("]\n")
+	}
+	return j.buf.Flush()
+}
@@ -2,24 +2,38 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/audit"
 	"github.com/rzhade3/sqlite-webgui/internal/database"
+	"github.com/rzhade3/sqlite-webgui/internal/history"
+	"github.com/rzhade3/sqlite-webgui/internal/library"
 	"github.com/rzhade3/sqlite-webgui/internal/models"
 )
 
 type APIHandler struct {
-	db *database.DB
+	db           *database.DB
+	queries      *queryRegistry
+	transactions *transactionRegistry
+	history      *history.Store
+	library      *library.Store
+	audit        *audit.Store
 }
 
 func NewAPIHandler(db *database.DB) *APIHandler {
-	return &APIHandler{db: db}
+	return &APIHandler{db: db, queries: newQueryRegistry(), transactions: newTransactionRegistry()}
 }
 
 func (h *APIHandler) GetTables(w http.ResponseWriter, r *http.Request) {
-	tables, err := h.db.GetTables()
+	includeSystem, _ := strconv.ParseBool(r.URL.Query().Get("system"))
+
+	tables, err := h.db.GetTables(r.Context(), includeSystem)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -36,10 +50,10 @@ func (h *APIHandler) GetMode(w http.ResponseWriter, r *http.Request) {
 
 func (h *APIHandler) GetTableSchema(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "name")
-	
-	schema, err := h.db.GetTableSchema(tableName)
+
+	schema, err := h.db.GetTableSchema(r.Context(), tableName)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondDBError(w, err)
 		return
 	}
 
@@ -48,7 +62,7 @@ func (h *APIHandler) GetTableSchema(w http.ResponseWriter, r *http.Request) {
 
 func (h *APIHandler) GetTableData(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "name")
-	
+
 	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
 	if page < 1 {
 		page = 1
@@ -59,9 +73,23 @@ func (h *APIHandler) GetTableData(w http.ResponseWriter, r *http.Request) {
 		limit = 50
 	}
 
-	data, err := h.db.GetTableData(tableName, page, limit)
+	filter, err := parseFilter(r.URL.Query().Get("filter"))
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondError(w, http.StatusBadRequest, "Invalid filter JSON")
+		return
+	}
+
+	req := models.TableDataRequest{
+		Page:   page,
+		Limit:  limit,
+		Filter: filter,
+		Sort:   parseSort(r.URL.Query().Get("sort")),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	data, err := h.db.QueryTableData(r.Context(), tableName, req)
+	if err != nil {
+		respondDBError(w, err)
 		return
 	}
 
@@ -72,75 +100,164 @@ func (h *APIHandler) InsertRow(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "name")
 
 	var values map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+	if err := decodeExact(r.Body, &values); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
-	if err := h.db.InsertRow(tableName, values); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	row, err := h.db.InsertRow(r.Context(), tableName, values)
+	if err != nil {
+		respondDBError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusCreated, map[string]string{"message": "Row inserted successfully"})
+	respondJSON(w, http.StatusCreated, models.RowResponse{Message: "Row inserted successfully", Row: row})
 }
 
 func (h *APIHandler) UpdateRow(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "name")
-	pkColumn := r.URL.Query().Get("pk")
-	pkValue := r.URL.Query().Get("pk_value")
 
-	if pkColumn == "" || pkValue == "" {
-		respondError(w, http.StatusBadRequest, "Missing pk or pk_value query parameters")
+	var req models.RowUpdateRequest
+	if key, ok := legacyRowKey(r); ok {
+		req.Key = key
+		if err := decodeExact(r.Body, &req.Values); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	} else if err := decodeExact(r.Body, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
-	var values map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid JSON")
+	if len(req.Key) == 0 {
+		respondError(w, http.StatusBadRequest, "Missing row key")
 		return
 	}
 
-	if err := h.db.UpdateRow(tableName, pkColumn, pkValue, values); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	row, err := h.db.UpdateRow(r.Context(), tableName, req.Key, req.Values)
+	if err != nil {
+		respondDBError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Row updated successfully"})
+	respondJSON(w, http.StatusOK, models.RowResponse{Message: "Row updated successfully", Row: row})
 }
 
 func (h *APIHandler) DeleteRow(w http.ResponseWriter, r *http.Request) {
 	tableName := chi.URLParam(r, "name")
-	pkColumn := r.URL.Query().Get("pk")
-	pkValue := r.URL.Query().Get("pk_value")
 
-	if pkColumn == "" || pkValue == "" {
-		respondError(w, http.StatusBadRequest, "Missing pk or pk_value query parameters")
+	var req models.RowDeleteRequest
+	if key, ok := legacyRowKey(r); ok {
+		req.Key = key
+	} else if err := decodeExact(r.Body, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
-	if err := h.db.DeleteRow(tableName, pkColumn, pkValue); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+	if len(req.Key) == 0 {
+		respondError(w, http.StatusBadRequest, "Missing row key")
+		return
+	}
+
+	if err := h.db.DeleteRow(r.Context(), tableName, req.Key); err != nil {
+		respondDBError(w, err)
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Row deleted successfully"})
 }
 
+// parseSort reads a comma-separated column list where a leading "-"
+// sorts that column descending, e.g. "last_name,-created_at".
+func parseSort(param string) []models.SortColumn {
+	var sorts []models.SortColumn
+	for _, term := range strings.Split(param, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		sort := models.SortColumn{Column: term}
+		if strings.HasPrefix(term, "-") {
+			sort = models.SortColumn{Column: term[1:], Desc: true}
+		}
+		sorts = append(sorts, sort)
+	}
+	return sorts
+}
+
+// parseFilter decodes the JSON filter group passed as a query parameter.
+func parseFilter(param string) (*models.FilterGroup, error) {
+	if param == "" {
+		return nil, nil
+	}
+	filter := &models.FilterGroup{}
+	if err := decodeExact(strings.NewReader(param), filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// keyParam reads a row key passed as JSON in the key query parameter.
+func keyParam(r *http.Request) (models.RowKey, bool) {
+	var key models.RowKey
+	if err := decodeExact(strings.NewReader(r.URL.Query().Get("key")), &key); err != nil || len(key) == 0 {
+		return nil, false
+	}
+	return key, true
+}
+
+// legacyRowKey supports the older ?pk=col&pk_value=val form for tables
+// keyed by a single column.
+func legacyRowKey(r *http.Request) (models.RowKey, bool) {
+	pkColumn := r.URL.Query().Get("pk")
+	pkValue := r.URL.Query().Get("pk_value")
+	if pkColumn == "" || pkValue == "" {
+		return nil, false
+	}
+	return models.RowKey{pkColumn: pkValue}, true
+}
+
 func (h *APIHandler) ExecuteQuery(w http.ResponseWriter, r *http.Request) {
 	var req models.QueryRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeExact(r.Body, &req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
-	data, err := h.db.ExecuteQuery(req.SQL)
+	if len(req.QueryID) > maxQueryIDLength {
+		respondError(w, http.StatusBadRequest, "Query ID is too long")
+		return
+	}
+	ctx, queryID, done, ok := h.queries.start(r.Context(), req.QueryID)
+	if !ok {
+		respondError(w, http.StatusConflict, "A query with this ID is already running")
+		return
+	}
+	defer done()
+
+	// A failing statement is reported in the result alongside the
+	// statements that ran before it, so it is not an error response.
+	started := time.Now()
+	result, err := h.db.ExecuteScript(ctx, req)
 	if err != nil {
-		respondError(w, http.StatusBadRequest, err.Error())
+		respondDBError(w, err)
 		return
 	}
 
-	respondJSON(w, http.StatusOK, data)
+	h.recordHistory(r.Context(), req, started, result)
+
+	result.QueryID = queryID
+	respondJSON(w, http.StatusOK, result)
+}
+
+// decodeExact decodes JSON from a request, keeping numbers as
+// json.Number so row values, keys and query parameters are converted
+// without first passing through a float64, which cannot hold every
+// integer.
+func decodeExact(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	return decoder.Decode(v)
 }
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -152,3 +269,19 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 func respondError(w http.ResponseWriter, status int, message string) {
 	respondJSON(w, status, models.ErrorResponse{Error: message})
 }
+
+func respondDBError(w http.ResponseWriter, err error) {
+	var inputErr *database.InputError
+	switch {
+	case errors.Is(err, database.ErrRowNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, database.ErrRowChanged):
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	case errors.As(err, &inputErr):
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondError(w, http.StatusInternalServerError, err.Error())
+}
@@ -3,13 +3,23 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/audit"
 	"github.com/rzhade3/sqlite-webgui/internal/database"
+	"github.com/rzhade3/sqlite-webgui/internal/history"
+	"github.com/rzhade3/sqlite-webgui/internal/library"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
 )
 
 func setupTestHandler(t *testing.T, readonly bool) (*APIHandler, string) {
@@ -114,11 +124,14 @@ func TestAPIHandler_InsertRow_Writable(t *testing.T) {
 		t.Errorf("Expected status 201, got %d", w.Code)
 	}
 
-	var response map[string]string
+	var response models.RowResponse
 	json.NewDecoder(w.Body).Decode(&response)
 	
-	if response["message"] != "Row inserted successfully" {
-		t.Errorf("Expected success message, got: %s", response["message"])
+	if response.Message != "Row inserted successfully" {
+		t.Errorf("Expected success message, got: %s", response.Message)
+	}
+	if response.Row == nil || response.Row.Key["id"] != float64(2) || response.Row.Values[1].Value != "Bob" {
+		t.Errorf("Expected the stored row with its new ID, got: %+v", response.Row)
 	}
 }
 
@@ -301,3 +314,1013 @@ func TestAPIHandler_GetMode_Writable(t *testing.T) {
 		t.Error("Expected readonly to be false")
 	}
 }
+
+func TestAPIHandler_UpdateRow_KeyBody(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	body := map[string]interface{}{
+		"key":    map[string]interface{}{"id": 1},
+		"values": map[string]interface{}{"name": "Alice Updated"},
+	}
+	jsonBody, _ := json.Marshal(body)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/tables/users/rows", bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+
+	r := chi.NewRouter()
+	r.Put("/api/tables/{name}/rows", handler.UpdateRow)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAPIHandler_DeleteRow_NotFound(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	jsonBody, _ := json.Marshal(map[string]interface{}{"key": map[string]interface{}{"id": 99}})
+	req := httptest.NewRequest(http.MethodDelete, "/api/tables/users/rows", bytes.NewReader(jsonBody))
+
+	w := httptest.NewRecorder()
+
+	r := chi.NewRouter()
+	r.Delete("/api/tables/{name}/rows", handler.DeleteRow)
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_GetTableSchema_NotFound(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, true)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Get("/api/tables/{name}/schema", handler.GetTableSchema)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tables/missing/schema", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown table, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tables/users/schema", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_GetTableData_Filter(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, true)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Get("/api/tables/{name}/data", handler.GetTableData)
+
+	filter := url.QueryEscape(`{"filters":[{"column":"name","op":"=","value":"Nobody"}]}`)
+	req := httptest.NewRequest(http.MethodGet, "/api/tables/users/data?filter="+filter, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var data models.TableData
+	json.NewDecoder(w.Body).Decode(&data)
+	if data.Total != 0 {
+		t.Errorf("Expected filtered total of 0, got %d", data.Total)
+	}
+
+	filter = url.QueryEscape(`{"filters":[{"column":"missing","op":"=","value":1}]}`)
+	req = httptest.NewRequest(http.MethodGet, "/api/tables/users/data?filter="+filter, nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown column, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_GetSchemaGraph(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	_, err := handler.db.GetConnection().Exec(`CREATE TABLE "order items" (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users(id), price DECIMAL(10,2))`)
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	tests := []struct {
+		format      string
+		contentType string
+		contains    []string
+	}{
+		{"json", "application/json", []string{`"from_table":"order items"`, `"to_table":"users"`}},
+		{"dot", "text/vnd.graphviz; charset=utf-8", []string{`digraph schema {`, `"order items":"user_id" -> "users":"id"`}},
+		{"mermaid", "text/plain; charset=utf-8", []string{"erDiagram", "order_items }o--|| users", "DECIMAL(10_2) price", "INTEGER id PK"}},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/schema/graph?format="+tt.format, nil)
+		w := httptest.NewRecorder()
+		handler.GetSchemaGraph(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tt.format, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: expected content type %q, got %q", tt.format, tt.contentType, got)
+		}
+		for _, want := range tt.contains {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s: expected output to contain %q, got:\n%s", tt.format, want, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestRenderSchemaGraph_Names(t *testing.T) {
+	graph := &models.SchemaGraph{
+		Tables: []models.GraphTable{
+			{Name: "a_b", Columns: []models.GraphColumn{{Name: "x y"}, {Name: "x_y"}}},
+			{Name: "a b", Columns: []models.GraphColumn{{Name: `say "hi" & <bye>`}}},
+		},
+		Edges: []models.GraphEdge{{FromTable: "a b", FromColumns: []string{"id"}, ToTable: "a_b", ToColumns: []string{"x y"}}},
+	}
+
+	mermaid := renderMermaid(graph)
+	for _, want := range []string{"    a_b {", "    a_b_2 {", "ANY x_y\n", "ANY x_y_2\n", "a_b_2 }o--|| a_b"} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("Expected Mermaid output to contain %q, got:\n%s", want, mermaid)
+		}
+	}
+
+	if dot := renderDOT(graph); !strings.Contains(dot, `port="say &#34;hi&#34; &amp; &lt;bye&gt;"`) {
+		t.Errorf("Expected the port escaped as HTML, got:\n%s", dot)
+	}
+}
+
+func TestAPIHandler_CreateTable_Preview(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Post("/api/tables", handler.CreateTable)
+	r.Get("/api/tables/{name}/definition", handler.GetTableDefinition)
+
+	body := `{"name":"tags","columns":[{"name":"id","type":"INTEGER","primary_key":true},{"name":"label","type":"TEXT","not_null":true}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/tables?preview=true", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var preview models.DDLResponse
+	json.NewDecoder(w.Body).Decode(&preview)
+	if preview.Applied || len(preview.SQL) != 1 || !strings.HasPrefix(preview.SQL[0], "CREATE TABLE `tags`") {
+		t.Errorf("Unexpected preview: %+v", preview)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tables/tags/definition", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected preview not to create the table, got status %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/tables", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tables/tags/definition", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAPIHandler_ImportCSV(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Post("/api/tables/{name}/import", handler.ImportCSV)
+
+	upload := func(table, options, csvData string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		if options != "" {
+			form.WriteField("options", options)
+		}
+		file, _ := form.CreateFormFile("file", "data.csv")
+		file.Write([]byte(csvData))
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/tables/"+table+"/import", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := upload("users", "", "name,email\nCarol,carol@example.com\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = upload("users", "", "name,email\n,nobody@example.com\n")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for an aborted import, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = upload("scores", `{"create": true, "delimiter": "tab"}`, "player\tscore\nCarol\t12\n")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var result models.ImportResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if result.Inserted != 1 || result.Columns[1].Type != "INTEGER" {
+		t.Errorf("Unexpected import result: %+v", result)
+	}
+
+	w = upload("users", `{"mode": "sometimes"}`, "name\nCarol\n")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid options, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_Export(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, true)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Get("/api/tables/{name}/export", handler.ExportTable)
+	r.Post("/api/query/export", handler.ExportQuery)
+
+	tests := []struct {
+		format      string
+		contentType string
+		body        string
+	}{
+		{"csv", "text/csv; charset=utf-8", "id,name,email\n1,Alice,alice@example.com\n"},
+		{"tsv", "text/tab-separated-values; charset=utf-8", "id\tname\temail\n1\tAlice\talice@example.com\n"},
+		{"json", "application/json", "[\n{\"id\":1,\"name\":\"Alice\",\"email\":\"alice@example.com\"}\n]\n"},
+		{"ndjson", "application/x-ndjson", "{\"id\":1,\"name\":\"Alice\",\"email\":\"alice@example.com\"}\n"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/tables/users/export?sort=-id&format="+tt.format, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", tt.format, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: expected content type %q, got %q", tt.format, tt.contentType, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != "attachment; filename=users."+tt.format {
+			t.Errorf("%s: unexpected Content-Disposition %q", tt.format, got)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: expected body %q, got %q", tt.format, tt.body, w.Body.String())
+		}
+	}
+
+	form := url.Values{"sql": {"SELECT name, NULL AS missing FROM users"}, "format": {"csv"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/query/export", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "name,missing\nAlice,\n" {
+		t.Errorf("Unexpected query export: %d %q", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/query/export?format=json", strings.NewReader(`{"sql": "SELECT * FROM missing"}`))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected a plain 400 for a failing query, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/tables/users/export?format=xml", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown format, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_Dump(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, true)
+	defer os.Remove(dbPath)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/dump?tables=users&data_only=true", nil)
+	w := httptest.NewRecorder()
+	handler.Dump(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment; filename=") {
+		t.Errorf("Expected an attachment, got %q", w.Header().Get("Content-Disposition"))
+	}
+	want := "PRAGMA foreign_keys=OFF;\nBEGIN TRANSACTION;\n" +
+		"INSERT INTO \"users\" VALUES(1,'Alice','alice@example.com');\n" +
+		"DELETE FROM sqlite_sequence WHERE name = 'users';\n" +
+		"INSERT INTO sqlite_sequence VALUES('users',1);\n" +
+		"COMMIT;\n"
+	if w.Body.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/dump?schema_only=true&data_only=true", nil)
+	w = httptest.NewRecorder()
+	handler.Dump(w, req)
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected a plain 400 for conflicting options, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_ExecuteQuery_Script(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, true)
+	defer os.Remove(dbPath)
+
+	body := `{"sql": "SELECT COUNT(*) AS n FROM users;\nUPDATE users SET name = 'x';\nSELECT 1"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ExecuteQuery(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var result models.ScriptResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result.Statements) != 2 || result.Statements[0].Result == nil || result.Error == "" {
+		t.Fatalf("Expected the read-only script to stop at the UPDATE: %+v", result)
+	}
+	if failed := result.Statements[1]; failed.Offset != 33 || failed.Error == "" {
+		t.Errorf("Unexpected failing statement: %+v", failed)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(`{"sql": " ; "}`))
+	w = httptest.NewRecorder()
+	handler.ExecuteQuery(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an empty script, got %d", w.Code)
+	}
+
+	// Integer parameters are bound exactly, even beyond 2^53.
+	body = `{"sql": "SELECT ?1 AS n, ?2 AS m", "params": [9007199254740993, 2.5]}`
+	w = httptest.NewRecorder()
+	handler.ExecuteQuery(w, httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(body)))
+	result = models.ScriptResult{}
+	json.NewDecoder(w.Body).Decode(&result)
+	if len(result.Statements) != 1 || result.Statements[0].Result == nil {
+		t.Fatalf("Unexpected result: %s", w.Body.String())
+	}
+	row := result.Statements[0].Result.Rows[0]
+	if row[0].Value != "9007199254740993" || row[1].Value != 2.5 {
+		t.Errorf("Expected the parameters bound exactly, got %+v", row)
+	}
+}
+
+func TestAPIHandler_CancelQuery(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, true)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Post("/api/query", handler.ExecuteQuery)
+	r.Post("/api/query/{id}/cancel", handler.CancelQuery)
+
+	cancel := func(id string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/query/"+id+"/cancel", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := cancel("nothing"); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown query, got %d", code)
+	}
+
+	finished := make(chan *httptest.ResponseRecorder)
+	go func() {
+		body := `{"sql": "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT COUNT(*) FROM n", "query_id": "runaway"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		finished <- w
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for cancel("runaway") != http.StatusNoContent {
+		if time.Now().After(deadline) {
+			t.Fatal("Query never became cancellable")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w := <-finished
+	var result models.ScriptResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || result.QueryID != "runaway" || result.Error != "query cancelled" {
+		t.Errorf("Expected a cancelled result, got %d %+v", w.Code, result)
+	}
+}
+
+func TestAPIHandler_History(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	defer store.Close()
+	handler.SetHistory(store)
+
+	r := chi.NewRouter()
+	r.Post("/api/query", handler.ExecuteQuery)
+	r.Get("/api/history", handler.GetHistory)
+
+	for _, sql := range []string{
+		"SELECT name FROM users; UPDATE users SET email = NULL",
+		"SELECT * FROM missing",
+	} {
+		body, _ := json.Marshal(models.QueryRequest{SQL: sql})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/query", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	search := func(query string) []models.HistoryEntry {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/history?q="+url.QueryEscape(query), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var entries []models.HistoryEntry
+		json.NewDecoder(w.Body).Decode(&entries)
+		return entries
+	}
+
+	entries := search("")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 history entries, got %+v", entries)
+	}
+	if entries[0].SQL != "SELECT * FROM missing" || entries[0].Error == "" || entries[0].RowCount != nil {
+		t.Errorf("Expected the failed query first, got %+v", entries[0])
+	}
+	if entries[1].SQL != "UPDATE users SET email = NULL" || entries[1].RowCount == nil || *entries[1].RowCount != 1 {
+		t.Errorf("Expected the update with 1 row, got %+v", entries[1])
+	}
+	if entries[2].RowCount == nil || *entries[2].RowCount != 1 || entries[2].ExecutedAt.IsZero() {
+		t.Errorf("Expected the select with 1 row, got %+v", entries[2])
+	}
+
+	if entries := search("update"); len(entries) != 1 {
+		t.Errorf("Expected 1 entry matching 'update', got %+v", entries)
+	}
+	if entries := search("%"); len(entries) != 0 {
+		t.Errorf("Expected '%%' to match literally, got %+v", entries)
+	}
+}
+
+func TestAPIHandler_Audit(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	store, err := audit.Open(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer store.Close()
+	handler.SetAudit(store)
+
+	r := chi.NewRouter()
+	r.Use(WithClient)
+	r.Put("/api/tables/{name}/rows", handler.UpdateRow)
+	r.Get("/api/audit", handler.GetAudit)
+	r.Post("/api/audit/{id}/undo", handler.UndoChange)
+
+	update := func(email string) {
+		body, _ := json.Marshal(map[string]interface{}{"key": map[string]interface{}{"id": 1}, "values": map[string]interface{}{"email": email}})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/tables/users/rows", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	list := func() []models.AuditEntry {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/audit?table=users", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var entries []models.AuditEntry
+		json.NewDecoder(w.Body).Decode(&entries)
+		return entries
+	}
+	undo := func(id int64) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/audit/"+strconv.FormatInt(id, 10)+"/undo", nil))
+		return w.Code
+	}
+
+	update("first@example.com")
+	update("second@example.com")
+	entries := list()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %+v", entries)
+	}
+	latest, first := entries[0], entries[1]
+	if latest.Operation != models.AuditUpdate || latest.Client == "" || latest.Before["email"] != "first@example.com" || latest.After["email"] != "second@example.com" {
+		t.Errorf("Unexpected audit entry: %+v", latest)
+	}
+
+	if code := undo(first.ID); code != http.StatusConflict {
+		t.Errorf("Expected undoing a change overwritten since to conflict, got %d", code)
+	}
+	if code := undo(latest.ID); code != http.StatusOK {
+		t.Fatalf("Expected undo to succeed, got %d", code)
+	}
+	if code := undo(latest.ID); code != http.StatusConflict {
+		t.Errorf("Expected a second undo to conflict, got %d", code)
+	}
+	if code := undo(999); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown entry, got %d", code)
+	}
+
+	entries = list()
+	if len(entries) != 3 || entries[0].After["email"] != "first@example.com" || entries[1].UndoneAt == nil {
+		t.Errorf("Expected the undo recorded and the change marked undone, got %+v", entries)
+	}
+}
+
+func TestAPIHandler_SavedQueries(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, true)
+	defer os.Remove(dbPath)
+
+	store, err := library.Open(filepath.Join(t.TempDir(), "library.db"))
+	if err != nil {
+		t.Fatalf("Failed to open library: %v", err)
+	}
+	defer store.Close()
+	handler.SetLibrary(store)
+
+	r := chi.NewRouter()
+	r.Get("/api/saved-queries", handler.GetSavedQueries)
+	r.Post("/api/saved-queries", handler.SaveQuery)
+	r.Put("/api/saved-queries/{id}", handler.SaveQuery)
+	r.Delete("/api/saved-queries/{id}", handler.DeleteSavedQuery)
+	r.Post("/api/query", handler.ExecuteQuery)
+
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/saved-queries", `{"name": "User by ID", "sql": "SELECT name FROM users WHERE id = :id", "params": [{"name": ":id", "type": "integer", "default": 1}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var saved models.SavedQuery
+	json.NewDecoder(w.Body).Decode(&saved)
+	if saved.ID == 0 || len(saved.Params) != 1 || saved.Params[0].Name != "id" {
+		t.Errorf("Expected the stored query with parameter 'id', got %+v", saved)
+	}
+
+	for body, status := range map[string]int{
+		`{"name": "User by ID", "sql": "SELECT 1"}`: http.StatusConflict,
+		`{"name": "", "sql": "SELECT 1"}`:           http.StatusBadRequest,
+		`{"name": "Bad", "sql": "SELECT :n", "params": [{"name": "n", "type": "integer", "default": 1.5}]}`: http.StatusBadRequest,
+		`{"name": "Bad", "sql": "SELECT :n", "params": [{"name": "n", "type": "blob"}]}`:                    http.StatusBadRequest,
+	} {
+		if w := send(http.MethodPost, "/api/saved-queries", body); w.Code != status {
+			t.Errorf("Expected status %d for %s, got %d", status, body, w.Code)
+		}
+	}
+
+	w = send(http.MethodPut, "/api/saved-queries/"+strconv.FormatInt(saved.ID, 10), `{"name": "User", "description": "Look up a user", "sql": "SELECT name FROM users WHERE id = :id"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = send(http.MethodGet, "/api/saved-queries", "")
+	var queries []models.SavedQuery
+	json.NewDecoder(w.Body).Decode(&queries)
+	if len(queries) != 1 || queries[0].Name != "User" || queries[0].Description != "Look up a user" {
+		t.Errorf("Expected the updated query, got %+v", queries)
+	}
+
+	w = send(http.MethodPost, "/api/saved-queries", `{"name": "Big", "sql": "SELECT :n", "params": [{"name": "n", "type": "integer", "default": 9007199254740993}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = send(http.MethodGet, "/api/saved-queries", ""); !strings.Contains(w.Body.String(), `"default":9007199254740993`) {
+		t.Errorf("Expected the integer default to keep its value, got %s", w.Body.String())
+	}
+
+	w = send(http.MethodPost, "/api/query", `{"sql": "SELECT name FROM users WHERE id = :id", "params": {"id": 1}}`)
+	var result models.ScriptResult
+	json.NewDecoder(w.Body).Decode(&result)
+	if w.Code != http.StatusOK || result.Error != "" || result.Statements[0].Result.Rows[0][0].Value != "Alice" {
+		t.Errorf("Expected Alice, got %d %+v", w.Code, result)
+	}
+	if w := send(http.MethodPost, "/api/query", `{"sql": "SELECT ?", "params": "1"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for malformed params, got %d", w.Code)
+	}
+
+	if w := send(http.MethodDelete, "/api/saved-queries/"+strconv.FormatInt(saved.ID, 10), ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if w := send(http.MethodDelete, "/api/saved-queries/"+strconv.FormatInt(saved.ID, 10), ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_Transactions(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Use(handler.WithTransaction)
+	r.Get("/api/tables/{name}/data", handler.GetTableData)
+	r.Post("/api/tables/{name}/rows", handler.InsertRow)
+	r.Post("/api/transactions", handler.BeginTransaction)
+	r.Get("/api/transactions/{id}", handler.GetTransaction)
+	r.Post("/api/transactions/{id}/commit", handler.CommitTransaction)
+	r.Post("/api/transactions/{id}/rollback", handler.RollbackTransaction)
+
+	send := func(method, target, txID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if txID != "" {
+			req.Header.Set(TransactionHeader, txID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	begin := func() string {
+		w := send(http.MethodPost, "/api/transactions", "", "")
+		var status models.TransactionStatus
+		json.NewDecoder(w.Body).Decode(&status)
+		if w.Code != http.StatusCreated || status.ID == "" || !status.ExpiresAt.After(status.StartedAt) {
+			t.Fatalf("Expected a new transaction, got %d %+v", w.Code, status)
+		}
+		return status.ID
+	}
+	total := func(txID string) int {
+		var data models.TableData
+		json.NewDecoder(send(http.MethodGet, "/api/tables/users/data", txID, "").Body).Decode(&data)
+		return data.Total
+	}
+
+	id := begin()
+	if w := send(http.MethodPost, "/api/tables/users/rows", id, `{"name": "Bob"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if total(id) != 2 || total("") != 1 {
+		t.Errorf("Expected the insert to be seen only in the transaction")
+	}
+	if w := send(http.MethodPost, "/api/transactions/"+id+"/rollback", "", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if total("") != 1 {
+		t.Errorf("Expected the rollback to discard the insert")
+	}
+	if w := send(http.MethodGet, "/api/tables/users/data", id, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an ended transaction, got %d", w.Code)
+	}
+
+	// Ending a transaction from a request that runs in it must not wait
+	// on itself.
+	id = begin()
+	send(http.MethodPost, "/api/tables/users/rows", id, `{"name": "Bob"}`)
+	if w := send(http.MethodPost, "/api/transactions/"+id+"/commit", id, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if total("") != 2 {
+		t.Errorf("Expected the commit to keep the insert")
+	}
+
+	handler.SetTransactionTimeout(50 * time.Millisecond)
+	id = begin()
+	send(http.MethodPost, "/api/tables/users/rows", id, `{"name": "Carol"}`)
+	time.Sleep(200 * time.Millisecond)
+	if w := send(http.MethodGet, "/api/transactions/"+id, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the idle transaction to be rolled back, got %d", w.Code)
+	}
+	if total("") != 2 {
+		t.Errorf("Expected the idle transaction's insert to be discarded")
+	}
+}
+
+func TestAPIHandler_BulkRows(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	if _, err := handler.db.GetConnection().Exec(`INSERT INTO users (name) VALUES ('Bob'), ('Carol')`); err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Post("/api/tables/{name}/rows/bulk-delete", handler.BulkDeleteRows)
+	r.Post("/api/tables/{name}/rows/bulk-update", handler.BulkUpdateRows)
+
+	bulk := func(path, body string) (int, models.BulkRowResponse) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp models.BulkRowResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+	count := func(where string) int {
+		var n int
+		handler.db.GetConnection().QueryRow("SELECT COUNT(*) FROM users WHERE " + where).Scan(&n)
+		return n
+	}
+
+	update := `{"filter":{"filters":[{"column":"email","op":"IS NULL"}]},"values":{"email":"none"}}`
+	code, resp := bulk("/api/tables/users/rows/bulk-update?preview=true", update)
+	if code != http.StatusOK || resp.RowsAffected != 2 || resp.Applied {
+		t.Fatalf("Unexpected preview: %d %+v", code, resp)
+	}
+	if n := count("email = 'none'"); n != 0 {
+		t.Errorf("Expected preview not to update rows, %d updated", n)
+	}
+
+	code, resp = bulk("/api/tables/users/rows/bulk-update", update)
+	if code != http.StatusOK || resp.RowsAffected != 2 || !resp.Applied {
+		t.Fatalf("Unexpected update: %d %+v", code, resp)
+	}
+	if n := count("email = 'none'"); n != 2 {
+		t.Errorf("Expected 2 updated rows, got %d", n)
+	}
+
+	code, resp = bulk("/api/tables/users/rows/bulk-delete", `{"keys":[{"id":1},{"id":2},{"id":99}]}`)
+	if code != http.StatusOK || resp.RowsAffected != 2 {
+		t.Fatalf("Unexpected delete: %d %+v", code, resp)
+	}
+	if n := count("1"); n != 1 {
+		t.Errorf("Expected 1 row left, got %d", n)
+	}
+
+	if code, _ := bulk("/api/tables/users/rows/bulk-delete", `{}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a selection, got %d", code)
+	}
+}
+
+func TestAPIHandler_Cell(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Get("/api/tables/{name}/cell", handler.GetCell)
+	r.Put("/api/tables/{name}/cell", handler.PutCell)
+
+	gif := []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;")
+	target := "/api/tables/users/cell?key=" + url.QueryEscape(`{"id":1}`) + "&column=email"
+	req := httptest.NewRequest(http.MethodPut, target, bytes.NewReader(gif))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Row struct {
+			Values []struct {
+				Type  string      `json:"type"`
+				Value models.Blob `json:"value"`
+			} `json:"values"`
+		} `json:"row"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Row.Values) != 3 || resp.Row.Values[2].Type != models.CellBlob || resp.Row.Values[2].Value.Size != len(gif) {
+		t.Errorf("Expected the stored row to describe the blob, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target+"&download=true", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), gif) {
+		t.Fatalf("Expected the uploaded bytes back, got %d: %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/gif" {
+		t.Errorf("Expected image/gif, got %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment") || !strings.Contains(cd, "users-email.gif") {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tables/users/cell?key="+url.QueryEscape(`{"id":9}`)+"&column=email", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing row, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tables/users/cell?column=email", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a key, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_TypedCells(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	if _, err := handler.db.GetConnection().Exec(`CREATE TABLE measures (id INTEGER PRIMARY KEY, label TEXT, reading REAL, note)`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := handler.db.GetConnection().Exec(`INSERT INTO measures VALUES (1152921504606846977, '', 9e999, NULL), (2, 'two', 2.5, 7)`); err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/api/tables/{name}/data", handler.GetTableData)
+	r.Put("/api/tables/{name}/rows", handler.UpdateRow)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tables/measures/data?sort=id", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var data struct {
+		Rows [][]json.RawMessage `json:"rows"`
+		Keys []json.RawMessage   `json:"keys"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+		t.Fatalf("Failed to decode table data: %v", err)
+	}
+
+	want := [][]string{
+		{`{"type":"integer","value":2}`, `{"type":"text","value":"two"}`, `{"type":"real","value":2.5}`, `{"type":"integer","value":7}`},
+		{`{"type":"integer","value":"1152921504606846977"}`, `{"type":"text","value":""}`, `{"type":"real","value":"Infinity"}`, `{"type":"null"}`},
+	}
+	for i, row := range want {
+		for j, cell := range row {
+			if got := string(data.Rows[i][j]); got != cell {
+				t.Errorf("Row %d column %d: expected %s, got %s", i, j, cell, got)
+			}
+		}
+	}
+	if got := string(data.Keys[1]); got != `{"id":"1152921504606846977"}` {
+		t.Fatalf("Expected the big key as a string, got %s", got)
+	}
+
+	// The key comes back as the browser received it.
+	body := `{"key":` + string(data.Keys[1]) + `,"values":{"label":"big"}}`
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/tables/measures/rows", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 updating by the big key, got %d: %s", w.Code, w.Body.String())
+	}
+	var label string
+	handler.db.GetConnection().QueryRow("SELECT label FROM measures WHERE id = 1152921504606846977").Scan(&label)
+	if label != "big" {
+		t.Errorf("Expected the row with the big key updated, got label %q", label)
+	}
+
+	// A key sent as a JSON number is read exactly on every route.
+	bigKey := `{"id":1152921504606846977}`
+	r.Get("/api/tables/{name}/cell", handler.GetCell)
+	r.Delete("/api/tables/{name}/rows", handler.DeleteRow)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tables/measures/cell?column=label&key="+url.QueryEscape(bigKey), nil))
+	if w.Code != http.StatusOK || w.Body.String() != "big" {
+		t.Errorf("Expected the cell of the big key, got %d %q", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/tables/measures/rows", strings.NewReader(`{"key":`+bigKey+`}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 deleting by the big key, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAPIHandler_InsertRow_Invalid(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Post("/api/tables/{name}/rows", handler.InsertRow)
+
+	for body, want := range map[string]string{
+		`{"name": null}`:             "name cannot be NULL",
+		`{"email": "x"}`:             "name is required",
+		`{"name": "Bob", "id": 1.5}`: "id: 1.5 is not an integer",
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/tables/users/rows", strings.NewReader(body)))
+		var resp models.ErrorResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusBadRequest || resp.Error != want {
+			t.Errorf("%s: expected 400 %q, got %d %q", body, want, w.Code, resp.Error)
+		}
+	}
+}
+
+func TestDatabases(t *testing.T) {
+	dir := t.TempDir()
+	databases := NewDatabases()
+	for _, file := range []struct {
+		name     string
+		readonly bool
+	}{{"Sales Data.db", false}, {"sales-data.sqlite", true}, {"...", true}} {
+		path := filepath.Join(dir, file.name)
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatalf("Failed to create %s: %v", file.name, err)
+		}
+		db, err := database.New(path, file.readonly)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file.name, err)
+		}
+		defer db.Close()
+		databases.Add(NewAPIHandler(db))
+	}
+
+	w := httptest.NewRecorder()
+	databases.GetDatabases(w, httptest.NewRequest(http.MethodGet, "/api/databases", nil))
+	var infos []models.DatabaseInfo
+	if err := json.NewDecoder(w.Body).Decode(&infos); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	want := []models.DatabaseInfo{
+		{ID: "sales-data", Name: "Sales Data.db", ReadOnly: false},
+		{ID: "sales-data-2", Name: "sales-data.sqlite", ReadOnly: true},
+		{ID: "db", Name: "...", ReadOnly: true},
+	}
+	if len(infos) != len(want) {
+		t.Fatalf("Expected %d databases, got %+v", len(want), infos)
+	}
+	for i, info := range infos {
+		if info.ID != want[i].ID || info.Name != want[i].Name || info.ReadOnly != want[i].ReadOnly {
+			t.Errorf("Expected database %+v, got %+v", want[i], info)
+		}
+		if h, ok := databases.Handler(info.ID); !ok || h.db.GetPath() != info.Path {
+			t.Errorf("Expected the handler of %s to serve %s", info.ID, info.Path)
+		}
+	}
+}
+
+func TestAPIHandler_ExportQuery_Write(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	r := chi.NewRouter()
+	r.Post("/api/query/export", handler.ExportQuery)
+
+	for _, query := range []string{"UPDATE users SET name = 'Hacked' RETURNING *", "DELETE FROM users"} {
+		body, _ := json.Marshal(models.QueryRequest{SQL: query})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/query/export", bytes.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d: %s", query, w.Code, w.Body.String())
+		}
+	}
+
+	var name string
+	if err := handler.db.GetConnection().QueryRow("SELECT name FROM users WHERE id = 1").Scan(&name); err != nil || name != "Alice" {
+		t.Errorf("Expected the row unchanged, got %q (%v)", name, err)
+	}
+}
+
+func TestAPIHandler_Export_Typed(t *testing.T) {
+	handler, dbPath := setupTestHandler(t, false)
+	defer os.Remove(dbPath)
+
+	_, err := handler.db.GetConnection().Exec(`CREATE TABLE files (id INTEGER PRIMARY KEY, data BLOB);
+		INSERT INTO files VALUES (9007199254740993, x'00ff10fe80')`)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/api/tables/{name}/export", handler.ExportTable)
+	for _, format := range []string{"json", "ndjson"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tables/files/export?format="+format, nil))
+		want := `{"id":"9007199254740993","data":{"type":"blob","base64":"AP8Q/oA="}}`
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: expected %s, got %d %q", format, want, w.Code, w.Body.String())
+		}
+	}
+}
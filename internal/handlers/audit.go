@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/audit"
+	"github.com/rzhade3/sqlite-webgui/internal/database"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// SetAudit records every row changed through the server in store.
+// Without a store, changes are not captured and GetAudit reports none.
+func (h *APIHandler) SetAudit(store *audit.Store) {
+	h.audit = store
+	h.db.SetChangeRecorder(h.recordChanges)
+}
+
+// recordChanges adds committed changes to the audit log. The changes are
+// already made, so failing to record them is logged rather than failing
+// the request.
+func (h *APIHandler) recordChanges(ctx context.Context, changes []models.AuditEntry) {
+	if err := h.audit.Record(ctx, h.databaseKey(), changes); err != nil {
+		log.Printf("Failed to record %d changes in the audit log: %v", len(changes), err)
+	}
+}
+
+// WithClient attributes the changes a request makes to its client
+// address.
+func WithClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+		next.ServeHTTP(w, r.WithContext(database.WithClient(r.Context(), client)))
+	})
+}
+
+func respondAuditError(w http.ResponseWriter, err error) {
+	if errors.Is(err, audit.ErrNotFound) {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	respondDBError(w, err)
+}
+
+// GetAudit lists the rows changed in this database, newest first. The
+// table parameter keeps the changes to one table.
+func (h *APIHandler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	if h.audit == nil {
+		respondJSON(w, http.StatusOK, []models.AuditEntry{})
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := h.audit.List(r.Context(), h.databaseKey(), query.Get("table"), limit, offset)
+	if err != nil {
+		respondAuditError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, entries)
+}
+
+// UndoChange applies the inverse of an audited change, provided the row
+// is still as the change left it, and responds with the entry marked
+// undone. The undo is itself recorded as a change.
+func (h *APIHandler) UndoChange(w http.ResponseWriter, r *http.Request) {
+	if h.audit == nil {
+		respondError(w, http.StatusServiceUnavailable, "The audit log is not available")
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		respondError(w, http.StatusBadRequest, "Invalid audit entry ID")
+		return
+	}
+
+	entry, err := h.audit.Get(r.Context(), h.databaseKey(), id)
+	if err != nil {
+		respondAuditError(w, err)
+		return
+	}
+	if entry.UndoneAt != nil {
+		respondError(w, http.StatusConflict, "This change has already been undone")
+		return
+	}
+
+	if err := h.db.UndoChange(r.Context(), *entry); err != nil {
+		respondAuditError(w, err)
+		return
+	}
+	now := time.Now().UTC()
+	if err := h.audit.MarkUndone(context.WithoutCancel(r.Context()), h.databaseKey(), id, now); err != nil {
+		respondAuditError(w, err)
+		return
+	}
+	entry.UndoneAt = &now
+	respondJSON(w, http.StatusOK, entry)
+}
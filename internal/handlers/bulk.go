@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// BulkDeleteRows deletes the rows selected by keys or a filter in one
+// transaction. With ?preview=true it reports how many rows would be
+// deleted, and the first of them, without deleting them.
+func (h *APIHandler) BulkDeleteRows(w http.ResponseWriter, r *http.Request) {
+	h.bulkWrite(w, r, h.db.DeleteRows)
+}
+
+// BulkUpdateRows sets values on the rows selected by keys or a filter in
+// one transaction, previewing like BulkDeleteRows.
+func (h *APIHandler) BulkUpdateRows(w http.ResponseWriter, r *http.Request) {
+	h.bulkWrite(w, r, h.db.UpdateRows)
+}
+
+func (h *APIHandler) bulkWrite(w http.ResponseWriter, r *http.Request, write func(context.Context, string, models.BulkRowRequest, bool) (*models.BulkRowResponse, error)) {
+	var req models.BulkRowRequest
+	if err := decodeExact(r.Body, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	result, err := write(r.Context(), chi.URLParam(r, "name"), req, isPreview(r))
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// maxCellBytes is SQLite's default limit on the size of a value.
+const maxCellBytes = 1_000_000_000
+
+// cellTarget reads the row key and column a cell request names.
+func cellTarget(w http.ResponseWriter, r *http.Request) (models.RowKey, string, bool) {
+	key, ok := keyParam(r)
+	if !ok {
+		respondError(w, http.StatusBadRequest, "Missing or invalid key query parameter")
+		return nil, "", false
+	}
+	column := r.URL.Query().Get("column")
+	if column == "" {
+		respondError(w, http.StatusBadRequest, "Missing column query parameter")
+		return nil, "", false
+	}
+	return key, column, true
+}
+
+// GetCell sends the raw bytes of a BLOB or TEXT cell, with a content type
+// sniffed from them. ?download=true makes browsers save it as a file.
+func (h *APIHandler) GetCell(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+	key, column, ok := cellTarget(w, r)
+	if !ok {
+		return
+	}
+
+	value, err := h.db.GetCell(r.Context(), tableName, key, column)
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	contentType := http.DetectContentType(value)
+	disposition := "inline"
+	if download, _ := strconv.ParseBool(r.URL.Query().Get("download")); download {
+		disposition = "attachment"
+	}
+	filename := tableName + "-" + column
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Stored HTML or SVG must not run as a page of this server.
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.WriteHeader(http.StatusOK)
+	w.Write(value)
+}
+
+// PutCell sets a cell to the request body, stored as a BLOB, and responds
+// with the row as stored like UpdateRow.
+func (h *APIHandler) PutCell(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+	key, column, ok := cellTarget(w, r)
+	if !ok {
+		return
+	}
+
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCellBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(w, http.StatusRequestEntityTooLarge, "Value is larger than SQLite allows")
+			return
+		}
+		respondError(w, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	row, err := h.db.UpdateRow(r.Context(), tableName, key, map[string]interface{}{column: value})
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.RowResponse{Message: "Row updated successfully", Row: row})
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// Databases is the set of database files a server has open, each with an
+// APIHandler of its own, so transactions, running queries and the
+// read-only flag are kept per database.
+type Databases struct {
+	infos    []models.DatabaseInfo
+	handlers map[string]*APIHandler
+}
+
+func NewDatabases() *Databases {
+	return &Databases{handlers: map[string]*APIHandler{}}
+}
+
+// Add adds the database h serves and returns its ID, made from its file
+// name so it reads well in a URL. Files with the same name are told
+// apart by a number.
+func (d *Databases) Add(h *APIHandler) string {
+	path := h.db.GetPath()
+	name := filepath.Base(path)
+
+	base := databaseID(name)
+	id := base
+	for n := 2; d.handlers[id] != nil; n++ {
+		id = base + "-" + strconv.Itoa(n)
+	}
+
+	d.handlers[id] = h
+	d.infos = append(d.infos, models.DatabaseInfo{ID: id, Name: name, Path: path, ReadOnly: h.db.IsReadOnly()})
+	return id
+}
+
+// databaseID keeps the letters, digits, '-' and '_' of a file name
+// without its extension, in lower case.
+func databaseID(name string) string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	id := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	id = strings.Trim(id, "-")
+	if id == "" {
+		return "db"
+	}
+	return id
+}
+
+// Handler returns the handler of the database with the given ID.
+func (d *Databases) Handler(id string) (*APIHandler, bool) {
+	h, ok := d.handlers[id]
+	return h, ok
+}
+
+// List returns the open databases in the order they were added.
+func (d *Databases) List() []models.DatabaseInfo {
+	return d.infos
+}
+
+// GetDatabases lists the open databases, the first being the one the
+// unscoped /api routes serve.
+func (d *Databases) GetDatabases(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, d.infos)
+}
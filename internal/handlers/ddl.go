@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// CreateTable creates a table from a definition. With ?preview=true the
+// generated SQL is returned without being run.
+func (h *APIHandler) CreateTable(w http.ResponseWriter, r *http.Request) {
+	var def models.TableDefinition
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if isPreview(r) {
+		statements, err := h.db.PlanCreateTable(r.Context(), def)
+		if err != nil {
+			respondDBError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, models.DDLResponse{SQL: statements})
+		return
+	}
+
+	statements, err := h.db.CreateTable(r.Context(), def)
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, models.DDLResponse{SQL: statements, Applied: true})
+}
+
+// AlterTable changes a table's structure. With ?preview=true the
+// generated SQL is returned without being run.
+func (h *APIHandler) AlterTable(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+
+	var req models.AlterTableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if isPreview(r) {
+		statements, err := h.db.PlanAlterTable(r.Context(), tableName, req)
+		if err != nil {
+			respondDBError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, models.DDLResponse{SQL: statements})
+		return
+	}
+
+	statements, err := h.db.AlterTable(r.Context(), tableName, req)
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.DDLResponse{SQL: statements, Applied: true})
+}
+
+func (h *APIHandler) GetTableDefinition(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+
+	def, err := h.db.GetTableDefinition(r.Context(), tableName)
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, def)
+}
+
+func isPreview(r *http.Request) bool {
+	preview, _ := strconv.ParseBool(r.URL.Query().Get("preview"))
+	return preview
+}
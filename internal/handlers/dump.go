@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// Dump streams the database as SQL. ?schema_only=true and
+// ?data_only=true pick one half, and ?tables=a,b limits the dump to the
+// named tables and views.
+func (h *APIHandler) Dump(w http.ResponseWriter, r *http.Request) {
+	var opts models.DumpOptions
+	opts.SchemaOnly, _ = strconv.ParseBool(r.URL.Query().Get("schema_only"))
+	opts.DataOnly, _ = strconv.ParseBool(r.URL.Query().Get("data_only"))
+	for _, name := range strings.Split(r.URL.Query().Get("tables"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Tables = append(opts.Tables, name)
+		}
+	}
+
+	base := filepath.Base(h.db.GetPath())
+	filename := strings.TrimSuffix(base, filepath.Ext(base)) + ".sql"
+
+	started := false
+	err := h.db.Dump(r.Context(), opts, func() (io.Writer, error) {
+		w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		started = true
+		return w, nil
+	})
+	if err == nil {
+		return
+	}
+	if !started {
+		respondDBError(w, err)
+		return
+	}
+
+	log.Printf("dump of %s failed: %v", filename, err)
+	panic(http.ErrAbortHandler)
+}
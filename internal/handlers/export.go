@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/database"
+	"github.com/rzhade3/sqlite-webgui/internal/export"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// ExportTable streams a table as ?format=csv|tsv|json|ndjson, applying
+// the same filter and sort parameters as GetTableData.
+func (h *APIHandler) ExportTable(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+
+	format := exportFormat(r.URL.Query().Get("format"))
+	if _, ok := export.ContentType(format); !ok {
+		respondError(w, http.StatusBadRequest, "Unknown format: "+format)
+		return
+	}
+
+	filter, err := parseFilter(r.URL.Query().Get("filter"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid filter JSON")
+		return
+	}
+	req := models.TableDataRequest{Filter: filter, Sort: parseSort(r.URL.Query().Get("sort"))}
+
+	stream := newExportStream(w, format, tableName)
+	stream.finish(h.db.ExportTable(r.Context(), tableName, req, stream.begin))
+}
+
+// ExportQuery streams the result of a query. Besides a JSON
+// models.QueryRequest body it accepts a form with "sql", "format" and
+// "query_id" fields, and "params" as JSON, so a browser can download the
+// export with a plain form post. Like ExecuteQuery, a running export can
+// be cancelled by its query ID.
+func (h *APIHandler) ExportQuery(w http.ResponseWriter, r *http.Request) {
+	var req models.QueryRequest
+	format := r.URL.Query().Get("format")
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		req.SQL = r.PostFormValue("sql")
+		req.QueryID = r.PostFormValue("query_id")
+		if f := r.PostFormValue("format"); f != "" {
+			format = f
+		}
+		if params := r.PostFormValue("params"); params != "" {
+			if err := decodeExact(strings.NewReader(params), &req.Params); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid params JSON")
+				return
+			}
+		}
+	} else if err := decodeExact(r.Body, &req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	format = exportFormat(format)
+	if _, ok := export.ContentType(format); !ok {
+		respondError(w, http.StatusBadRequest, "Unknown format: "+format)
+		return
+	}
+
+	if len(req.QueryID) > maxQueryIDLength {
+		respondError(w, http.StatusBadRequest, "Query ID is too long")
+		return
+	}
+	ctx, _, done, ok := h.queries.start(r.Context(), req.QueryID)
+	if !ok {
+		respondError(w, http.StatusConflict, "A query with this ID is already running")
+		return
+	}
+	defer done()
+
+	stream := newExportStream(w, format, "query")
+	stream.finish(h.db.ExportQuery(ctx, req.SQL, req.Params, stream.begin))
+}
+
+func exportFormat(format string) string {
+	if format == "" {
+		return export.CSV
+	}
+	return strings.ToLower(format)
+}
+
+// exportStream writes an export to the response once the query has
+// started, so errors found before then still get a normal error response.
+type exportStream struct {
+	w        http.ResponseWriter
+	format   string
+	filename string
+	started  bool
+}
+
+func newExportStream(w http.ResponseWriter, format, name string) *exportStream {
+	return &exportStream{w: w, format: format, filename: name + "." + format}
+}
+
+func (s *exportStream) begin(columns []string) (database.RowWriter, error) {
+	contentType, _ := export.ContentType(s.format)
+	s.w.Header().Set("Content-Type", contentType)
+	s.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": s.filename}))
+	s.started = true
+	return export.NewWriter(s.format, s.w, columns)
+}
+
+func (s *exportStream) finish(err error) {
+	if err == nil {
+		return
+	}
+	if !s.started {
+		respondDBError(s.w, err)
+		return
+	}
+
+	// Part of the export has been sent with a 200 status. Aborting the
+	// connection is the only way left to tell the client it is incomplete.
+	log.Printf("export of %s failed: %v", s.filename, err)
+	panic(http.ErrAbortHandler)
+}
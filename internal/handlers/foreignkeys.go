@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// referencingRowsLimit caps how many rows are returned per referencing
+// foreign key; the total count is still reported.
+const referencingRowsLimit = 20
+
+func (h *APIHandler) GetReferencingRows(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+
+	key, ok := keyParam(r)
+	if !ok {
+		respondError(w, http.StatusBadRequest, "Missing or invalid key query parameter")
+		return
+	}
+
+	refs, err := h.db.GetReferencingRows(r.Context(), tableName, key, referencingRowsLimit)
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	if refs == nil {
+		refs = []models.ReferencingRows{}
+	}
+	respondJSON(w, http.StatusOK, refs)
+}
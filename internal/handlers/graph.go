@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+func (h *APIHandler) GetSchemaGraph(w http.ResponseWriter, r *http.Request) {
+	graph, err := h.db.GetSchemaGraph(r.Context())
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		respondJSON(w, http.StatusOK, graph)
+	case "dot":
+		respondText(w, "text/vnd.graphviz", renderDOT(graph))
+	case "mermaid":
+		respondText(w, "text/plain", renderMermaid(graph))
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown format %q (expected json, dot or mermaid)", format))
+	}
+}
+
+func respondText(w http.ResponseWriter, contentType, body string) {
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body))
+}
+
+// dotID quotes s as a Graphviz ID.
+func dotID(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// renderDOT draws each table as an HTML-like record with one port per
+// column, so foreign key edges attach to the columns they connect.
+func renderDOT(graph *models.SchemaGraph) string {
+	var b strings.Builder
+	b.WriteString("digraph schema {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=plaintext, fontname=\"Helvetica\"];\n")
+	b.WriteString("\tedge [fontname=\"Helvetica\", fontsize=10];\n\n")
+
+	for _, table := range graph.Tables {
+		fmt.Fprintf(&b, "\t%s [label=<\n", dotID(table.Name))
+		b.WriteString("\t\t<table border=\"0\" cellborder=\"1\" cellspacing=\"0\">\n")
+		fmt.Fprintf(&b, "\t\t\t<tr><td bgcolor=\"lightgrey\"><b>%s</b></td></tr>\n", html.EscapeString(table.Name))
+		for _, col := range table.Columns {
+			label := html.EscapeString(col.Name)
+			if col.PrimaryKey {
+				label = "<u>" + label + "</u>"
+			}
+			if col.Type != "" {
+				label += " <i>" + html.EscapeString(col.Type) + "</i>"
+			}
+			// The port is an attribute in the HTML-like label, so it is
+			// escaped as HTML; edges name it as a DOT ID.
+			fmt.Fprintf(&b, "\t\t\t<tr><td port=\"%s\" align=\"left\">%s</td></tr>\n", html.EscapeString(col.Name), label)
+		}
+		b.WriteString("\t\t</table>\n\t>];\n")
+	}
+
+	if len(graph.Edges) > 0 {
+		b.WriteString("\n")
+	}
+	for _, edge := range graph.Edges {
+		style := "solid"
+		if edge.Optional {
+			style = "dashed"
+		}
+		fmt.Fprintf(&b, "\t%s:%s -> %s:%s [label=%s, style=%s];\n",
+			dotID(edge.FromTable), dotID(edge.FromColumns[0]),
+			dotID(edge.ToTable), dotID(edge.ToColumns[0]),
+			dotID(strings.Join(edge.FromColumns, ", ")), style)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+var (
+	mermaidUnsafe     = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+	mermaidTypeUnsafe = regexp.MustCompile(`[^A-Za-z0-9_()-]`)
+)
+
+// mermaidName reduces s to the characters Mermaid accepts in entity and
+// attribute names.
+func mermaidName(s string) string {
+	s = mermaidUnsafe.ReplaceAllString(s, "_")
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// mermaidNames maps each of names to a distinct mermaidName, adding a
+// numbered suffix where two would otherwise reduce to the same one.
+func mermaidNames(names []string) map[string]string {
+	mapped := make(map[string]string, len(names))
+	taken := map[string]bool{}
+	for _, name := range names {
+		if _, ok := mapped[name]; ok {
+			continue
+		}
+		base := mermaidName(name)
+		unique := base
+		for n := 2; taken[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", base, n)
+		}
+		taken[unique] = true
+		mapped[name] = unique
+	}
+	return mapped
+}
+
+// mermaidType is like mermaidName but keeps the parentheses of types
+// such as VARCHAR(255).
+func mermaidType(s string) string {
+	if s == "" {
+		return "ANY"
+	}
+	return mermaidTypeUnsafe.ReplaceAllString(s, "_")
+}
+
+func renderMermaid(graph *models.SchemaGraph) string {
+	var b strings.Builder
+	b.WriteString("erDiagram\n")
+
+	// Edges may name a table that is missing from the schema.
+	var tableNames []string
+	for _, table := range graph.Tables {
+		tableNames = append(tableNames, table.Name)
+	}
+	for _, edge := range graph.Edges {
+		tableNames = append(tableNames, edge.FromTable, edge.ToTable)
+	}
+	entities := mermaidNames(tableNames)
+
+	for _, table := range graph.Tables {
+		columnNames := make([]string, len(table.Columns))
+		for i, col := range table.Columns {
+			columnNames[i] = col.Name
+		}
+		attributes := mermaidNames(columnNames)
+
+		fmt.Fprintf(&b, "    %s {\n", entities[table.Name])
+		for _, col := range table.Columns {
+			var keys []string
+			if col.PrimaryKey {
+				keys = append(keys, "PK")
+			}
+			if col.ForeignKey {
+				keys = append(keys, "FK")
+			}
+			fmt.Fprintf(&b, "        %s %s", mermaidType(col.Type), attributes[col.Name])
+			if len(keys) > 0 {
+				fmt.Fprintf(&b, " %s", strings.Join(keys, ","))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("    }\n")
+	}
+
+	for _, edge := range graph.Edges {
+		parent := "||"
+		if edge.Optional {
+			parent = "o|"
+		}
+		label := strings.ReplaceAll(strings.Join(edge.FromColumns, ", "), `"`, "'")
+		fmt.Fprintf(&b, "    %s }o--%s %s : \"%s\"\n",
+			entities[edge.FromTable], parent, entities[edge.ToTable], label)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rzhade3/sqlite-webgui/internal/history"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// SetHistory records the statements run from the query editor in store.
+// Without a store, history is not kept and GetHistory reports none.
+func (h *APIHandler) SetHistory(store *history.Store) {
+	h.history = store
+}
+
+// databaseKey names the database in the history and the library, so the
+// same file opened by another path shares them.
+func (h *APIHandler) databaseKey() string {
+	path := h.db.GetPath()
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path
+}
+
+// recordHistory adds the statements of a script that ran to the history.
+// Fetching a later page re-runs a statement already recorded, so it is
+// not recorded again. Failing to record is logged rather than failing the
+// query.
+func (h *APIHandler) recordHistory(ctx context.Context, req models.QueryRequest, started time.Time, result *models.ScriptResult) {
+	if h.history == nil || req.Page > 1 {
+		return
+	}
+
+	entries := make([]models.HistoryEntry, 0, len(result.Statements))
+	executedAt := started
+	for _, stmt := range result.Statements {
+		entry := models.HistoryEntry{
+			SQL:        stmt.SQL,
+			ExecutedAt: executedAt,
+			DurationMs: stmt.DurationMs,
+			Error:      stmt.Error,
+			Params:     req.Params,
+		}
+		switch {
+		case stmt.RowsAffected != nil:
+			entry.RowCount = stmt.RowsAffected
+		case stmt.RowsReturned != nil:
+			entry.RowCount = stmt.RowsReturned
+		case stmt.Result != nil && !stmt.Result.Truncated:
+			count := int64(stmt.Result.Total)
+			entry.RowCount = &count
+		}
+		entries = append(entries, entry)
+		executedAt = executedAt.Add(time.Duration(stmt.DurationMs * float64(time.Millisecond)))
+	}
+
+	// The query may have been cancelled, but what ran is still recorded.
+	if err := h.history.Record(context.WithoutCancel(ctx), h.databaseKey(), entries); err != nil {
+		log.Printf("Failed to record query history: %v", err)
+	}
+}
+
+// GetHistory lists the statements run against this database, newest
+// first. The q parameter keeps those whose SQL contains it.
+func (h *APIHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	if h.history == nil {
+		respondJSON(w, http.StatusOK, []models.HistoryEntry{})
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := h.history.Search(r.Context(), h.databaseKey(), query.Get("q"), limit, offset)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// ImportCSV reads a multipart form with an optional "options" field
+// holding models.CSVImportOptions as JSON, followed by a "file" field
+// with the CSV. The parts are read in order so the file is streamed into
+// the database rather than buffered, which means options must come first.
+// In abort mode, the default, the whole file goes in one transaction, so
+// the database stays locked for writes until the import finishes; skip
+// mode commits in batches instead.
+func (h *APIHandler) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Expected a multipart form")
+		return
+	}
+
+	opts := models.CSVImportOptions{Header: true, EmptyAsNull: true}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			respondError(w, http.StatusBadRequest, "Missing file")
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid multipart form")
+			return
+		}
+
+		switch part.FormName() {
+		case "options":
+			if err := json.NewDecoder(part).Decode(&opts); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid options JSON")
+				return
+			}
+
+		case "file":
+			result, err := h.db.ImportCSV(r.Context(), tableName, part, opts)
+			if err != nil {
+				respondDBError(w, err)
+				return
+			}
+
+			status := http.StatusOK
+			switch {
+			case result.Aborted:
+				status = http.StatusUnprocessableEntity
+			case result.Created:
+				status = http.StatusCreated
+			}
+			respondJSON(w, status, result)
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+func (h *APIHandler) GetIndexes(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+
+	indexes, err := h.db.GetIndexes(r.Context(), tableName)
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	if indexes == nil {
+		indexes = []models.Index{}
+	}
+	respondJSON(w, http.StatusOK, indexes)
+}
+
+func (h *APIHandler) CreateIndex(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+
+	var req models.CreateIndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if err := h.db.CreateIndex(r.Context(), tableName, req); err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, map[string]string{"message": "Index created successfully"})
+}
+
+func (h *APIHandler) DropIndex(w http.ResponseWriter, r *http.Request) {
+	tableName := chi.URLParam(r, "name")
+	indexName := chi.URLParam(r, "index")
+
+	if err := h.db.DropIndex(r.Context(), tableName, indexName); err != nil {
+		respondDBError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Index dropped successfully"})
+}
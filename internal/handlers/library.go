@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/library"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// SetLibrary keeps saved queries in store. Without a store, the saved
+// query endpoints report the library as unavailable.
+func (h *APIHandler) SetLibrary(store *library.Store) {
+	h.library = store
+}
+
+// requireLibrary responds with an error and returns false when there is
+// no library to use.
+func (h *APIHandler) requireLibrary(w http.ResponseWriter) bool {
+	if h.library == nil {
+		respondError(w, http.StatusServiceUnavailable, "Saved queries are not available")
+		return false
+	}
+	return true
+}
+
+func respondLibraryError(w http.ResponseWriter, err error) {
+	var invalid *library.ValidationError
+	switch {
+	case errors.Is(err, library.ErrNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, library.ErrNameTaken):
+		respondError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &invalid):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// GetSavedQueries lists the saved queries of this database by name.
+func (h *APIHandler) GetSavedQueries(w http.ResponseWriter, r *http.Request) {
+	if h.library == nil {
+		respondJSON(w, http.StatusOK, []models.SavedQuery{})
+		return
+	}
+
+	queries, err := h.library.List(r.Context(), h.databaseKey())
+	if err != nil {
+		respondLibraryError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, queries)
+}
+
+// SaveQuery adds a query to the library, or with an {id} in the path
+// replaces that saved query.
+func (h *APIHandler) SaveQuery(w http.ResponseWriter, r *http.Request) {
+	if !h.requireLibrary(w) {
+		return
+	}
+
+	var q models.SavedQuery
+	if err := decodeExact(r.Body, &q); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	status := http.StatusCreated
+	q.ID = 0
+	if param := chi.URLParam(r, "id"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || id <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid saved query ID")
+			return
+		}
+		q.ID = id
+		status = http.StatusOK
+	}
+
+	if err := library.Validate(&q); err != nil {
+		respondLibraryError(w, err)
+		return
+	}
+	saved, err := h.library.Save(r.Context(), h.databaseKey(), q)
+	if err != nil {
+		respondLibraryError(w, err)
+		return
+	}
+	respondJSON(w, status, saved)
+}
+
+// DeleteSavedQuery removes a query from the library.
+func (h *APIHandler) DeleteSavedQuery(w http.ResponseWriter, r *http.Request) {
+	if !h.requireLibrary(w) {
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid saved query ID")
+		return
+	}
+	if err := h.library.Delete(r.Context(), h.databaseKey(), id); err != nil {
+		respondLibraryError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Saved query deleted successfully"})
+}
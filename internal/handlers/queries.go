@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/database"
+)
+
+// maxQueryIDLength bounds the IDs clients may choose for their queries.
+const maxQueryIDLength = 64
+
+// queryRegistry tracks the running queries by ID so they can be
+// cancelled from another request.
+type queryRegistry struct {
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
+}
+
+func newQueryRegistry() *queryRegistry {
+	return &queryRegistry{running: map[string]context.CancelCauseFunc{}}
+}
+
+func newQueryID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start registers a query under id, or under a new ID if id is empty.
+// The returned context is cancelled by cancel(id); done must be called
+// when the query finishes. ok is false if id is already in use.
+func (q *queryRegistry) start(ctx context.Context, id string) (queryCtx context.Context, queryID string, done func(), ok bool) {
+	if id == "" {
+		id = newQueryID()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, exists := q.running[id]; exists {
+		return nil, "", nil, false
+	}
+
+	queryCtx, cancel := context.WithCancelCause(ctx)
+	q.running[id] = cancel
+	done = func() {
+		q.mu.Lock()
+		delete(q.running, id)
+		q.mu.Unlock()
+		cancel(nil)
+	}
+	return queryCtx, id, done, true
+}
+
+// cancel interrupts the query running under id, reporting whether there
+// was one.
+func (q *queryRegistry) cancel(id string) bool {
+	q.mu.Lock()
+	cancel, ok := q.running[id]
+	q.mu.Unlock()
+	if ok {
+		cancel(database.ErrQueryCancelled)
+	}
+	return ok
+}
+
+// CancelQuery interrupts the query started with the given ID. The query's
+// own request then responds with the statements run so far.
+func (h *APIHandler) CancelQuery(w http.ResponseWriter, r *http.Request) {
+	if !h.queries.cancel(chi.URLParam(r, "id")) {
+		respondError(w, http.StatusNotFound, "No running query with this ID")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
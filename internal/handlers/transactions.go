@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rzhade3/sqlite-webgui/internal/database"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+)
+
+// TransactionHeader carries the ID of the transaction session a request
+// runs in.
+const TransactionHeader = "X-Transaction-ID"
+
+const noTransactionMessage = "No open transaction with this ID; it may have been rolled back"
+
+// defaultTransactionTimeout is how long a transaction session may sit
+// unused before it is rolled back.
+const defaultTransactionTimeout = 5 * time.Minute
+
+// transaction is an open session. mu is held while a request uses it;
+// lastUsed and ended may be read without it.
+type transaction struct {
+	id        string
+	session   *database.Session
+	startedAt time.Time
+
+	mu       sync.Mutex
+	lastUsed atomic.Int64 // UnixNano
+	ended    atomic.Bool
+	timer    *time.Timer
+}
+
+// transactionRegistry tracks the open transaction sessions by ID and
+// rolls back those left idle.
+type transactionRegistry struct {
+	mu          sync.Mutex
+	open        map[string]*transaction
+	idleTimeout time.Duration
+}
+
+func newTransactionRegistry() *transactionRegistry {
+	return &transactionRegistry{open: map[string]*transaction{}, idleTimeout: defaultTransactionTimeout}
+}
+
+func (reg *transactionRegistry) add(session *database.Session) *transaction {
+	t := &transaction{id: newQueryID(), session: session, startedAt: time.Now()}
+	t.lastUsed.Store(t.startedAt.UnixNano())
+	t.timer = time.AfterFunc(reg.idleTimeout, func() { reg.expire(t) })
+
+	reg.mu.Lock()
+	reg.open[t.id] = t
+	reg.mu.Unlock()
+	return t
+}
+
+// acquire locks the transaction with the given ID for a request, waiting
+// for any other request using it. ok is false if there is none.
+func (reg *transactionRegistry) acquire(id string) (t *transaction, ok bool) {
+	reg.mu.Lock()
+	t, ok = reg.open[id]
+	reg.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	t.mu.Lock()
+	if t.ended.Load() {
+		t.mu.Unlock()
+		return nil, false
+	}
+	return t, true
+}
+
+// peek returns the transaction with the given ID without locking it or
+// counting as a use.
+func (reg *transactionRegistry) peek(id string) (*transaction, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	t, ok := reg.open[id]
+	return t, ok && !t.ended.Load()
+}
+
+// release unlocks a transaction and restarts its idle timeout.
+func (reg *transactionRegistry) release(t *transaction) {
+	if !t.ended.Load() {
+		t.lastUsed.Store(time.Now().UnixNano())
+		t.timer.Reset(reg.idleTimeout)
+	}
+	t.mu.Unlock()
+}
+
+// end commits or rolls back a transaction locked by the caller. A failed
+// commit leaves it open.
+func (reg *transactionRegistry) end(ctx context.Context, t *transaction, commit bool) error {
+	if commit {
+		if err := t.session.Commit(ctx); err != nil {
+			return err
+		}
+	} else if err := t.session.Rollback(ctx); err != nil {
+		log.Printf("Failed to roll back transaction %s: %v", t.id, err)
+	}
+
+	t.ended.Store(true)
+	t.timer.Stop()
+	reg.mu.Lock()
+	delete(reg.open, t.id)
+	reg.mu.Unlock()
+	return nil
+}
+
+func (reg *transactionRegistry) expire(t *transaction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// A request may have used the transaction while the timer fired.
+	if t.ended.Load() || time.Since(time.Unix(0, t.lastUsed.Load())) < reg.idleTimeout {
+		return
+	}
+	log.Printf("Rolling back transaction %s after %s idle", t.id, reg.idleTimeout)
+	reg.end(context.Background(), t, false)
+}
+
+func (reg *transactionRegistry) status(t *transaction) models.TransactionStatus {
+	lastUsed := time.Unix(0, t.lastUsed.Load())
+	return models.TransactionStatus{ID: t.id, StartedAt: t.startedAt, ExpiresAt: lastUsed.Add(reg.idleTimeout)}
+}
+
+type transactionKey struct{}
+
+// SetTransactionTimeout sets how long a transaction session may sit
+// unused before it is rolled back. timeout must be positive.
+func (h *APIHandler) SetTransactionTimeout(timeout time.Duration) {
+	h.transactions.idleTimeout = timeout
+}
+
+// WithTransaction runs requests carrying TransactionHeader in that
+// transaction session. Requests in one session run one at a time.
+func (h *APIHandler) WithTransaction(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(TransactionHeader)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t, ok := h.transactions.acquire(id)
+		if !ok {
+			respondError(w, http.StatusNotFound, noTransactionMessage)
+			return
+		}
+		defer h.transactions.release(t)
+
+		ctx := database.WithSession(r.Context(), t.session)
+		ctx = context.WithValue(ctx, transactionKey{}, t)
+		next.ServeHTTP(w, r.WithContext(ctx))
+
+		if !t.ended.Load() && !t.session.Active() {
+			log.Printf("Transaction %s was rolled back by SQLite", t.id)
+			h.transactions.end(context.WithoutCancel(ctx), t, false)
+		}
+	})
+}
+
+// transactionFor locks the transaction named in the path, unless the
+// request already runs in it. done must be called when finished.
+func (h *APIHandler) transactionFor(r *http.Request) (t *transaction, done func(), ok bool) {
+	id := chi.URLParam(r, "id")
+	if held, _ := r.Context().Value(transactionKey{}).(*transaction); held != nil && held.id == id {
+		return held, func() {}, true
+	}
+	if t, ok = h.transactions.acquire(id); !ok {
+		return nil, nil, false
+	}
+	return t, func() { h.transactions.release(t) }, true
+}
+
+// BeginTransaction opens a transaction session. Requests sending its ID
+// in TransactionHeader run in it until it is committed or rolled back.
+func (h *APIHandler) BeginTransaction(w http.ResponseWriter, r *http.Request) {
+	session, err := h.db.BeginSession(r.Context())
+	if err != nil {
+		respondDBError(w, err)
+		return
+	}
+	t := h.transactions.add(session)
+	respondJSON(w, http.StatusCreated, h.transactions.status(t))
+}
+
+// GetTransaction reports whether a transaction is still open and when it
+// will be rolled back if left unused. Asking does not count as a use.
+func (h *APIHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.transactions.peek(chi.URLParam(r, "id"))
+	if !ok {
+		respondError(w, http.StatusNotFound, noTransactionMessage)
+		return
+	}
+	respondJSON(w, http.StatusOK, h.transactions.status(t))
+}
+
+func (h *APIHandler) CommitTransaction(w http.ResponseWriter, r *http.Request) {
+	h.endTransaction(w, r, true)
+}
+
+func (h *APIHandler) RollbackTransaction(w http.ResponseWriter, r *http.Request) {
+	h.endTransaction(w, r, false)
+}
+
+func (h *APIHandler) endTransaction(w http.ResponseWriter, r *http.Request, commit bool) {
+	t, done, ok := h.transactionFor(r)
+	if !ok {
+		respondError(w, http.StatusNotFound, noTransactionMessage)
+		return
+	}
+	defer done()
+
+	if err := h.transactions.end(r.Context(), t, commit); err != nil {
+		respondDBError(w, err)
+		return
+	}
+	message := "Transaction rolled back"
+	if commit {
+		message = "Transaction committed"
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": message})
+}
@@ -2,29 +2,164 @@ function app() {
     return {
         loading: false,
         tables: [],
+        showSystemTables: false,
+        tableGroupLabels: {
+            table: 'Tables',
+            view: 'Views',
+            virtual: 'Virtual Tables',
+            shadow: 'Shadow Tables',
+            internal: 'System Tables'
+        },
         selectedTable: null,
         tableData: null,
         schema: [],
+        indexes: [],
+        activeTab: 'data',
+        showDiagram: false,
+        graph: null,
+        graphPositions: {},
+        dragging: null,
+        newIndex: { name: '', columns: [], unique: false, where: '' },
+        newColumn: null,
+        showTableEditor: false,
+        tableEditor: { mode: 'create', table: null, definition: null, sql: '' },
+        showDDLModal: false,
+        showImportModal: false,
+        importForm: null,
+        importHeaders: [],
+        importResult: null,
+        exportFormat: 'csv',
+        ddl: { title: '', url: '', body: null, sql: [] },
         currentPage: 1,
+        cursors: [''],
+        sort: [],
+        filters: [],
+        filterMatch: 'all',
+        filterOperators: ['=', '!=', '<', '<=', '>', '>=', 'LIKE', 'NOT LIKE', 'IN', 'NOT IN', 'BETWEEN', 'IS NULL', 'IS NOT NULL'],
         showInsertModal: false,
         showEditModal: false,
         showQueryModal: false,
+        showDetailModal: false,
+        detailRow: { values: {}, key: {}, referencing: [] },
         newRow: {},
-        editingRow: { values: {} },
+        // newRowModes and editingRow.modes say whether each column takes
+        // the value typed, NULL, or its default.
+        newRowModes: {},
+        // files holds the files picked for BLOB columns, uploaded once the
+        // other values are saved.
+        editingRow: { index: null, key: {}, values: {}, modes: {}, files: {}, initial: { values: {}, modes: {} } },
+        // blobViewer shows a BLOB cell of the current page, with a preview
+        // when it is an image.
+        blobViewer: { show: false, index: null, column: '', blob: null, url: null },
+        // selectedRows holds the indexes of the checked rows on the
+        // current page; bulk actions apply to them or to every row
+        // matching the filters, as bulkScope says.
+        selectedRows: [],
+        bulkScope: 'selected',
+        bulkUpdate: { column: '', value: '', isNull: false },
         customQuery: '',
         queryResult: null,
+        queryTransaction: false,
+        runningQueryId: null,
+        queryPageSize: 100,
+        showHistory: false,
+        historyEntries: [],
+        historySearch: '',
+        showLibrary: false,
+        savedQueries: [],
+        // activeSavedQuery is the saved query loaded into the editor, whose
+        // parameter types and defaults fill the parameter form.
+        activeSavedQuery: null,
+        paramForm: null,
+        saveForm: null,
+        lastParams: null,
+        showAuditModal: false,
+        auditEntries: [],
+        auditTable: '',
+        auditMore: false,
+        // transaction is the open transaction session, if any; every API
+        // request runs in it until it is committed or rolled back.
+        transaction: null,
+        transactionPoll: null,
         darkMode: false,
         readonly: false,
+        // databases are the files the server has open; apiBase is where
+        // the API of the one being browsed, database, is served.
+        databases: [],
+        database: null,
+        apiBase: '/api',
+
+        // api is fetch for API requests, run in the open transaction if
+        // there is one.
+        api(url, options = {}) {
+            if (this.transaction) {
+                options = { ...options, headers: { ...options.headers, 'X-Transaction-ID': this.transaction.id } };
+            }
+            return fetch(url, options);
+        },
 
         async init() {
             this.initDarkMode();
+            await this.loadDatabases();
+            await this.loadMode();
+            await this.loadTables();
+        },
+
+        async loadDatabases() {
+            try {
+                const response = await fetch('/api/databases');
+                this.databases = await response.json();
+            } catch (error) {
+                console.error('Failed to load databases:', error);
+                return;
+            }
+            const saved = localStorage.getItem('database');
+            const database = this.databases.find(d => d.id === saved) || this.databases[0];
+            if (database) {
+                this.useDatabase(database.id);
+            }
+        },
+
+        useDatabase(id) {
+            this.database = id;
+            this.apiBase = `/api/db/${encodeURIComponent(id)}`;
+            localStorage.setItem('database', id);
+        },
+
+        // switchDatabase browses another database. A transaction belongs
+        // to its database, so it has to be ended first.
+        async switchDatabase(id) {
+            if (id === this.database) {
+                return;
+            }
+            if (this.transaction) {
+                alert('Commit or roll back the open transaction before switching databases.');
+                // Put the switcher back on the current database.
+                const current = this.database;
+                this.database = null;
+                this.$nextTick(() => { this.database = current; });
+                return;
+            }
+            this.useDatabase(id);
+            this.selectedTable = null;
+            this.tableData = null;
+            this.schema = [];
+            this.indexes = [];
+            this.showDiagram = false;
+            this.graph = null;
+            this.graphPositions = {};
+            this.selectedRows = [];
+            this.queryResult = null;
+            this.activeSavedQuery = null;
+            this.showHistory = false;
+            this.showLibrary = false;
             await this.loadMode();
             await this.loadTables();
         },
 
         async loadMode() {
             try {
-                const response = await fetch('/api/mode');
+                const response = await this.api(`${this.apiBase}/mode`);
                 const data = await response.json();
                 this.readonly = data.readonly;
             } catch (error) {
@@ -64,8 +199,8 @@ function app() {
         async loadTables() {
             this.loading = true;
             try {
-                const response = await fetch('/api/tables');
-                this.tables = await response.json();
+                const response = await this.api(`${this.apiBase}/tables?system=${this.showSystemTables}`);
+                this.tables = (await response.json()) || [];
             } catch (error) {
                 console.error('Failed to load tables:', error);
                 alert('Failed to load tables');
@@ -74,36 +209,656 @@ function app() {
             }
         },
 
-        async selectTable(tableName) {
+        tableGroups() {
+            return Object.entries(this.tableGroupLabels)
+                .map(([type, label]) => ({ type, label, tables: this.tables.filter(t => t.type === type) }))
+                .filter(group => group.tables.length > 0);
+        },
+
+        selectedObject() {
+            return this.tables.find(t => t.name === this.selectedTable);
+        },
+
+        canInsert() {
+            const object = this.selectedObject();
+            return !this.readonly && object && !object.readonly;
+        },
+
+        canEditRows() {
+            return this.canInsert() && (this.tableData?.key_columns || []).length > 0;
+        },
+
+        hasNextPage() {
+            if (!this.tableData) {
+                return false;
+            }
+            if (this.tableData.next_cursor) {
+                return true;
+            }
+            // Objects without a row key (views) page by offset instead of by cursor.
+            return !(this.tableData.key_columns || []).length &&
+                this.tableData.page * this.tableData.limit < this.tableData.total;
+        },
+
+        async selectTable(tableName, filters = []) {
+            this.showDiagram = false;
             this.selectedTable = tableName;
             this.currentPage = 1;
+            this.cursors = [''];
+            this.sort = [];
+            this.filters = filters;
+            this.bulkScope = 'selected';
+            this.bulkUpdate = { column: '', value: '', isNull: false };
+            this.activeTab = 'data';
             await this.loadSchema();
+            await this.loadIndexes();
             await this.loadTableData();
         },
 
         async loadSchema() {
             try {
-                const response = await fetch(`/api/tables/${this.selectedTable}/schema`);
+                const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/schema`);
                 this.schema = await response.json();
             } catch (error) {
                 console.error('Failed to load schema:', error);
             }
         },
 
-        async loadTableData() {
+        columnReferences(column) {
+            return this.schema.find(c => c.name === column)?.references || [];
+        },
+
+        // Follows the foreign key that column belongs to, filtering the
+        // referenced table on every column of the (possibly composite) key.
+        async followReference(column, row) {
+            const ref = this.columnReferences(column)[0];
+            const parts = this.schema.flatMap(c => (c.references || [])
+                .filter(r => r.foreign_key_id === ref.foreign_key_id)
+                .map(r => ({ from: c.name, to: r.column })));
+
+            const filters = parts.map(p => ({
+                column: p.to,
+                op: '=',
+                value: String(row[this.tableData.columns.indexOf(p.from)].value),
+                value2: ''
+            }));
+            this.showDetailModal = false;
+            await this.selectTable(ref.table, filters);
+        },
+
+        async showRowDetail(row, idx) {
+            const values = {};
+            this.tableData.columns.forEach((col, colIdx) => {
+                values[col] = row[colIdx];
+            });
+            const key = this.tableData.keys?.[idx];
+            this.detailRow = { values, row, key, referencing: [] };
+            this.showDetailModal = true;
+
+            if (!key) {
+                return;
+            }
+
+            try {
+                const params = new URLSearchParams({ key: JSON.stringify(key) });
+                const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/referencing?${params}`);
+                if (response.ok) {
+                    this.detailRow.referencing = await response.json();
+                }
+            } catch (error) {
+                console.error('Failed to load referencing rows:', error);
+            }
+        },
+
+        async openReferencing(ref) {
+            const filters = ref.foreign_key.from.map((col, i) => ({
+                column: col,
+                op: '=',
+                value: String(this.detailRow.values[ref.foreign_key.to[i]].value),
+                value2: ''
+            }));
+            this.showDetailModal = false;
+            await this.selectTable(ref.table, filters);
+        },
+
+        // Schema diagram: tables are laid out on a grid and can be dragged;
+        // clicking a table name opens it.
+        graphBoxWidth: 220,
+        graphHeaderHeight: 28,
+        graphRowHeight: 20,
+
+        async openDiagram() {
+            this.showDiagram = true;
+            this.selectedTable = null;
+            try {
+                const response = await this.api(`${this.apiBase}/schema/graph`);
+                this.graph = await response.json();
+                const perRow = Math.max(1, Math.ceil(Math.sqrt(this.graph.tables.length)));
+                const rowHeights = [];
+                this.graph.tables.forEach((table, i) => {
+                    const row = Math.floor(i / perRow);
+                    rowHeights[row] = Math.max(rowHeights[row] || 0, this.graphBoxHeight(table));
+                });
+                this.graphPositions = {};
+                this.graph.tables.forEach((table, i) => {
+                    const row = Math.floor(i / perRow);
+                    const y = rowHeights.slice(0, row).reduce((sum, h) => sum + h + 60, 20);
+                    this.graphPositions[table.name] = { x: 20 + (i % perRow) * (this.graphBoxWidth + 100), y };
+                });
+            } catch (error) {
+                console.error('Failed to load schema graph:', error);
+                alert('Failed to load schema graph');
+            }
+        },
+
+        graphBoxHeight(table) {
+            return this.graphHeaderHeight + table.columns.length * this.graphRowHeight;
+        },
+
+        graphSize() {
+            let width = 0;
+            let height = 0;
+            for (const table of this.graph?.tables || []) {
+                const pos = this.graphPositions[table.name];
+                width = Math.max(width, pos.x + this.graphBoxWidth + 20);
+                height = Math.max(height, pos.y + this.graphBoxHeight(table) + 20);
+            }
+            return { width, height };
+        },
+
+        graphColumnY(tableName, column) {
+            const table = this.graph.tables.find(t => t.name.toLowerCase() === tableName.toLowerCase());
+            if (!table) {
+                return null;
+            }
+            const idx = Math.max(0, table.columns.findIndex(c => c.name.toLowerCase() === column.toLowerCase()));
+            return this.graphPositions[table.name].y + this.graphHeaderHeight + idx * this.graphRowHeight + this.graphRowHeight / 2;
+        },
+
+        graphEdgePath(edge) {
+            const from = this.graphPositions[edge.from_table];
+            const toTable = this.graph.tables.find(t => t.name.toLowerCase() === edge.to_table.toLowerCase());
+            if (!from || !toTable) {
+                return '';
+            }
+            const to = this.graphPositions[toTable.name];
+            const y1 = this.graphColumnY(edge.from_table, edge.from_columns[0]);
+            const y2 = this.graphColumnY(toTable.name, edge.to_columns[0]);
+
+            // Leave from whichever side faces the other table.
+            const rightward = from.x <= to.x;
+            const x1 = rightward ? from.x + this.graphBoxWidth : from.x;
+            const x2 = rightward ? to.x : to.x + this.graphBoxWidth;
+            const bend = (rightward ? 1 : -1) * 40;
+            if (edge.from_table === toTable.name) {
+                const x = from.x + this.graphBoxWidth;
+                return `M ${x} ${y1} C ${x + 50} ${y1}, ${x + 50} ${y2}, ${x} ${y2}`;
+            }
+            return `M ${x1} ${y1} C ${x1 + bend} ${y1}, ${x2 - bend} ${y2}, ${x2} ${y2}`;
+        },
+
+        startDrag(tableName, event) {
+            const pos = this.graphPositions[tableName];
+            this.dragging = { name: tableName, dx: event.clientX - pos.x, dy: event.clientY - pos.y };
+        },
+
+        drag(event) {
+            if (!this.dragging) {
+                return;
+            }
+            this.graphPositions[this.dragging.name] = {
+                x: Math.max(0, event.clientX - this.dragging.dx),
+                y: Math.max(0, event.clientY - this.dragging.dy)
+            };
+        },
+
+        async loadIndexes() {
+            try {
+                const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/indexes`);
+                this.indexes = await response.json();
+            } catch (error) {
+                console.error('Failed to load indexes:', error);
+            }
+        },
+
+        canManageIndexes() {
+            const object = this.selectedObject();
+            return !this.readonly && object && object.type === 'table';
+        },
+
+        async createIndex() {
+            try {
+                const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/indexes`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({
+                        name: this.newIndex.name,
+                        columns: this.newIndex.columns.map(name => ({ name })),
+                        unique: this.newIndex.unique,
+                        where: this.newIndex.where
+                    })
+                });
+
+                if (response.ok) {
+                    this.newIndex = { name: '', columns: [], unique: false, where: '' };
+                    await this.loadIndexes();
+                } else {
+                    const error = await response.json();
+                    alert('Failed to create index: ' + error.error);
+                }
+            } catch (error) {
+                console.error('Failed to create index:', error);
+                alert('Failed to create index');
+            }
+        },
+
+        async dropIndex(indexName) {
+            if (!confirm(`Are you sure you want to drop index ${indexName}?`)) {
+                return;
+            }
+
             try {
-                const response = await fetch(
-                    `/api/tables/${this.selectedTable}/data?page=${this.currentPage}&limit=50`
+                const response = await this.api(
+                    `${this.apiBase}/tables/${this.selectedTable}/indexes/${encodeURIComponent(indexName)}`,
+                    { method: 'DELETE' }
                 );
+
+                if (response.ok) {
+                    await this.loadIndexes();
+                } else {
+                    const error = await response.json();
+                    alert('Failed to drop index: ' + error.error);
+                }
+            } catch (error) {
+                console.error('Failed to drop index:', error);
+                alert('Failed to drop index');
+            }
+        },
+
+        indexColumnsText(index) {
+            return index.columns
+                .map(c => (c.expression ? '<expression>' : c.name) + (c.desc ? ' DESC' : ''))
+                .join(', ');
+        },
+
+        canAlterTable() {
+            return this.canManageIndexes();
+        },
+
+        emptyColumnDefinition() {
+            return { name: '', type: 'TEXT', not_null: false, unique: false, primary_key: false, autoincrement: false, default: '' };
+        },
+
+        openCreateTable() {
+            const id = { ...this.emptyColumnDefinition(), name: 'id', type: 'INTEGER', primary_key: true };
+            this.tableEditor = {
+                mode: 'create',
+                table: null,
+                sql: '',
+                definition: {
+                    name: '',
+                    columns: [id],
+                    primary_key: [],
+                    unique: [],
+                    checks: [],
+                    foreign_keys: [],
+                    without_rowid: false,
+                    strict: false
+                }
+            };
+            this.showTableEditor = true;
+        },
+
+        async openModifyTable() {
+            try {
+                const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/definition`);
+                const result = await response.json();
+                if (!response.ok) {
+                    alert('Failed to load table definition: ' + result.error);
+                    return;
+                }
+
+                const definition = result.definition;
+                definition.columns = definition.columns.map(col => ({ ...col, default: col.default ?? '' }));
+                definition.primary_key = definition.primary_key || [];
+                definition.unique = definition.unique || [];
+                definition.checks = definition.checks || [];
+                definition.foreign_keys = definition.foreign_keys || [];
+                this.tableEditor = { mode: 'rebuild', table: this.selectedTable, definition, sql: result.sql };
+                this.showTableEditor = true;
+            } catch (error) {
+                console.error('Failed to load table definition:', error);
+                alert('Failed to load table definition');
+            }
+        },
+
+        splitList(text) {
+            return text.split(',').map(s => s.trim()).filter(s => s !== '');
+        },
+
+        // editorDefinition converts the editor's form state into the
+        // definition the API expects: empty defaults mean no default.
+        editorDefinition() {
+            const definition = this.tableEditor.definition;
+            return {
+                ...definition,
+                columns: definition.columns.map(col => ({ ...col, default: col.default === '' ? null : col.default })),
+                checks: definition.checks.filter(check => check.trim() !== '')
+            };
+        },
+
+        async saveTableEditor() {
+            const definition = this.editorDefinition();
+            if (this.tableEditor.mode === 'create') {
+                await this.previewDDL('Create table', `${this.apiBase}/tables`, definition);
+            } else {
+                await this.previewDDL(
+                    `Rebuild ${this.tableEditor.table}`,
+                    `${this.apiBase}/tables/${this.tableEditor.table}/alter`,
+                    { action: 'rebuild', definition }
+                );
+            }
+        },
+
+        async addColumn() {
+            const column = { ...this.newColumn, default: this.newColumn.default === '' ? null : this.newColumn.default };
+            await this.previewDDL('Add column', `${this.apiBase}/tables/${this.selectedTable}/alter`, { action: 'add_column', column });
+        },
+
+        async renameColumn(name) {
+            const newName = prompt(`Rename column ${name} to:`, name);
+            if (!newName || newName === name) {
+                return;
+            }
+            await this.previewDDL('Rename column', `${this.apiBase}/tables/${this.selectedTable}/alter`, { action: 'rename_column', name, new_name: newName });
+        },
+
+        async dropColumn(name) {
+            await this.previewDDL('Drop column', `${this.apiBase}/tables/${this.selectedTable}/alter`, { action: 'drop_column', name });
+        },
+
+        async renameTable() {
+            const newName = prompt(`Rename table ${this.selectedTable} to:`, this.selectedTable);
+            if (!newName || newName === this.selectedTable) {
+                return;
+            }
+            await this.previewDDL('Rename table', `${this.apiBase}/tables/${this.selectedTable}/alter`, { action: 'rename_table', new_name: newName });
+        },
+
+        // previewDDL asks the server for the statements an operation would
+        // run and shows them for confirmation before anything is changed.
+        async previewDDL(title, url, body) {
+            try {
+                const response = await this.api(`${url}?preview=true`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(body)
+                });
+                const result = await response.json();
+                if (!response.ok) {
+                    alert(`${title} failed: ${result.error}`);
+                    return;
+                }
+
+                this.ddl = { title, url, body, sql: result.sql };
+                this.showDDLModal = true;
+            } catch (error) {
+                console.error('Failed to preview DDL:', error);
+                alert(`${title} failed`);
+            }
+        },
+
+        async applyDDL() {
+            const { title, url, body } = this.ddl;
+            try {
+                const response = await this.api(url, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(body)
+                });
+                if (!response.ok) {
+                    const error = await response.json();
+                    alert(`${title} failed: ${error.error}`);
+                    return;
+                }
+
+                this.showDDLModal = false;
+                this.showTableEditor = false;
+                this.newColumn = null;
+
+                let table = this.selectedTable;
+                if (body.action === 'rename_table') {
+                    table = body.new_name;
+                } else if (!body.action) {
+                    table = body.name;
+                }
+                await this.loadTables();
+                await this.selectTable(table);
+                if (body.action) {
+                    this.activeTab = 'schema';
+                }
+            } catch (error) {
+                console.error('Failed to apply DDL:', error);
+                alert(`${title} failed`);
+            }
+        },
+
+        openImport(create) {
+            this.importForm = {
+                file: null,
+                table: create ? '' : this.selectedTable,
+                create,
+                delimiter: ',',
+                quoting: 'standard',
+                header: true,
+                encoding: 'utf-8',
+                mode: 'abort',
+                emptyAsNull: true,
+                mapping: {}
+            };
+            this.importHeaders = [];
+            this.importResult = null;
+            this.showImportModal = true;
+        },
+
+        // loadImportHeaders reads the first line of the chosen file so its
+        // columns can be mapped before uploading. Quoted delimiters inside
+        // header names are rare enough to split naively here.
+        async loadImportHeaders() {
+            const form = this.importForm;
+            this.importHeaders = [];
+            form.mapping = {};
+            if (!form.file) {
+                return;
+            }
+
+            const text = await form.file.slice(0, 65536).text();
+            const delimiter = form.delimiter === 'tab' ? '\t' : form.delimiter;
+            const fields = text.split(/\r?\n/)[0].replace(/^\uFEFF/, '').split(delimiter)
+                .map(f => f.replace(/^"(.*)"$/, '$1'));
+            this.importHeaders = fields.map((field, i) => form.header ? field : String(i + 1));
+
+            for (const header of this.importHeaders) {
+                if (form.create) {
+                    form.mapping[header] = form.header ? header : `column${header}`;
+                } else {
+                    const col = this.schema.find(c => c.name.toLowerCase() === header.toLowerCase());
+                    form.mapping[header] = col ? col.name : '';
+                }
+            }
+        },
+
+        async importCSV() {
+            const form = this.importForm;
+            if (!form.file || !form.table) {
+                alert('Choose a file and a table');
+                return;
+            }
+
+            const body = new FormData();
+            body.append('options', JSON.stringify({
+                delimiter: form.delimiter,
+                quoting: form.quoting,
+                header: form.header,
+                encoding: form.encoding,
+                mapping: this.importHeaders.length ? form.mapping : null,
+                create: form.create,
+                mode: form.mode,
+                empty_as_null: form.emptyAsNull
+            }));
+            body.append('file', form.file);
+
+            try {
+                const response = await this.api(`${this.apiBase}/tables/${encodeURIComponent(form.table)}/import`, { method: 'POST', body });
+                const result = await response.json();
+                if (result.error) {
+                    alert('Import failed: ' + result.error);
+                    return;
+                }
+
+                this.importResult = result;
+                if (result.inserted > 0) {
+                    await this.loadTables();
+                    if (form.create || form.table === this.selectedTable) {
+                        await this.selectTable(form.table);
+                    }
+                }
+            } catch (error) {
+                console.error('Failed to import CSV:', error);
+                alert('Failed to import CSV');
+            }
+        },
+
+        // viewParams holds the sort and filter of the grid, which exports
+        // apply as well.
+        viewParams() {
+            const params = new URLSearchParams();
+            if (this.sort.length) {
+                params.set('sort', this.sort.map(s => (s.desc ? '-' : '') + s.column).join(','));
+            }
+            const filter = this.buildFilter();
+            if (filter) {
+                params.set('filter', JSON.stringify(filter));
+            }
+            return params;
+        },
+
+        async loadTableData() {
+            try {
+                const params = this.viewParams();
+                params.set('page', this.currentPage);
+                params.set('limit', 50);
+                if (this.cursors[this.currentPage - 1]) {
+                    params.set('cursor', this.cursors[this.currentPage - 1]);
+                }
+
+                const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/data?${params}`);
+                if (!response.ok) {
+                    const error = await response.json();
+                    alert('Failed to load table data: ' + error.error);
+                    return;
+                }
                 this.tableData = await response.json();
+                this.selectedRows = [];
             } catch (error) {
                 console.error('Failed to load table data:', error);
                 alert('Failed to load table data');
             }
         },
 
+        exportTable() {
+            const params = this.viewParams();
+            params.set('format', this.exportFormat);
+            window.location.href = `${this.apiBase}/tables/${this.selectedTable}/export?${params}`;
+        },
+
+        // exportQuery posts a form rather than using fetch so the browser
+        // saves the streamed response to disk instead of holding it in memory.
+        exportQuery() {
+            const form = document.createElement('form');
+            form.method = 'POST';
+            form.action = `${this.apiBase}/query/export`;
+            const fields = { sql: this.customQuery, format: this.exportFormat };
+            if (this.lastParams) {
+                fields.params = JSON.stringify(this.lastParams);
+            }
+            for (const [name, value] of Object.entries(fields)) {
+                const input = document.createElement('input');
+                input.type = 'hidden';
+                input.name = name;
+                input.value = value;
+                form.appendChild(input);
+            }
+            document.body.appendChild(form);
+            form.submit();
+            form.remove();
+        },
+
+        addFilter() {
+            this.filters.push({ column: this.schema[0]?.name || '', op: '=', value: '', value2: '' });
+        },
+
+        removeFilter(idx) {
+            this.filters.splice(idx, 1);
+        },
+
+        buildFilter() {
+            const filters = this.filters.filter(f => f.column).map(f => {
+                switch (f.op) {
+                    case 'IS NULL':
+                    case 'IS NOT NULL':
+                        return { column: f.column, op: f.op };
+                    case 'IN':
+                    case 'NOT IN':
+                        return { column: f.column, op: f.op, values: f.value.split(',').map(v => v.trim()) };
+                    case 'BETWEEN':
+                        return { column: f.column, op: f.op, values: [f.value, f.value2] };
+                    default:
+                        return { column: f.column, op: f.op, value: f.value };
+                }
+            });
+            return filters.length ? { match: this.filterMatch, filters } : null;
+        },
+
+        async applyFilters() {
+            this.currentPage = 1;
+            this.cursors = [''];
+            await this.loadTableData();
+        },
+
+        sortDirection(column) {
+            const entry = this.sort.find(s => s.column === column);
+            if (!entry) {
+                return '';
+            }
+            const arrow = entry.desc ? '▼' : '▲';
+            return this.sort.length > 1 ? arrow + (this.sort.indexOf(entry) + 1) : arrow;
+        },
+
+        async toggleSort(column, event) {
+            // Shift-click adds a column to the sort; a plain click sorts by it alone.
+            const entry = this.sort.find(s => s.column === column);
+            if (!event.shiftKey) {
+                this.sort = this.sort.filter(s => s === entry);
+            }
+            if (!entry) {
+                this.sort.push({ column, desc: false });
+            } else if (!entry.desc) {
+                entry.desc = true;
+            } else {
+                this.sort = this.sort.filter(s => s !== entry);
+            }
+            await this.applyFilters();
+        },
+
+        async clearFilters() {
+            this.filters = [];
+            await this.applyFilters();
+        },
+
         async nextPage() {
-            if (this.currentPage * this.tableData.limit < this.tableData.total) {
+            if (this.hasNextPage()) {
+                this.cursors[this.currentPage] = this.tableData.next_cursor || '';
                 this.currentPage++;
                 await this.loadTableData();
             }
@@ -116,42 +871,82 @@ function app() {
             }
         },
 
-        editRow(row) {
+        isKeyColumn(name) {
+            return (this.tableData?.key_columns || []).includes(name);
+        },
+
+        editRow(row, idx) {
+            this.editingRow.index = idx;
+            this.editingRow.key = this.tableData.keys[idx];
             this.editingRow.values = {};
-            this.schema.forEach((col, idx) => {
-                this.editingRow.values[col.name] = row[idx];
+            this.editingRow.modes = {};
+            this.editingRow.files = {};
+            this.tableData.columns.forEach((col, colIdx) => {
+                // BLOBs keep their cell, which the form shows but never sends.
+                const cell = row[colIdx];
+                this.editingRow.values[col] = this.isBlob(cell) ? cell : (cell.value ?? '');
+                this.editingRow.modes[col] = this.isNull(cell) ? 'null' : 'value';
             });
+            this.editingRow.initial = { values: { ...this.editingRow.values }, modes: { ...this.editingRow.modes } };
             this.showEditModal = true;
         },
 
+        // isBlobColumn reports whether the edit form takes a file for col:
+        // its value is a BLOB, or its declared type is.
+        isBlobColumn(col) {
+            return this.isBlob(this.editingRow.values[col.name]) || /BLOB/i.test(col.type);
+        },
+
+        // updateRow sends only the columns that were changed, so values
+        // the form cannot show faithfully are left as they are.
         async updateRow() {
-            const pkCol = this.schema.find(c => c.primary_key);
-            if (!pkCol) {
-                alert('No primary key found for this table');
-                return;
+            const { values, modes, initial, files } = this.editingRow;
+            const updateData = {};
+            for (const [col, mode] of Object.entries(modes)) {
+                const value = values[col];
+                if (mode === initial.modes[col] && value === initial.values[col]) {
+                    continue;
+                }
+                // BLOBs are only sent as uploaded files, never as form text.
+                if (col in files || (mode === 'value' && this.isBlob(value))) {
+                    continue;
+                }
+                updateData[col] = mode === 'null' ? null : mode === 'default' ? { type: 'default' } : value;
+            }
+            for (const col of this.tableData.key_columns) {
+                delete updateData[col];
             }
-
-            const pkValue = this.editingRow.values[pkCol.name];
-            const updateData = { ...this.editingRow.values };
-            delete updateData[pkCol.name];
 
             try {
-                const response = await fetch(
-                    `/api/tables/${this.selectedTable}/rows?pk=${pkCol.name}&pk_value=${pkValue}`,
-                    {
+                let row = null;
+                if (Object.keys(updateData).length > 0) {
+                    const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/rows`, {
                         method: 'PUT',
                         headers: { 'Content-Type': 'application/json' },
-                        body: JSON.stringify(updateData)
+                        body: JSON.stringify({ key: this.editingRow.key, values: updateData })
+                    });
+                    if (!response.ok) {
+                        const error = await response.json();
+                        alert('Failed to update row: ' + error.error);
+                        return;
                     }
-                );
+                    ({ row } = await response.json());
+                }
+                for (const [col, file] of Object.entries(this.editingRow.files)) {
+                    row = await this.uploadCell(row?.key || this.editingRow.key, col, file);
+                    if (!row) {
+                        return;
+                    }
+                }
 
-                if (response.ok) {
-                    this.showEditModal = false;
-                    await this.loadTableData();
-                    await this.loadTables();
+                this.showEditModal = false;
+                if (row) {
+                    // The stored row carries values triggers or the
+                    // database changed, and the key if it was edited.
+                    this.tableData.rows[this.editingRow.index] = row.values;
+                    this.tableData.keys[this.editingRow.index] = row.key;
                 } else {
-                    const error = await response.json();
-                    alert('Failed to update row: ' + error.error);
+                    await this.loadTableData();
                 }
             } catch (error) {
                 console.error('Failed to update row:', error);
@@ -159,24 +954,143 @@ function app() {
             }
         },
 
-        async deleteRow(row) {
-            const pkCol = this.schema.find(c => c.primary_key);
-            if (!pkCol) {
-                alert('No primary key found for this table');
+        isBlob(cell) {
+            return cell?.type === 'blob';
+        },
+
+        isNull(cell) {
+            return cell?.type === 'null';
+        },
+
+        formatBytes(size) {
+            const units = ['bytes', 'KB', 'MB', 'GB'];
+            let unit = 0;
+            while (size >= 1024 && unit < units.length - 1) {
+                size /= 1024;
+                unit++;
+            }
+            return unit === 0 ? `${size} ${units[0]}` : `${size.toFixed(1)} ${units[unit]}`;
+        },
+
+        formatBlob(blob) {
+            return `BLOB ${this.formatBytes(blob.size)} ${blob.hex}${blob.size * 2 > blob.hex.length ? '…' : ''}`;
+        },
+
+        // formatCell renders a typed cell for display; BLOBs show their size
+        // and first bytes.
+        formatCell(cell) {
+            switch (cell?.type) {
+                case 'null':
+                    return 'NULL';
+                case 'blob':
+                    return this.formatBlob(cell.value);
+                default:
+                    return String(cell.value);
+            }
+        },
+
+        // cellClass styles NULL apart from text, so it cannot be mistaken
+        // for the string 'NULL' or an empty value.
+        cellClass(cell) {
+            return this.isNull(cell) ? 'italic text-gray-400 dark:text-gray-500' : '';
+        },
+
+        cellURL(key, column, download = false) {
+            const params = new URLSearchParams({ key: JSON.stringify(key), column });
+            if (download) {
+                params.set('download', 'true');
+            }
+            return `${this.apiBase}/tables/${this.selectedTable}/cell?${params}`;
+        },
+
+        async openBlob(idx, column) {
+            this.closeBlob();
+            const blob = this.tableData.rows[idx][this.tableData.columns.indexOf(column)].value;
+            this.blobViewer = { show: true, index: idx, column, blob, url: null };
+            if (!blob.content_type.startsWith('image/')) {
                 return;
             }
+            try {
+                // Fetched rather than linked so it is read in the open
+                // transaction, if any.
+                const response = await this.api(this.cellURL(this.tableData.keys[idx], column));
+                if (response.ok) {
+                    this.blobViewer.url = URL.createObjectURL(await response.blob());
+                }
+            } catch (error) {
+                console.error('Failed to load BLOB preview:', error);
+            }
+        },
+
+        closeBlob() {
+            if (this.blobViewer.url) {
+                URL.revokeObjectURL(this.blobViewer.url);
+            }
+            this.blobViewer = { show: false, index: null, column: '', blob: null, url: null };
+        },
+
+        async downloadBlob() {
+            const { index, column } = this.blobViewer;
+            try {
+                const response = await this.api(this.cellURL(this.tableData.keys[index], column, true));
+                if (!response.ok) {
+                    const error = await response.json();
+                    alert('Failed to download: ' + error.error);
+                    return;
+                }
+                const disposition = response.headers.get('Content-Disposition') || '';
+                const link = document.createElement('a');
+                link.href = URL.createObjectURL(await response.blob());
+                link.download = disposition.match(/filename="?([^";]+)"?/)?.[1] || `${this.selectedTable}-${column}`;
+                link.click();
+                URL.revokeObjectURL(link.href);
+            } catch (error) {
+                console.error('Failed to download:', error);
+                alert('Failed to download');
+            }
+        },
+
+        // uploadCell stores file in a cell as a BLOB and returns the row as
+        // stored, or null after reporting a failure.
+        async uploadCell(key, column, file) {
+            const response = await this.api(this.cellURL(key, column), { method: 'PUT', body: file });
+            if (!response.ok) {
+                const error = await response.json();
+                alert(`Failed to upload ${column}: ` + error.error);
+                return null;
+            }
+            const { row } = await response.json();
+            return row;
+        },
+
+        async replaceBlob(file) {
+            const { index, column } = this.blobViewer;
+            try {
+                const row = await this.uploadCell(this.tableData.keys[index], column, file);
+                if (row) {
+                    this.tableData.rows[index] = row.values;
+                    this.tableData.keys[index] = row.key;
+                    await this.openBlob(index, column);
+                }
+            } catch (error) {
+                console.error('Failed to upload:', error);
+                alert('Failed to upload');
+            }
+        },
+
+        async deleteRow(idx) {
+            const key = this.tableData.keys[idx];
 
-            const pkValue = row[this.schema.findIndex(c => c.primary_key)];
-            
             if (!confirm('Are you sure you want to delete this row?')) {
                 return;
             }
 
             try {
-                const response = await fetch(
-                    `/api/tables/${this.selectedTable}/rows?pk=${pkCol.name}&pk_value=${pkValue}`,
-                    { method: 'DELETE' }
-                );
+                const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/rows`, {
+                    method: 'DELETE',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ key })
+                });
 
                 if (response.ok) {
                     await this.loadTableData();
@@ -191,17 +1105,109 @@ function app() {
             }
         },
 
+        isRowSelected(idx) {
+            return this.selectedRows.includes(idx);
+        },
+
+        toggleRowSelection(idx) {
+            if (this.isRowSelected(idx)) {
+                this.selectedRows = this.selectedRows.filter(i => i !== idx);
+            } else {
+                this.selectedRows.push(idx);
+            }
+        },
+
+        allRowsSelected() {
+            const count = this.tableData?.rows?.length || 0;
+            return count > 0 && this.selectedRows.length === count;
+        },
+
+        toggleAllRows() {
+            this.selectedRows = this.allRowsSelected() ? [] : this.tableData.rows.map((_, idx) => idx);
+        },
+
+        // bulkSelection is the selection part of a bulk request. Without
+        // filters, "matching" means the whole table and must say so.
+        bulkSelection() {
+            if (this.bulkScope === 'selected') {
+                return { keys: this.selectedRows.map(idx => this.tableData.keys[idx]) };
+            }
+            const filter = this.buildFilter();
+            return filter ? { filter } : { all: true };
+        },
+
+        canRunBulk() {
+            return this.bulkScope === 'matching' || this.selectedRows.length > 0;
+        },
+
+        async bulkDeleteRows() {
+            await this.runBulk('bulk-delete', this.bulkSelection(), 'Delete', n => `Delete ${n} row${n === 1 ? '' : 's'}?`);
+        },
+
+        async bulkUpdateRows() {
+            const { column, value, isNull } = this.bulkUpdate;
+            if (!column) {
+                alert('Choose a column to set');
+                return;
+            }
+            const body = { ...this.bulkSelection(), values: { [column]: isNull ? null : value } };
+            const shown = isNull ? 'NULL' : `'${value}'`;
+            await this.runBulk('bulk-update', body, 'Update', n => `Set ${column} to ${shown} on ${n} row${n === 1 ? '' : 's'}?`);
+        },
+
+        // runBulk previews a bulk operation to learn how many rows it
+        // changes, asks for confirmation, and then applies it.
+        async runBulk(action, body, verb, question) {
+            const url = `${this.apiBase}/tables/${this.selectedTable}/rows/${action}`;
+            const request = {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(body)
+            };
+            try {
+                const preview = await this.api(url + '?preview=true', request);
+                if (!preview.ok) {
+                    const error = await preview.json();
+                    alert(`Failed to ${verb.toLowerCase()} rows: ` + error.error);
+                    return;
+                }
+                const { rows_affected: count } = await preview.json();
+                if (count === 0) {
+                    alert('No rows match');
+                    return;
+                }
+                if (!confirm(question(count))) {
+                    return;
+                }
+
+                const response = await this.api(url, request);
+                if (!response.ok) {
+                    const error = await response.json();
+                    alert(`Failed to ${verb.toLowerCase()} rows: ` + error.error);
+                    return;
+                }
+                await this.reloadData();
+            } catch (error) {
+                console.error(`Failed to ${verb.toLowerCase()} rows:`, error);
+                alert(`Failed to ${verb.toLowerCase()} rows`);
+            }
+        },
+
         async insertRow() {
+            // Empty fields are left out, so they take their defaults.
             const rowData = {};
             for (const col of this.schema) {
                 const value = this.newRow[col.name];
-                if (value !== undefined && value !== '') {
+                const mode = this.newRowModes[col.name] || 'value';
+                if (mode === 'null') {
+                    rowData[col.name] = null;
+                } else if (mode === 'value' && value !== undefined && value !== '') {
                     rowData[col.name] = value;
                 }
             }
 
             try {
-                const response = await fetch(`/api/tables/${this.selectedTable}/rows`, {
+                const response = await this.api(`${this.apiBase}/tables/${this.selectedTable}/rows`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify(rowData)
@@ -210,7 +1216,17 @@ function app() {
                 if (response.ok) {
                     this.showInsertModal = false;
                     this.newRow = {};
-                    await this.loadTableData();
+                    this.newRowModes = {};
+                    const { row } = await response.json();
+                    if (row) {
+                        // Show the new row, with its ID and defaults, at
+                        // the end of the current page until the next reload.
+                        (this.tableData.rows ||= []).push(row.values);
+                        (this.tableData.keys ||= []).push(row.key);
+                        this.tableData.total++;
+                    } else {
+                        await this.loadTableData();
+                    }
                     await this.loadTables();
                 } else {
                     const error = await response.json();
@@ -222,16 +1238,226 @@ function app() {
             }
         },
 
-        async executeQuery() {
+        async openAudit() {
+            this.auditTable = this.selectedTable || '';
+            this.showAuditModal = true;
+            await this.loadAudit();
+        },
+
+        // loadAudit fetches the newest changes, or with more set, the page
+        // of changes after those shown.
+        async loadAudit(more = false) {
+            const pageSize = 50;
+            const params = new URLSearchParams({ limit: pageSize, offset: more ? this.auditEntries.length : 0 });
+            if (this.auditTable) {
+                params.set('table', this.auditTable);
+            }
+            try {
+                const response = await this.api(`${this.apiBase}/audit?${params}`);
+                if (!response.ok) {
+                    const error = await response.json();
+                    alert('Failed to load the audit log: ' + error.error);
+                    return;
+                }
+                const entries = await response.json();
+                this.auditEntries = more ? this.auditEntries.concat(entries) : entries;
+                this.auditMore = entries.length === pageSize;
+            } catch (error) {
+                console.error('Failed to load the audit log:', error);
+            }
+        },
+
+        // auditColumns lists the columns an entry shows: those an update
+        // changed, or every column of an inserted or deleted row.
+        auditColumns(entry) {
+            const columns = Object.keys(entry.after || entry.before || {});
+            if (!entry.before || !entry.after) {
+                return columns;
+            }
+            return columns.filter(col => JSON.stringify(entry.before[col]) !== JSON.stringify(entry.after[col]));
+        },
+
+        auditValue(value) {
+            if (value === null || value === undefined) {
+                return 'NULL';
+            }
+            if (value.type === 'blob') {
+                return `BLOB ${this.formatBytes(atob(value.base64).length)}`;
+            }
+            return String(value);
+        },
+
+        async undoChange(entry) {
+            if (!confirm(`Undo this ${entry.operation.toLowerCase()} on ${entry.table}?`)) {
+                return;
+            }
+            try {
+                const response = await this.api(`${this.apiBase}/audit/${entry.id}/undo`, { method: 'POST' });
+                if (!response.ok) {
+                    const error = await response.json();
+                    alert('Failed to undo: ' + error.error);
+                    return;
+                }
+                await this.loadAudit();
+                await this.reloadData();
+            } catch (error) {
+                console.error('Failed to undo:', error);
+                alert('Failed to undo');
+            }
+        },
+
+        async beginTransaction() {
+            try {
+                const response = await fetch(`${this.apiBase}/transactions`, { method: 'POST' });
+                const result = await response.json();
+                if (!response.ok) {
+                    alert('Failed to begin transaction: ' + result.error);
+                    return;
+                }
+                this.transaction = result;
+                this.transactionPoll = setInterval(() => this.checkTransaction(), 10000);
+            } catch (error) {
+                console.error('Failed to begin transaction:', error);
+                alert('Failed to begin transaction');
+            }
+        },
+
+        async endTransaction(commit) {
+            if (!commit && !confirm('Discard all changes made in this transaction?')) {
+                return;
+            }
+            const action = commit ? 'commit' : 'rollback';
+            try {
+                const response = await fetch(`${this.apiBase}/transactions/${this.transaction.id}/${action}`, { method: 'POST' });
+                if (!response.ok && response.status !== 404) {
+                    // A failed commit leaves the transaction open.
+                    const error = await response.json();
+                    alert(`Failed to ${action}: ` + error.error);
+                    return;
+                }
+                this.clearTransaction();
+                if (response.status === 404) {
+                    alert('The transaction had already been rolled back.');
+                }
+                await this.reloadData();
+            } catch (error) {
+                console.error(`Failed to ${action}:`, error);
+                alert(`Failed to ${action}`);
+            }
+        },
+
+        // checkTransaction notices a transaction rolled back on the server,
+        // because it sat unused too long or SQLite ended it after an error.
+        async checkTransaction() {
+            if (!this.transaction) {
+                return;
+            }
+            try {
+                const response = await fetch(`${this.apiBase}/transactions/${this.transaction.id}`);
+                if (response.ok) {
+                    this.transaction = await response.json();
+                } else if (response.status === 404) {
+                    this.clearTransaction();
+                    alert('The transaction was rolled back and its changes discarded.');
+                    await this.reloadData();
+                }
+            } catch (error) {
+                console.error('Failed to check transaction:', error);
+            }
+        },
+
+        clearTransaction() {
+            clearInterval(this.transactionPoll);
+            this.transactionPoll = null;
+            this.transaction = null;
+        },
+
+        async reloadData() {
+            await this.loadTables();
+            if (this.selectedTable) {
+                await this.loadTableData();
+            }
+        },
+
+        // sqlParamNames lists the named parameters (:name, @name, $name)
+        // of a script, skipping quoted text and comments.
+        sqlParamNames(sql) {
+            const code = sql.replace(/'(?:[^']|'')*'|"(?:[^"]|"")*"|`[^`]*`|\[[^\]]*\]|--[^\n]*|\/\*[\s\S]*?\*\//g, ' ');
+            const names = [...code.matchAll(/(?<![A-Za-z0-9_$])[:@$]([A-Za-z_][A-Za-z0-9_]*)/g)].map(match => match[1]);
+            return [...new Set(names)];
+        },
+
+        // paramValue converts a parameter form value to the JSON value of
+        // its type. Empty numbers are NULL.
+        paramValue(type, value) {
+            switch (type) {
+                case 'integer':
+                case 'real':
+                    return value === '' || value === null ? null : Number(value);
+                case 'boolean':
+                    return !!value;
+                default:
+                    return value ?? '';
+            }
+        },
+
+        // executeQuery runs the editor's script, first asking for the
+        // values of any named parameters it has.
+        async executeQuery(explain = false) {
+            const names = this.sqlParamNames(this.customQuery);
+            if (names.length === 0) {
+                await this.runQuery(explain, null);
+                return;
+            }
+
+            const defs = this.activeSavedQuery?.sql === this.customQuery ? this.activeSavedQuery.params : [];
+            this.paramForm = {
+                explain,
+                fields: names.map(name => {
+                    const def = defs.find(p => p.name === name) || { type: 'text' };
+                    const value = this.lastParams?.[name] ?? def.default ?? (def.type === 'boolean' ? false : '');
+                    return { name, type: def.type, value };
+                })
+            };
+        },
+
+        async submitParams() {
+            const params = {};
+            for (const field of this.paramForm.fields) {
+                const value = this.paramValue(field.type, field.value);
+                if (Number.isNaN(value)) {
+                    alert(`Parameter ${field.name} must be a number`);
+                    return;
+                }
+                params[field.name] = value;
+            }
+            const explain = this.paramForm.explain;
+            this.paramForm = null;
+            await this.runQuery(explain, params);
+        },
+
+        async runQuery(explain, params) {
+            // The ID is chosen here so the query can be cancelled while
+            // the request is still waiting for its response.
+            const queryId = Math.random().toString(36).slice(2) + Date.now().toString(36);
+            this.runningQueryId = queryId;
             try {
-                const response = await fetch('/api/query', {
+                const response = await this.api(`${this.apiBase}/query`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
-                    body: JSON.stringify({ sql: this.customQuery })
+                    body: JSON.stringify({ sql: this.customQuery, transaction: this.queryTransaction, explain, query_id: queryId, limit: this.queryPageSize, params })
                 });
+                this.lastParams = params;
 
                 if (response.ok) {
                     this.queryResult = await response.json();
+                    const failed = this.queryResult.statements.find(stmt => stmt.error);
+                    if (failed) {
+                        this.highlightStatement(failed);
+                    }
+                    if (this.showHistory) {
+                        this.loadHistory();
+                    }
                 } else {
                     const error = await response.json();
                     alert('Query failed: ' + error.error);
@@ -239,7 +1465,183 @@ function app() {
             } catch (error) {
                 console.error('Failed to execute query:', error);
                 alert('Failed to execute query');
+            } finally {
+                this.runningQueryId = null;
             }
+        },
+
+        // pageStatement shows another page of one statement's result by
+        // running that statement again on its own. Only statements that
+        // only read rows can be paged.
+        async pageStatement(stmt, page) {
+            try {
+                const response = await this.api(`${this.apiBase}/query`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ sql: stmt.sql, page, limit: stmt.result.limit, params: this.lastParams })
+                });
+                const result = await response.json();
+                if (!response.ok || result.error) {
+                    alert('Failed to load page: ' + result.error);
+                    return;
+                }
+                stmt.result = result.statements[0].result;
+            } catch (error) {
+                console.error('Failed to load page:', error);
+                alert('Failed to load page');
+            }
+        },
+
+        // flattenPlan lists the steps of a query plan tree in order, with
+        // their depth for indentation.
+        flattenPlan(nodes, depth = 0) {
+            return (nodes || []).flatMap(node => [{ node, depth }, ...this.flattenPlan(node.children, depth + 1)]);
+        },
+
+        canPageStatement(stmt) {
+            return stmt.pageable && (stmt.result.page > 1 || stmt.result.truncated);
+        },
+
+        async toggleHistory() {
+            this.showHistory = !this.showHistory;
+            if (this.showHistory) {
+                await this.loadHistory();
+            }
+        },
+
+        async loadHistory() {
+            try {
+                const params = new URLSearchParams({ q: this.historySearch });
+                const response = await this.api(`${this.apiBase}/history?${params}`);
+                if (response.ok) {
+                    this.historyEntries = await response.json();
+                }
+            } catch (error) {
+                console.error('Failed to load history:', error);
+            }
+        },
+
+        async rerunHistory(entry) {
+            this.customQuery = entry.sql;
+            await this.runQuery(false, entry.params ?? null);
+        },
+
+        async toggleLibrary() {
+            this.showLibrary = !this.showLibrary;
+            if (this.showLibrary) {
+                await this.loadSavedQueries();
+            }
+        },
+
+        async loadSavedQueries() {
+            try {
+                const response = await this.api(`${this.apiBase}/saved-queries`);
+                if (response.ok) {
+                    this.savedQueries = await response.json();
+                }
+            } catch (error) {
+                console.error('Failed to load saved queries:', error);
+            }
+        },
+
+        async openSavedQuery(query) {
+            this.activeSavedQuery = query;
+            this.customQuery = query.sql;
+            this.lastParams = null;
+            await this.executeQuery();
+        },
+
+        // startSaveQuery opens the save form for the editor's script, with
+        // a parameter definition for each of its named parameters. A
+        // loaded saved query is updated unless saved as new.
+        startSaveQuery() {
+            const active = this.activeSavedQuery;
+            const defs = active?.params || [];
+            this.saveForm = {
+                id: active?.id || 0,
+                name: active?.name || '',
+                description: active?.description || '',
+                params: this.sqlParamNames(this.customQuery).map(name => {
+                    const def = defs.find(p => p.name === name) || { type: 'text' };
+                    return { name, type: def.type, default: def.default ?? (def.type === 'boolean' ? false : '') };
+                })
+            };
+        },
+
+        async submitSaveQuery(asNew = false) {
+            const form = this.saveForm;
+            const body = {
+                name: form.name,
+                description: form.description,
+                sql: this.customQuery,
+                params: form.params.map(p => {
+                    const def = this.paramValue(p.type, p.default);
+                    return { name: p.name, type: p.type, default: def === '' || def === null ? undefined : def };
+                })
+            };
+            const update = form.id && !asNew;
+            try {
+                const response = await this.api(update ? `${this.apiBase}/saved-queries/${form.id}` : `${this.apiBase}/saved-queries`, {
+                    method: update ? 'PUT' : 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(body)
+                });
+                const result = await response.json();
+                if (!response.ok) {
+                    alert('Failed to save query: ' + result.error);
+                    return;
+                }
+                this.activeSavedQuery = result;
+                this.saveForm = null;
+                await this.loadSavedQueries();
+            } catch (error) {
+                console.error('Failed to save query:', error);
+                alert('Failed to save query');
+            }
+        },
+
+        async deleteSavedQuery(query) {
+            if (!confirm(`Are you sure you want to delete the saved query ${query.name}?`)) {
+                return;
+            }
+            try {
+                const response = await this.api(`${this.apiBase}/saved-queries/${query.id}`, { method: 'DELETE' });
+                if (!response.ok) {
+                    const error = await response.json();
+                    alert('Failed to delete saved query: ' + error.error);
+                    return;
+                }
+                if (this.activeSavedQuery?.id === query.id) {
+                    this.activeSavedQuery = null;
+                }
+                await this.loadSavedQueries();
+            } catch (error) {
+                console.error('Failed to delete saved query:', error);
+                alert('Failed to delete saved query');
+            }
+        },
+
+        async cancelQuery() {
+            if (!this.runningQueryId) {
+                return;
+            }
+            try {
+                await fetch(`${this.apiBase}/query/${encodeURIComponent(this.runningQueryId)}/cancel`, { method: 'POST' });
+            } catch (error) {
+                console.error('Failed to cancel query:', error);
+            }
+        },
+
+        // highlightStatement selects a statement in the query editor. The
+        // server reports byte offsets, the textarea counts UTF-16 units.
+        highlightStatement(stmt) {
+            const bytes = new TextEncoder().encode(this.customQuery);
+            const decoder = new TextDecoder();
+            const start = decoder.decode(bytes.slice(0, stmt.offset)).length;
+            const end = decoder.decode(bytes.slice(0, stmt.end)).length;
+            const editor = this.$refs.queryEditor;
+            editor.focus();
+            editor.setSelectionRange(start, end);
         }
     };
 }
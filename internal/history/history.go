@@ -0,0 +1,126 @@
+// Package history keeps a log of the queries run against each database
+// in a sidecar file.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+	"github.com/rzhade3/sqlite-webgui/internal/sidecar"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS history (
+	id          INTEGER PRIMARY KEY,
+	database    TEXT NOT NULL,
+	sql         TEXT NOT NULL,
+	executed_at INTEGER NOT NULL,
+	duration_ms REAL NOT NULL,
+	row_count   INTEGER,
+	error       TEXT,
+	params      TEXT
+);
+CREATE INDEX IF NOT EXISTS history_database ON history (database, id);
+`
+
+// Store is a query history file.
+type Store struct {
+	conn *sql.DB
+}
+
+// DefaultPath is the history file in the user's config directory.
+func DefaultPath() (string, error) {
+	return sidecar.Path("history.db")
+}
+
+// Open opens the history file at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	conn, err := sidecar.Open(path, "history", schema)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{conn: conn}, nil
+}
+
+func (s *Store) Close() error {
+	return s.conn.Close()
+}
+
+// Record adds entries to the history of database, which should be an
+// absolute path so every way of naming the file shares one history.
+func (s *Store) Record(ctx context.Context, database string, entries []models.HistoryEntry) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		var params interface{}
+		if entry.Params != nil {
+			encoded, err := json.Marshal(entry.Params)
+			if err != nil {
+				return fmt.Errorf("failed to encode parameters: %w", err)
+			}
+			params = string(encoded)
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO history (database, sql, executed_at, duration_ms, row_count, error, params) VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), ?)",
+			database, entry.SQL, entry.ExecutedAt.UnixMilli(), entry.DurationMs, entry.RowCount, entry.Error, params,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record query: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Search returns the history of database, newest first. A non-empty
+// query keeps only entries whose SQL contains it, ignoring case.
+func (s *Store) Search(ctx context.Context, database, query string, limit, offset int) ([]models.HistoryEntry, error) {
+	where := "database = ?"
+	args := []interface{}{database}
+	if query != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query)
+		where += ` AND sql LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escaped+"%")
+	}
+
+	rows, err := s.conn.QueryContext(ctx,
+		"SELECT id, sql, executed_at, duration_ms, row_count, COALESCE(error, ''), params FROM history WHERE "+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.HistoryEntry{}
+	for rows.Next() {
+		var (
+			entry      models.HistoryEntry
+			executedAt int64
+			params     sql.NullString
+		)
+		if err := rows.Scan(&entry.ID, &entry.SQL, &executedAt, &entry.DurationMs, &entry.RowCount, &entry.Error, &params); err != nil {
+			return nil, fmt.Errorf("failed to scan history: %w", err)
+		}
+		entry.ExecutedAt = time.UnixMilli(executedAt).UTC()
+		if params.Valid {
+			// Numbers stay json.Number, so integers beyond 2^53 run
+			// again with the value they had.
+			decoder := json.NewDecoder(strings.NewReader(params.String))
+			decoder.UseNumber()
+			if err := decoder.Decode(&entry.Params); err != nil {
+				return nil, fmt.Errorf("failed to decode parameters: %w", err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,236 @@
+// Package library keeps saved queries, with the parameters they take, in
+// a sidecar file.
+package library
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rzhade3/sqlite-webgui/internal/models"
+	"github.com/rzhade3/sqlite-webgui/internal/sidecar"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS saved_queries (
+	id          INTEGER PRIMARY KEY,
+	database    TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	sql         TEXT NOT NULL,
+	params      TEXT NOT NULL DEFAULT '[]',
+	updated_at  INTEGER NOT NULL,
+	UNIQUE (database, name)
+);
+`
+
+var (
+	ErrNotFound  = errors.New("saved query not found")
+	ErrNameTaken = errors.New("a saved query with this name already exists")
+)
+
+// ValidationError reports a saved query that cannot be stored as given.
+type ValidationError struct {
+	msg string
+}
+
+func (e *ValidationError) Error() string {
+	return e.msg
+}
+
+func invalidf(format string, args ...interface{}) error {
+	return &ValidationError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Store is a saved query library file.
+type Store struct {
+	conn *sql.DB
+}
+
+// DefaultPath is the library file in the user's config directory.
+func DefaultPath() (string, error) {
+	return sidecar.Path("library.db")
+}
+
+// Open opens the library file at path, creating it if needed.
+func Open(path string) (*Store, error) {
+	conn, err := sidecar.Open(path, "library", schema)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{conn: conn}, nil
+}
+
+func (s *Store) Close() error {
+	return s.conn.Close()
+}
+
+// Validate checks that a saved query has a name and SQL, and that its
+// parameters have distinct names, known types and defaults of their type.
+// Parameter names lose any :, @ or $ prefix, and the type defaults to
+// text.
+func Validate(q *models.SavedQuery) error {
+	q.Name = strings.TrimSpace(q.Name)
+	if q.Name == "" {
+		return invalidf("name is required")
+	}
+	if strings.TrimSpace(q.SQL) == "" {
+		return invalidf("SQL is required")
+	}
+
+	seen := map[string]bool{}
+	for i := range q.Params {
+		p := &q.Params[i]
+		p.Name = strings.TrimLeft(p.Name, ":@$")
+		if r := []rune(p.Name); len(r) == 0 || !unicode.IsLetter(r[0]) {
+			return invalidf("parameter name %q must start with a letter", p.Name)
+		}
+		if seen[p.Name] {
+			return invalidf("parameter %q is defined twice", p.Name)
+		}
+		seen[p.Name] = true
+
+		if p.Type == "" {
+			p.Type = models.ParamText
+		}
+		switch p.Type {
+		case models.ParamText, models.ParamInteger, models.ParamReal, models.ParamBoolean, models.ParamDate:
+		default:
+			return invalidf("parameter %q has unknown type %q", p.Name, p.Type)
+		}
+		if p.Default != nil && !validDefault(p.Type, p.Default) {
+			return invalidf("default of parameter %q is not a valid %s", p.Name, p.Type)
+		}
+	}
+	return nil
+}
+
+func validDefault(paramType string, value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		if paramType == models.ParamDate {
+			_, err := time.Parse(time.DateOnly, v)
+			return err == nil
+		}
+		return paramType == models.ParamText
+	case json.Number:
+		if _, err := v.Int64(); err == nil && paramType == models.ParamInteger {
+			return true
+		}
+		f, err := v.Float64()
+		return err == nil && validDefault(paramType, f)
+	case float64:
+		return paramType == models.ParamReal || (paramType == models.ParamInteger && v == math.Trunc(v))
+	case bool:
+		return paramType == models.ParamBoolean
+	}
+	return false
+}
+
+const selectQuery = "SELECT id, name, description, sql, params, updated_at FROM saved_queries"
+
+func scanQuery(row interface{ Scan(...interface{}) error }) (*models.SavedQuery, error) {
+	var (
+		q         models.SavedQuery
+		params    string
+		updatedAt int64
+	)
+	if err := row.Scan(&q.ID, &q.Name, &q.Description, &q.SQL, &params, &updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to scan saved query: %w", err)
+	}
+	// Defaults stay json.Number, so integers beyond 2^53 keep their value.
+	decoder := json.NewDecoder(strings.NewReader(params))
+	decoder.UseNumber()
+	if err := decoder.Decode(&q.Params); err != nil {
+		return nil, fmt.Errorf("failed to decode parameters: %w", err)
+	}
+	q.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+	return &q, nil
+}
+
+// List returns the saved queries of database by name.
+func (s *Store) List(ctx context.Context, database string) ([]models.SavedQuery, error) {
+	rows, err := s.conn.QueryContext(ctx, selectQuery+" WHERE database = ? ORDER BY name COLLATE NOCASE", database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query saved queries: %w", err)
+	}
+	defer rows.Close()
+
+	queries := []models.SavedQuery{}
+	for rows.Next() {
+		q, err := scanQuery(rows)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, *q)
+	}
+	return queries, rows.Err()
+}
+
+// Save adds q to the library of database, or replaces the saved query
+// with q.ID if it is set, and returns it as stored. q must be valid.
+func (s *Store) Save(ctx context.Context, database string, q models.SavedQuery) (*models.SavedQuery, error) {
+	if q.Params == nil {
+		q.Params = []models.QueryParam{}
+	}
+	params, err := json.Marshal(q.Params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode parameters: %w", err)
+	}
+	now := time.Now().UnixMilli()
+
+	var result sql.Result
+	if q.ID == 0 {
+		result, err = s.conn.ExecContext(ctx,
+			"INSERT INTO saved_queries (database, name, description, sql, params, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			database, q.Name, q.Description, q.SQL, string(params), now,
+		)
+	} else {
+		result, err = s.conn.ExecContext(ctx,
+			"UPDATE saved_queries SET name = ?, description = ?, sql = ?, params = ?, updated_at = ? WHERE id = ? AND database = ?",
+			q.Name, q.Description, q.SQL, string(params), now, q.ID, database,
+		)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrNameTaken
+		}
+		return nil, fmt.Errorf("failed to save query: %w", err)
+	}
+
+	id := q.ID
+	if id == 0 {
+		if id, err = result.LastInsertId(); err != nil {
+			return nil, err
+		}
+	} else if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+
+	return scanQuery(s.conn.QueryRowContext(ctx, selectQuery+" WHERE id = ?", id))
+}
+
+// Delete removes a saved query from the library of database.
+func (s *Store) Delete(ctx context.Context, database string, id int64) error {
+	result, err := s.conn.ExecContext(ctx, "DELETE FROM saved_queries WHERE id = ? AND database = ?", id, database)
+	if err != nil {
+		return fmt.Errorf("failed to delete saved query: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
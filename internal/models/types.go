@@ -1,8 +1,31 @@
 package models
 
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Table types reported for each object in the schema.
+const (
+	TableTypeTable    = "table"
+	TableTypeView     = "view"
+	TableTypeVirtual  = "virtual"
+	TableTypeShadow   = "shadow"
+	TableTypeInternal = "internal"
+)
+
+// IsEditableType reports whether rows of an object of the given type may
+// be inserted, updated or deleted through the API.
+func IsEditableType(tableType string) bool {
+	return tableType == TableTypeTable || tableType == TableTypeVirtual
+}
+
 type Table struct {
 	Name       string   `json:"name"`
+	Type       string   `json:"type"`
 	RowCount   int      `json:"row_count"`
+	ReadOnly   bool     `json:"readonly"`
 	ColumnInfo []Column `json:"columns,omitempty"`
 }
 
@@ -12,18 +35,531 @@ type Column struct {
 	NotNull      bool    `json:"not_null"`
 	DefaultValue *string `json:"default_value"`
 	PrimaryKey   bool    `json:"primary_key"`
+	// References lists the foreign keys this column is part of.
+	References []ColumnReference `json:"references,omitempty"`
+}
+
+// ColumnReference is the target of one column within a foreign key.
+// Columns of a composite key share the same ForeignKeyID.
+type ColumnReference struct {
+	ForeignKeyID int    `json:"foreign_key_id"`
+	Table        string `json:"table"`
+	Column       string `json:"column"`
+	OnUpdate     string `json:"on_update"`
+	OnDelete     string `json:"on_delete"`
+}
+
+// ForeignKey is a (possibly composite) reference from From in one table
+// to To in Table. From[i] references To[i].
+type ForeignKey struct {
+	ID       int      `json:"id"`
+	From     []string `json:"from"`
+	Table    string   `json:"table"`
+	To       []string `json:"to"`
+	OnUpdate string   `json:"on_update"`
+	OnDelete string   `json:"on_delete"`
+	// Unresolved marks a key written without target columns whose parent
+	// has no primary key of the same size, so To is empty.
+	Unresolved bool `json:"unresolved,omitempty"`
+}
+
+// ReferencingRows holds the rows of Table whose foreign key points at a
+// given row.
+type ReferencingRows struct {
+	Table      string     `json:"table"`
+	ForeignKey ForeignKey `json:"foreign_key"`
+	Data       *TableData `json:"data"`
 }
 
 type TableData struct {
-	Columns []string        `json:"columns"`
-	Rows    [][]interface{} `json:"rows"`
-	Total   int             `json:"total"`
-	Page    int             `json:"page"`
-	Limit   int             `json:"limit"`
+	Columns []string `json:"columns"`
+	Rows    [][]Cell `json:"rows"`
+	Total   int      `json:"total"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+	// KeyColumns and Keys identify each row for updates and deletes.
+	// Keys[i] belongs to Rows[i].
+	KeyColumns []string `json:"key_columns,omitempty"`
+	Keys       []RowKey `json:"keys,omitempty"`
+	// NextCursor resumes after the last row when more rows follow.
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Truncated is set on query results that stop at the row limit while
+	// more rows follow. Total then only counts rows up to this page.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// MaxSafeInteger is the largest integer a JavaScript number holds
+// exactly. Larger integers are sent as strings.
+const MaxSafeInteger = 1<<53 - 1
+
+// RowKey maps each key column of a table to its value for one row.
+type RowKey map[string]interface{}
+
+// MarshalJSON sends integers beyond MaxSafeInteger as strings. SQLite
+// compares them equal to the stored integer when the key is sent back.
+func (k RowKey) MarshalJSON() ([]byte, error) {
+	if k == nil {
+		return []byte("null"), nil
+	}
+	safe := make(map[string]interface{}, len(k))
+	for col, v := range k {
+		if i, ok := v.(int64); ok && (i > MaxSafeInteger || i < -MaxSafeInteger) {
+			v = strconv.FormatInt(i, 10)
+		}
+		safe[col] = v
+	}
+	return json.Marshal(safe)
+}
+
+// Storage classes of SQLite values, as Cell.Type.
+const (
+	CellNull    = "null"
+	CellInteger = "integer"
+	CellReal    = "real"
+	CellText    = "text"
+	CellBlob    = "blob"
+)
+
+// Cell is a value in table data, tagged with its storage class so NULL,
+// empty text and numbers can be told apart. Value is omitted for NULL; it
+// holds integers beyond MaxSafeInteger and non-finite reals ("Infinity",
+// "-Infinity", "NaN") as strings, and a Blob for BLOBs.
+type Cell struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Blob stands in for a BLOB value, whose bytes would not survive as JSON
+// text. The value itself is read from the cell endpoint.
+type Blob struct {
+	Size int `json:"size"`
+	// Hex holds the first bytes of the value.
+	Hex         string `json:"hex"`
+	ContentType string `json:"content_type"`
+}
+
+// Row is a single row as stored, with its columns in table data order.
+type Row struct {
+	Columns []string `json:"columns"`
+	Values  []Cell   `json:"values"`
+	Key     RowKey   `json:"key,omitempty"`
+}
+
+// RowResponse is returned by row inserts and updates. Row is the row as
+// stored, so it includes defaults and IDs the database assigned; it is
+// omitted for tables whose rows cannot be addressed individually.
+type RowResponse struct {
+	Message string `json:"message"`
+	Row     *Row   `json:"row,omitempty"`
+}
+
+type RowUpdateRequest struct {
+	Key    RowKey                 `json:"key"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// Operations of an audited row change.
+const (
+	AuditInsert = "INSERT"
+	AuditUpdate = "UPDATE"
+	AuditDelete = "DELETE"
+)
+
+// AuditEntry records one row changed by a write made through the server:
+// the row's key, after the change or, for a delete, before it, and the
+// full row before and after. Before is null for an insert and After for a
+// delete. Tables keyed by rowid include it in both.
+type AuditEntry struct {
+	ID        int64                  `json:"id"`
+	ChangedAt time.Time              `json:"changed_at"`
+	Client    string                 `json:"client"`
+	Table     string                 `json:"table"`
+	Operation string                 `json:"operation"`
+	Key       RowKey                 `json:"key"`
+	Before    map[string]interface{} `json:"before"`
+	After     map[string]interface{} `json:"after"`
+	// UndoneAt is set once the change has been undone.
+	UndoneAt *time.Time `json:"undone_at,omitempty"`
+}
+
+// AuditBlob stands in for a BLOB value in an AuditEntry row image, with
+// its bytes in base64 so they survive JSON unchanged. Type is CellBlob.
+type AuditBlob struct {
+	Type   string `json:"type"`
+	Base64 string `json:"base64"`
+}
+
+// BulkRowRequest selects the rows of a bulk update or delete: the rows
+// with the given Keys, or every row matching Filter. Without keys or a
+// filter nothing is selected unless All is set, so a forgotten filter
+// cannot change the whole table. A bulk update sets Values on every
+// selected row.
+type BulkRowRequest struct {
+	Keys   []RowKey               `json:"keys,omitempty"`
+	Filter *FilterGroup           `json:"filter,omitempty"`
+	All    bool                   `json:"all,omitempty"`
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// BulkRowResponse reports how many rows a bulk operation changed, or in
+// a preview, would change. A preview also gives the first of those rows
+// as Sample.
+type BulkRowResponse struct {
+	RowsAffected int64      `json:"rows_affected"`
+	Applied      bool       `json:"applied"`
+	Sample       *TableData `json:"sample,omitempty"`
+}
+
+type RowDeleteRequest struct {
+	Key RowKey `json:"key"`
+}
+
+// Index origins: created by CREATE INDEX, or implied by a UNIQUE or
+// PRIMARY KEY constraint.
+const (
+	IndexOriginUser       = "user"
+	IndexOriginUnique     = "unique"
+	IndexOriginPrimaryKey = "pk"
+)
+
+type Index struct {
+	Name    string        `json:"name"`
+	Unique  bool          `json:"unique"`
+	Origin  string        `json:"origin"`
+	Partial bool          `json:"partial"`
+	Where   string        `json:"where,omitempty"`
+	Columns []IndexColumn `json:"columns"`
+}
+
+// IndexColumn is one key column of an index. Expression is set for
+// indexed expressions, which have no column name.
+type IndexColumn struct {
+	Name       string `json:"name"`
+	Desc       bool   `json:"desc"`
+	Collation  string `json:"collation,omitempty"`
+	Expression bool   `json:"expression,omitempty"`
+}
+
+type CreateIndexRequest struct {
+	Name    string            `json:"name"`
+	Columns []IndexColumnSpec `json:"columns"`
+	Unique  bool              `json:"unique"`
+	Where   string            `json:"where,omitempty"`
+}
+
+type IndexColumnSpec struct {
+	Name string `json:"name"`
+	Desc bool   `json:"desc"`
+}
+
+// SchemaGraph is the entity-relationship graph of a database: its tables
+// and the foreign keys between them.
+type SchemaGraph struct {
+	Tables []GraphTable `json:"tables"`
+	Edges  []GraphEdge  `json:"edges"`
+}
+
+type GraphTable struct {
+	Name    string        `json:"name"`
+	Columns []GraphColumn `json:"columns"`
+}
+
+type GraphColumn struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	NotNull    bool   `json:"not_null"`
+	PrimaryKey bool   `json:"primary_key"`
+	ForeignKey bool   `json:"foreign_key"`
+}
+
+// GraphEdge is a foreign key from FromTable to ToTable. Optional is set
+// when any referencing column is nullable.
+type GraphEdge struct {
+	FromTable   string   `json:"from_table"`
+	FromColumns []string `json:"from_columns"`
+	ToTable     string   `json:"to_table"`
+	ToColumns   []string `json:"to_columns"`
+	Optional    bool     `json:"optional"`
+	OnUpdate    string   `json:"on_update"`
+	OnDelete    string   `json:"on_delete"`
+}
+
+// TableDefinition describes a table to create, or the complete new
+// shape of a table being rebuilt.
+type TableDefinition struct {
+	Name         string                 `json:"name"`
+	Columns      []ColumnDefinition     `json:"columns"`
+	PrimaryKey   []string               `json:"primary_key,omitempty"`
+	Unique       [][]string             `json:"unique,omitempty"`
+	Checks       []string               `json:"checks,omitempty"`
+	ForeignKeys  []ForeignKeyDefinition `json:"foreign_keys,omitempty"`
+	WithoutRowid bool                   `json:"without_rowid"`
+	Strict       bool                   `json:"strict"`
+}
+
+// ColumnDefinition describes one column. Default and Check are SQL
+// expressions, inserted as written.
+type ColumnDefinition struct {
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	NotNull       bool    `json:"not_null"`
+	Unique        bool    `json:"unique"`
+	PrimaryKey    bool    `json:"primary_key"`
+	AutoIncrement bool    `json:"autoincrement"`
+	Default       *string `json:"default,omitempty"`
+	Check         string  `json:"check,omitempty"`
+	Collate       string  `json:"collate,omitempty"`
+}
+
+type ForeignKeyDefinition struct {
+	Columns  []string `json:"columns"`
+	Table    string   `json:"table"`
+	To       []string `json:"to,omitempty"`
+	OnUpdate string   `json:"on_update,omitempty"`
+	OnDelete string   `json:"on_delete,omitempty"`
+}
+
+// Alter table actions. AlterRebuild replaces the table with Definition,
+// for changes ALTER TABLE cannot make directly.
+const (
+	AlterAddColumn    = "add_column"
+	AlterRenameColumn = "rename_column"
+	AlterDropColumn   = "drop_column"
+	AlterRenameTable  = "rename_table"
+	AlterRebuild      = "rebuild"
+)
+
+type AlterTableRequest struct {
+	Action     string            `json:"action"`
+	Column     *ColumnDefinition `json:"column,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	NewName    string            `json:"new_name,omitempty"`
+	Definition *TableDefinition  `json:"definition,omitempty"`
+}
+
+// DDLResponse carries the statements an operation runs, and whether they
+// were applied or only previewed.
+type DDLResponse struct {
+	SQL     []string `json:"sql"`
+	Applied bool     `json:"applied"`
+}
+
+// TableDefinitionResponse is the current definition of a table as far as
+// SQLite's pragmas describe it, along with its original CREATE statement.
+type TableDefinitionResponse struct {
+	Definition TableDefinition `json:"definition"`
+	SQL        string          `json:"sql"`
+}
+
+// TableDataRequest describes which rows of a table to return.
+type TableDataRequest struct {
+	Page   int          `json:"page"`
+	Limit  int          `json:"limit"`
+	Filter *FilterGroup `json:"filter,omitempty"`
+	Sort   []SortColumn `json:"sort,omitempty"`
+	// Cursor, when set, replaces Page: rows start after the position it
+	// encodes. It must come from a response using the same Sort.
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type SortColumn struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+}
+
+// FilterGroup combines filters and nested groups with AND ("all") or
+// OR ("any"). An empty Match means "all".
+type FilterGroup struct {
+	Match   string        `json:"match,omitempty"`
+	Filters []Filter      `json:"filters,omitempty"`
+	Groups  []FilterGroup `json:"groups,omitempty"`
+}
+
+// Filter is a single column condition. Value is used by the comparison
+// and LIKE operators, Values by IN, NOT IN and BETWEEN.
+type Filter struct {
+	Column   string        `json:"column"`
+	Operator string        `json:"op"`
+	Value    interface{}   `json:"value,omitempty"`
+	Values   []interface{} `json:"values,omitempty"`
+}
+
+// CSV import modes: ImportAbort rolls the whole import back at the first
+// bad row, ImportSkip leaves bad rows out and imports the rest. An
+// ImportAbort import runs in one transaction however large it is;
+// ImportSkip commits every BatchSize rows.
+const (
+	ImportAbort = "abort"
+	ImportSkip  = "skip"
+)
+
+// CSVImportOptions describes how to read a CSV file and where its
+// columns go.
+type CSVImportOptions struct {
+	Delimiter string `json:"delimiter"`
+	// Quoting is "standard" (RFC 4180), "lazy" (tolerates stray quotes
+	// inside fields) or "none" (quotes are ordinary characters).
+	Quoting  string `json:"quoting"`
+	Header   bool   `json:"header"`
+	Encoding string `json:"encoding"`
+	// Mapping maps CSV columns, by header name or 1-based position, to
+	// table columns. An empty target skips the CSV column.
+	Mapping     map[string]string `json:"mapping,omitempty"`
+	Create      bool              `json:"create"`
+	Mode        string            `json:"mode"`
+	BatchSize   int               `json:"batch_size"`
+	EmptyAsNull bool              `json:"empty_as_null"`
+}
+
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ImportResult struct {
+	Table           string             `json:"table"`
+	Created         bool               `json:"created"`
+	Columns         []ColumnDefinition `json:"columns,omitempty"`
+	Inserted        int                `json:"inserted"`
+	Skipped         int                `json:"skipped"`
+	Aborted         bool               `json:"aborted"`
+	Errors          []ImportRowError   `json:"errors"`
+	ErrorsTruncated bool               `json:"errors_truncated,omitempty"`
+}
+
+// DumpOptions selects what an SQL dump contains. Tables limits the dump
+// to the named tables and views, with their indexes and triggers.
+type DumpOptions struct {
+	SchemaOnly bool     `json:"schema_only"`
+	DataOnly   bool     `json:"data_only"`
+	Tables     []string `json:"tables,omitempty"`
 }
 
 type QueryRequest struct {
 	SQL string `json:"sql"`
+	// Transaction runs every statement of the script in one transaction,
+	// rolled back if any statement fails.
+	Transaction bool `json:"transaction,omitempty"`
+	// QueryID names the query so it can be cancelled while it runs. The
+	// server picks one when it is empty.
+	QueryID string `json:"query_id,omitempty"`
+	// Page and Limit select which rows of each result are returned.
+	// Limit defaults to, and cannot exceed, the server's row limit.
+	// Statements that change rows are never re-run for a later page.
+	Page  int `json:"page,omitempty"`
+	Limit int `json:"limit,omitempty"`
+	// Explain adds each statement's query plan and total row count to
+	// its result. The script runs in a transaction that is always rolled
+	// back, so it changes nothing.
+	Explain bool `json:"explain,omitempty"`
+	// Params are bound to the parameters of every statement: an array
+	// binds ?, ?NNN and $NNN by position, an object binds :name, @name
+	// and $name by name.
+	Params interface{} `json:"params,omitempty"`
+}
+
+// ScriptResult reports each statement of a script that was run. Running
+// stops at the first failing statement, which is the last entry.
+type ScriptResult struct {
+	QueryID     string            `json:"query_id"`
+	Statements  []StatementResult `json:"statements"`
+	Error       string            `json:"error,omitempty"`
+	Transaction bool              `json:"transaction"`
+	Explain     bool              `json:"explain,omitempty"`
+	RolledBack  bool              `json:"rolled_back,omitempty"`
+	DurationMs  float64           `json:"duration_ms"`
+}
+
+// StatementResult is the outcome of one statement. Offset and End are
+// byte offsets of the statement in the script. Result is set for
+// statements that return rows, including writes with a RETURNING clause,
+// and RowsAffected for statements that can change rows. LastInsertID is
+// the rowid of the last row an INSERT added.
+type StatementResult struct {
+	SQL          string     `json:"sql"`
+	Offset       int        `json:"offset"`
+	End          int        `json:"end"`
+	Result       *TableData `json:"result,omitempty"`
+	RowsAffected *int64     `json:"rows_affected,omitempty"`
+	LastInsertID *int64     `json:"last_insert_id,omitempty"`
+	// Pageable reports that the statement only reads rows, so later
+	// pages of its result can be fetched by running it again.
+	Pageable bool `json:"pageable,omitempty"`
+	// Plan and RowsReturned are reported in explain mode. RowsReturned
+	// counts every row of the result, not only the page returned.
+	Plan         []*PlanNode `json:"plan,omitempty"`
+	RowsReturned *int64      `json:"rows_returned,omitempty"`
+	DurationMs   float64     `json:"duration_ms"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// PlanNode is one step of a query plan from EXPLAIN QUERY PLAN.
+// FullScan flags a scan of a whole table or index, and TempBTree a
+// temporary B-tree built for sorting, grouping or DISTINCT.
+type PlanNode struct {
+	ID        int         `json:"id"`
+	Detail    string      `json:"detail"`
+	FullScan  bool        `json:"full_scan,omitempty"`
+	TempBTree bool        `json:"temp_btree,omitempty"`
+	Children  []*PlanNode `json:"children,omitempty"`
+}
+
+// HistoryEntry is one statement run from the query editor. RowCount is
+// the number of rows returned or changed, when known.
+type HistoryEntry struct {
+	ID         int64     `json:"id"`
+	SQL        string    `json:"sql"`
+	ExecutedAt time.Time `json:"executed_at"`
+	DurationMs float64   `json:"duration_ms"`
+	RowCount   *int64    `json:"row_count,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Params are the parameters the statement ran with, if any.
+	Params interface{} `json:"params,omitempty"`
+}
+
+// Types of saved query parameters. Dates are bound as YYYY-MM-DD text.
+const (
+	ParamText    = "text"
+	ParamInteger = "integer"
+	ParamReal    = "real"
+	ParamBoolean = "boolean"
+	ParamDate    = "date"
+)
+
+// QueryParam defines a named parameter of a saved query.
+type QueryParam struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Default interface{} `json:"default,omitempty"`
+}
+
+// SavedQuery is a query kept in the library to be run again, with the
+// parameters its SQL takes.
+type SavedQuery struct {
+	ID          int64        `json:"id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	SQL         string       `json:"sql"`
+	Params      []QueryParam `json:"params"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// TransactionStatus describes an open transaction session. It is rolled
+// back if it is not used again before ExpiresAt.
+type TransactionStatus struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DatabaseInfo describes a database file the server has open. Its API is
+// served under /api/db/{ID}.
+type DatabaseInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"readonly"`
 }
 
 type ErrorResponse struct {
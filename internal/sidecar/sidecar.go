@@ -0,0 +1,44 @@
+// Package sidecar opens the SQLite files the server keeps for itself in
+// the user's config directory: the query history, saved queries and the
+// audit log. Keeping them in files of their own means the databases being
+// browsed are never written to by them.
+package sidecar
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// Path returns the path of the sidecar file called name in the user's
+// config directory.
+func Path(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sqlite-webgui", name), nil
+}
+
+// Open opens the sidecar file at path, creating it and its directory if
+// needed, and runs schema, which should only create what is missing.
+// Several servers may share the file, so it uses WAL mode and waits for
+// a lock rather than failing. what names the file in errors.
+func Open(path, what, schema string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create %s directory: %w", what, err)
+	}
+
+	conn, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", what, err)
+	}
+	if _, err := conn.Exec(schema); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create %s schema: %w", what, err)
+	}
+	return conn, nil
+}
@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rzhade3/sqlite-webgui/internal/audit"
 	"github.com/rzhade3/sqlite-webgui/internal/database"
 	"github.com/rzhade3/sqlite-webgui/internal/handlers"
+	"github.com/rzhade3/sqlite-webgui/internal/history"
+	"github.com/rzhade3/sqlite-webgui/internal/library"
+	"github.com/rzhade3/sqlite-webgui/internal/models"
 )
 
 //go:embed internal/handlers/web/*
@@ -33,57 +42,271 @@ func openBrowser(url string) error {
 	return cmd.Start()
 }
 
+// runDump writes the database at dbPath to stdout as SQL, which loads
+// back with: sqlite3 new.db < dump.sql
+func runDump(dbPath string, schemaOnly, dataOnly bool, tables string) error {
+	db, err := database.New(dbPath, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	opts := models.DumpOptions{SchemaOnly: schemaOnly, DataOnly: dataOnly}
+	for _, name := range strings.Split(tables, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opts.Tables = append(opts.Tables, name)
+		}
+	}
+
+	return db.Dump(context.Background(), opts, func() (io.Writer, error) {
+		return os.Stdout, nil
+	})
+}
+
+// databasePaths expands the command line arguments into database files.
+// Files are taken as given; directories are scanned, not recursively, for
+// *.db and *.sqlite files.
+func databasePaths(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("database file does not exist: %s", arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if entry.Type().IsRegular() && (ext == ".db" || ext == ".sqlite") {
+				paths = append(paths, filepath.Join(arg, entry.Name()))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no *.db or *.sqlite files in directory: %s", arg)
+		}
+	}
+	return paths, nil
+}
+
+// pathList collects the values of a flag given more than once.
+type pathList []string
+
+func (l *pathList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *pathList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// contains reports whether path, or the directory it is in, is in the
+// list.
+func (l pathList) contains(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, p := range l {
+		if p, err := filepath.Abs(p); err == nil && (p == abs || p == filepath.Dir(abs)) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiRoutes registers the API of the database h serves.
+func apiRoutes(h *handlers.APIHandler, readonly bool) func(chi.Router) {
+	return func(r chi.Router) {
+		r.Use(h.WithTransaction)
+
+		r.Get("/mode", h.GetMode)
+		r.Get("/tables", h.GetTables)
+		r.Get("/tables/{name}/schema", h.GetTableSchema)
+		r.Get("/tables/{name}/data", h.GetTableData)
+		r.Get("/tables/{name}/export", h.ExportTable)
+		r.Get("/tables/{name}/indexes", h.GetIndexes)
+		r.Get("/tables/{name}/definition", h.GetTableDefinition)
+		r.Get("/tables/{name}/referencing", h.GetReferencingRows)
+		r.Get("/tables/{name}/cell", h.GetCell)
+		r.Get("/schema/graph", h.GetSchemaGraph)
+		r.Get("/dump", h.Dump)
+		r.Post("/query", h.ExecuteQuery)
+		r.Post("/query/export", h.ExportQuery)
+		r.Post("/query/{id}/cancel", h.CancelQuery)
+		r.Get("/history", h.GetHistory)
+		r.Get("/saved-queries", h.GetSavedQueries)
+		r.Post("/saved-queries", h.SaveQuery)
+		r.Put("/saved-queries/{id}", h.SaveQuery)
+		r.Delete("/saved-queries/{id}", h.DeleteSavedQuery)
+		r.Get("/audit", h.GetAudit)
+
+		// Only register write endpoints if database is not in read-only mode
+		if !readonly {
+			r.Post("/tables", h.CreateTable)
+			r.Post("/tables/{name}/alter", h.AlterTable)
+			r.Post("/tables/{name}/import", h.ImportCSV)
+			r.Post("/tables/{name}/rows", h.InsertRow)
+			r.Put("/tables/{name}/rows", h.UpdateRow)
+			r.Delete("/tables/{name}/rows", h.DeleteRow)
+			r.Post("/tables/{name}/rows/bulk-delete", h.BulkDeleteRows)
+			r.Post("/tables/{name}/rows/bulk-update", h.BulkUpdateRows)
+			r.Put("/tables/{name}/cell", h.PutCell)
+			r.Post("/tables/{name}/indexes", h.CreateIndex)
+			r.Delete("/tables/{name}/indexes/{index}", h.DropIndex)
+			r.Post("/audit/{id}/undo", h.UndoChange)
+			r.Post("/transactions", h.BeginTransaction)
+			r.Get("/transactions/{id}", h.GetTransaction)
+			r.Post("/transactions/{id}/commit", h.CommitTransaction)
+			r.Post("/transactions/{id}/rollback", h.RollbackTransaction)
+		}
+	}
+}
+
 func main() {
 	port := flag.String("port", "8080", "Port to run the server on")
 	writable := flag.Bool("writable", false, "Enable write operations (default: false, read-only mode)")
+	var writableDBs pathList
+	flag.Var(&writableDBs, "writable-db", "Enable write operations for one database file, or the files of a directory (may be repeated)")
+	dump := flag.Bool("dump", false, "Write the database as SQL to stdout and exit")
+	schemaOnly := flag.Bool("schema-only", false, "With --dump, write only the schema")
+	dataOnly := flag.Bool("data-only", false, "With --dump, write only the rows")
+	tables := flag.String("tables", "", "With --dump, comma-separated tables and views to include")
+	queryTimeout := flag.Duration("query-timeout", 0, "Maximum run time of SQL from the query editor, such as 30s (default: no limit)")
+	maxRows := flag.Int("max-rows", 1000, "Maximum rows returned at once for each statement run from the query editor (0 for no limit)")
+	transactionTimeout := flag.Duration("transaction-timeout", 5*time.Minute, "How long a transaction may sit unused before it is rolled back")
 	flag.Parse()
 
 	args := flag.Args()
 	if len(args) == 0 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [--port PORT] [--writable] <database.db>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [--port PORT] [--writable] <database.db|directory>...\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
 		fmt.Fprintf(os.Stderr, "  --port PORT    Port to run the server on (default: 8080)\n")
 		fmt.Fprintf(os.Stderr, "  --writable     Enable write operations (default: read-only mode)\n")
+		fmt.Fprintf(os.Stderr, "  --writable-db PATH  Enable write operations for one database file or directory (may be repeated)\n")
+		fmt.Fprintf(os.Stderr, "  --query-timeout D  Maximum run time of SQL from the query editor (e.g. 30s; default: no limit)\n")
+		fmt.Fprintf(os.Stderr, "  --max-rows N   Maximum rows returned at once per query result (default: 1000, 0 for no limit)\n")
+		fmt.Fprintf(os.Stderr, "  --transaction-timeout D  Roll back transactions left unused this long (default: 5m)\n")
+		fmt.Fprintf(os.Stderr, "  --dump         Write the database as SQL to stdout and exit\n")
+		fmt.Fprintf(os.Stderr, "  --schema-only  With --dump, write only the schema\n")
+		fmt.Fprintf(os.Stderr, "  --data-only    With --dump, write only the rows\n")
+		fmt.Fprintf(os.Stderr, "  --tables LIST  With --dump, comma-separated tables and views to include\n")
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s mydata.db                  # Read-only mode (safe)\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --writable mydata.db       # Enable write operations\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --port 3000 mydata.db      # Custom port, read-only\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s a.db b.db ./data/          # Several databases, switched between in the sidebar\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --writable-db a.db a.db b.db # Only a.db writable\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --dump mydata.db > dump.sql # Dump as SQL\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	dbPath := args[0]
-
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		log.Fatalf("Database file does not exist: %s", dbPath)
+	// A timeout of zero would roll back every transaction as it begins.
+	if *transactionTimeout <= 0 {
+		log.Fatalf("--transaction-timeout must be greater than zero")
 	}
 
-	readonly := !*writable
-	db, err := database.New(dbPath, readonly)
+	dbPaths, err := databasePaths(args)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		log.Fatal(err)
+	}
+
+	if *dump {
+		if len(dbPaths) != 1 {
+			log.Fatalf("--dump takes a single database file")
+		}
+		if err := runDump(dbPaths[0], *schemaOnly, *dataOnly, *tables); err != nil {
+			log.Fatalf("Dump failed: %v", err)
+		}
+		return
+	}
+
+	// Query history, saved queries and the audit log live in files of
+	// their own, never in the databases themselves. Each is shared by all
+	// the databases, keeping their entries apart by file.
+	var (
+		historyStore *history.Store
+		libraryStore *library.Store
+		auditStore   *audit.Store
+	)
+	if historyPath, err := history.DefaultPath(); err != nil {
+		log.Printf("Query history disabled: %v", err)
+	} else if historyStore, err = history.Open(historyPath); err != nil {
+		log.Printf("Query history disabled: %v", err)
+	} else {
+		defer historyStore.Close()
+	}
+	if libraryPath, err := library.DefaultPath(); err != nil {
+		log.Printf("Saved queries disabled: %v", err)
+	} else if libraryStore, err = library.Open(libraryPath); err != nil {
+		log.Printf("Saved queries disabled: %v", err)
+	} else {
+		defer libraryStore.Close()
+	}
+	if auditPath, err := audit.DefaultPath(); err != nil {
+		log.Printf("Audit log disabled: %v", err)
+	} else if auditStore, err = audit.Open(auditPath); err != nil {
+		log.Printf("Audit log disabled: %v", err)
+	} else {
+		defer auditStore.Close()
+	}
+
+	databases := handlers.NewDatabases()
+	for _, dbPath := range dbPaths {
+		readonly := !*writable && !writableDBs.contains(dbPath)
+		db, err := database.New(dbPath, readonly)
+		if err != nil {
+			log.Fatalf("Failed to open database %s: %v", dbPath, err)
+		}
+		defer db.Close()
+		db.SetQueryTimeout(*queryTimeout)
+		db.SetMaxQueryRows(*maxRows)
+
+		apiHandler := handlers.NewAPIHandler(db)
+		apiHandler.SetTransactionTimeout(*transactionTimeout)
+		if historyStore != nil {
+			apiHandler.SetHistory(historyStore)
+		}
+		if libraryStore != nil {
+			apiHandler.SetLibrary(libraryStore)
+		}
+		if auditStore != nil {
+			apiHandler.SetAudit(auditStore)
+		}
+		databases.Add(apiHandler)
 	}
-	defer db.Close()
 
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	apiHandler := handlers.NewAPIHandler(db)
-
 	r.Route("/api", func(r chi.Router) {
-		r.Get("/mode", apiHandler.GetMode)
-		r.Get("/tables", apiHandler.GetTables)
-		r.Get("/tables/{name}/schema", apiHandler.GetTableSchema)
-		r.Get("/tables/{name}/data", apiHandler.GetTableData)
-		r.Post("/query", apiHandler.ExecuteQuery)
+		r.Use(handlers.WithClient)
 
-		// Only register write endpoints if database is not in read-only mode
-		if !db.IsReadOnly() {
-			r.Post("/tables/{name}/rows", apiHandler.InsertRow)
-			r.Put("/tables/{name}/rows", apiHandler.UpdateRow)
-			r.Delete("/tables/{name}/rows", apiHandler.DeleteRow)
+		r.Get("/databases", databases.GetDatabases)
+		for _, info := range databases.List() {
+			h, _ := databases.Handler(info.ID)
+			r.Route("/db/"+info.ID, apiRoutes(h, info.ReadOnly))
 		}
+
+		// The unscoped routes serve the first database, as they did when
+		// only one could be opened.
+		first := databases.List()[0]
+		h, _ := databases.Handler(first.ID)
+		r.Group(apiRoutes(h, first.ReadOnly))
 	})
 
 	webContent, err := fs.Sub(webFS, "internal/handlers/web")
@@ -95,11 +318,12 @@ func main() {
 	addr := fmt.Sprintf(":%s", *port)
 	url := fmt.Sprintf("http://localhost%s", addr)
 	fmt.Printf("\nSQLite Web GUI is running!\n")
-	fmt.Printf("Database: %s\n", dbPath)
-	if *writable {
-		fmt.Printf("Mode: READ-WRITE\n")
-	} else {
-		fmt.Printf("Mode: READ-ONLY\n")
+	for _, info := range databases.List() {
+		mode := "READ-ONLY"
+		if !info.ReadOnly {
+			mode = "READ-WRITE"
+		}
+		fmt.Printf("Database: %s (%s)\n", info.Path, mode)
 	}
 	fmt.Printf("Open your browser: %s\n\n", url)
 